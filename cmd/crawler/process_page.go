@@ -16,9 +16,11 @@ import (
 )
 
 type PageInfo struct {
-	RawHtml    string `json:"html"`
-	MainHtml   string `json:"main_html"`
-	Screenshot string `json:"screenshot"`
+	RawHtml    string   `json:"html"`
+	MainHtml   string   `json:"main_html"`
+	Screenshot string   `json:"screenshot"`
+	Links      []string `json:"links"`
+	Canonical  string   `json:"canonical"`
 }
 
 type NeedWaitPageFunc func(page *playwright.Page) error
@@ -41,6 +43,17 @@ async (args) => {
 };
 `
 
+// pageLinks the absolute urls of the rendered links,used by the site crawl to follow the pages
+const pageLinks = `
+() => {
+    const canonical = document.querySelector('link[rel="canonical"]');
+    return {
+        links: Array.from(document.querySelectorAll('a[href]')).map(a => a.href).filter(href => href.startsWith('http')),
+        canonical: canonical ? canonical.href : ''
+    };
+};
+`
+
 func fetchURLContent(parsedURL *netURL.URL) (*PageInfo, error) {
 	// check if semaphore is full
 	select {
@@ -105,6 +118,20 @@ func fetchURLContent(parsedURL *netURL.URL) (*PageInfo, error) {
 		return nil, nil
 	}
 
+	// links of the page
+	if result, err := page.Evaluate(pageLinks); err != nil {
+		logs.Error("could not get page links: %v", err)
+	} else if data, ok := result.(map[string]interface{}); ok {
+		if links, ok := data["links"].([]interface{}); ok {
+			for _, link := range links {
+				if href, ok := link.(string); ok {
+					pageInfo.Links = append(pageInfo.Links, href)
+				}
+			}
+		}
+		pageInfo.Canonical, _ = data["canonical"].(string)
+	}
+
 	// take screenshot
 	takeScreenshot(&page, &pageInfo)
 
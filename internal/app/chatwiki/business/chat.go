@@ -842,9 +842,11 @@ func DoChatRequest(params *define.ChatRequestParam, useStream bool, chanStream c
 				`message_id`:    id,
 				`file_id`:       one[`file_id`],
 				`paragraph_id`:  one[`id`],
+				`index_id`:      cast.ToInt(one[`index_id`]),
 				`word_total`:    one[`word_total`],
 				`similarity`:    one[`similarity`],
 				`title`:         one[`title`],
+				`page_num`:      cast.ToInt(one[`page_num`]),
 				`type`:          one[`type`],
 				`content`:       one[`content`],
 				`question`:      one[`question`],
@@ -887,13 +889,23 @@ func buildLibraryChatRequestMessage(params *define.ChatRequestParam, curMsgId in
 	contextList := buildChatContextPair(params.Openid, cast.ToInt(params.Robot[`id`]),
 		dialogueId, int(curMsgId), cast.ToInt(params.Robot[`context_pair`]))
 
-	//question optimize
-	var optimizedQuestions []string
-	if cast.ToBool(params.Robot[`enable_question_optimize`]) && len(params.LibraryIds) > 0 {
-		var err error
-		optimizedQuestions, err = common.GetOptimizedQuestions(params, contextList)
-		if err != nil {
-			logs.Error(err.Error())
+	//library route
+	if len(params.LibraryIds) > 0 {
+		var routeLog string
+		if params.LibraryIds, routeLog = common.RouteLibraryIds(params, params.LibraryIds); len(routeLog) > 0 {
+			*debugLog = append(*debugLog, map[string]string{`type`: `library_route`, `content`: routeLog})
+		}
+	}
+
+	//question optimize and hyde
+	var optimizedQuestions, hydeDrafts []string
+	if len(params.LibraryIds) > 0 {
+		optimizedQuestions, hydeDrafts = common.ExpandQuery(params, contextList)
+		if len(optimizedQuestions) > 0 {
+			*debugLog = append(*debugLog, map[string]string{`type`: `optimized_questions`, `content`: strings.Join(optimizedQuestions, "\n")})
+		}
+		if len(hydeDrafts) > 0 {
+			*debugLog = append(*debugLog, map[string]string{`type`: `hyde_drafts`, `content`: strings.Join(hydeDrafts, "\n")})
 		}
 	}
 
@@ -903,6 +915,7 @@ func buildLibraryChatRequestMessage(params *define.ChatRequestParam, curMsgId in
 		params.AppType,
 		params.Question,
 		optimizedQuestions,
+		hydeDrafts,
 		params.LibraryIds,
 		cast.ToInt(params.Robot[`top_k`]),
 		cast.ToFloat64(params.Robot[`similarity`]),
@@ -937,6 +950,12 @@ func buildLibraryChatRequestMessage(params *define.ChatRequestParam, curMsgId in
 		}
 	}
 
+	//part2.1:knowledge graph community summary
+	if summary := common.GetGraphSummary(list); len(summary) > 0 {
+		messages = append(messages, adaptor.ZhimaChatCompletionMessage{Role: `system`, Content: "knowledge graph summary:\n" + summary})
+		*debugLog = append(*debugLog, map[string]string{`type`: `graph_summary`, `content`: summary})
+	}
+
 	//part3:context_qa
 	// Add a parameter if you need to clarify the distinction
 	for i := range contextList {
@@ -0,0 +1,106 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package business
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/pkg/lib_stub"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp(``, `business_test_logs`)
+	if err != nil {
+		panic(err)
+	}
+	logs.SetLogsDir(dir)
+	gin.SetMode(gin.TestMode)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	_ = os.RemoveAll(`logs`) //written by the i18n init,the locale files are not found from the package directory
+	os.Exit(code)
+}
+
+// stubChatResponder a library robot retrieving by full text and graph,the parser splits the question by the spaces
+func stubChatResponder(query string, args []any) []map[string]string {
+	switch {
+	case lib_stub.TableIs(query, `chat_ai_robot`):
+		return []map[string]string{{`id`: `1`, `admin_user_id`: `1`, `robot_key`: `abcdefghij`, `chat_type`: cast.ToString(define.ChatTypeLibrary),
+			`library_ids`: `1`, `search_type`: cast.ToString(define.SearchTypeFullText), `top_k`: `5`, `similarity`: `0.5`,
+			`rrf_vector_weight`: `1`, `rrf_vector_k`: `60`, `rrf_search_weight`: `1`, `rrf_search_k`: `60`, `rrf_rerank_weight`: `1`, `rrf_rerank_k`: `60`,
+			`graph_status`: `1`, `rrf_graph_weight`: `1`, `rrf_graph_k`: `60`}}
+	case lib_stub.TableIs(query, `chat_ai_library`):
+		return []map[string]string{{`id`: `1`, `admin_user_id`: `1`, `graph_status`: `1`, `graph_model_config_id`: `1`}}
+	case strings.Contains(query, `ts_parse('zhparser',$1)`):
+		rows := make([]map[string]string, 0)
+		for _, token := range strings.Fields(cast.ToString(args[0])) {
+			rows = append(rows, map[string]string{`token`: token})
+		}
+		return rows
+	case strings.HasPrefix(query, `insert`) && strings.Contains(query, `RETURNING id`):
+		return []map[string]string{{`id`: `1`}}
+	}
+	return nil
+}
+
+func TestChatRequestBindsQuestion(t *testing.T) {
+	db, err := lib_stub.RegisterDataBase(define.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	engine.POST(`/chat/request`, ChatRequest)
+	server := httptest.NewServer(engine)
+	defer server.Close()
+	for _, question := range []string{
+		`''; DROP TABLE chat_ai_library; --`,
+		`a' OR '1'='1`,
+		`&|!():*<>\`,
+		`x' OR $1='1`,
+		`'::vector)) as similarity FROM pg_user --`,
+		`中文'引号`,
+	} {
+		db.Reset(stubChatResponder)
+		define.Redis = lib_stub.NewRedis()
+		form := url.Values{`robot_key`: {`abcdefghij`}, `openid`: {`openid_1`}, `question`: {question}}
+		resp, err := http.PostForm(server.URL+`/chat/request`, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		queries := db.Queries()
+		for _, query := range queries {
+			if strings.Contains(query.Sql, question) {
+				t.Fatalf(`question %q is in the sql:%s`, question, query.Sql)
+			}
+		}
+		checks := map[string]string{`ts_parse`: question, `chat_ai_library_graph_alias`: common.NormalizeGraphName(question),
+			`to_tsquery`: common.BuildTsQuery(strings.Fields(question))}
+		for table, input := range checks {
+			if len(input) == 0 {
+				continue
+			}
+			bound := false
+			for _, query := range queries {
+				if strings.Contains(query.Sql, table) && query.HasArg(input) {
+					bound = true
+				}
+			}
+			if !bound {
+				t.Fatalf(`%q is not bound to the statement of %s`, input, table)
+			}
+		}
+	}
+}
@@ -15,7 +15,7 @@ import (
 func RenewCrawl() {
 	docs, err := msql.Model(`chat_ai_library_file`, `postgres`).
 		Where(`doc_type`, cast.ToString(define.DocTypeOnline)).
-		Where(`status`, cast.ToString(define.FileStatusLearned)).
+		Where(`status`, `in`, cast.ToString(define.FileStatusLearned)+`,`+cast.ToString(define.FileStatusLearnedWithErrors)).
 		Where(`doc_auto_renew_frequency`, ">", "1").
 		Where(`doc_last_renew_time`, "<=", cast.ToString(time.Now().Add(-24*time.Hour).Unix())).
 		Field(`id,admin_user_id,doc_auto_renew_frequency,doc_last_renew_time,doc_url`).
@@ -49,6 +49,59 @@ func RenewCrawl() {
 	}
 }
 
+// SyncLibraryRepo add the sync jobs of the sources whose interval is due
+func SyncLibraryRepo() {
+	repos, err := msql.Model(`chat_ai_library_repo`, define.Postgres).
+		Where(`sync_interval`, `>`, `0`).
+		Field(`id,status,sync_interval,last_sync_time,update_time`).
+		Select()
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	now := tool.Time2Int()
+	for _, repo := range repos {
+		if cast.ToInt(repo[`status`]) == define.RepoStatusSyncing && cast.ToInt(repo[`update_time`]) > now-define.RepoSyncTimeout {
+			continue //syncing
+		}
+		if cast.ToInt(repo[`last_sync_time`])+cast.ToInt(repo[`sync_interval`])*60 > now {
+			continue
+		}
+		if err = common.AddRepoSyncJob(cast.ToInt(repo[`id`])); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+}
+
+// RenewLibraryCrawl start the new rounds of the due jobs,the running jobs left by the stopped consumers are continued
+func RenewLibraryCrawl() {
+	jobs, err := msql.Model(`chat_ai_library_crawl`, define.Postgres).
+		Where(`status`, `<>`, cast.ToString(define.CrawlStatusCancelled)).
+		Field(`id,status,renew_frequency,last_renew_time,update_time`).
+		Select()
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	now := tool.Time2Int()
+	for _, job := range jobs {
+		if cast.ToInt(job[`status`]) == define.CrawlStatusRunning {
+			if cast.ToInt(job[`update_time`]) <= now-define.CrawlStaleTime {
+				if err = common.AddCrawlJob(cast.ToInt(job[`id`])); err != nil {
+					logs.Error(err.Error())
+				}
+			}
+			continue
+		}
+		if !common.IsCrawlRenewDue(job) {
+			continue
+		}
+		if err = common.StartCrawlRound(cast.ToInt(job[`id`])); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+}
+
 func DeleteFormEntry() {
 	_, err := msql.Model(`form_entry`, define.Postgres).
 		Where(`delete_time`, `>`, `0`).
@@ -59,3 +112,83 @@ func DeleteFormEntry() {
 		return
 	}
 }
+
+// RenewLibraryReindex continue the running reindex whose batch message is lost
+func RenewLibraryReindex() {
+	list, err := msql.Model(`chat_ai_library_reindex`, define.Postgres).
+		Where(`status`, cast.ToString(define.ReindexStatusRunning)).
+		Where(`update_time`, `<=`, cast.ToString(tool.Time2Int()-define.ReindexStaleTime)).
+		Field(`id`).Select()
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	for _, reindex := range list {
+		if message, err := tool.JsonEncode(map[string]any{`id`: cast.ToInt(reindex[`id`])}); err != nil {
+			logs.Error(err.Error())
+		} else if err = common.AddJobs(define.LibraryReindexTopic, message); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+}
+
+// RenewLibraryImport continue the running import interrupted by a restart,the imported files are skipped
+func RenewLibraryImport() {
+	list, err := msql.Model(`chat_ai_library_import`, define.Postgres).
+		Where(`status`, cast.ToString(define.ImportStatusRunning)).
+		Where(`update_time`, `<=`, cast.ToString(tool.Time2Int()-define.ImportStaleTime)).
+		Field(`id`).Select()
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	for _, job := range list {
+		if message, err := tool.JsonEncode(map[string]any{`id`: cast.ToInt(job[`id`])}); err != nil {
+			logs.Error(err.Error())
+		} else if err = common.AddJobs(define.LibraryImportTopic, message); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+}
+
+func CleanLibraryReindex() {
+	list, err := msql.Model(`chat_ai_library_reindex`, define.Postgres).
+		Where(`status`, cast.ToString(define.ReindexStatusSwitched)).
+		Where(`switch_time`, `<`, cast.ToString(tool.Time2Int()-define.ReindexRollbackKeepTime)).
+		Select()
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	for _, reindex := range list {
+		if err = common.ClearReindexShadow(cast.ToInt(reindex[`library_id`])); err != nil {
+			continue
+		}
+		_, err = msql.Model(`chat_ai_library_reindex`, define.Postgres).Where(`id`, reindex[`id`]).Update(msql.Datas{
+			`status`:      define.ReindexStatusFinished,
+			`update_time`: tool.Time2Int(),
+		})
+		if err != nil {
+			logs.Error(err.Error())
+		}
+	}
+}
+
+// BuildLibraryGraphCommunity add the community jobs of the changed graphs
+func BuildLibraryGraphCommunity() {
+	libraryIds, err := msql.Model(`chat_ai_library`, define.Postgres).
+		Where(`graph_status`, cast.ToString(define.SwitchOn)).
+		Where(`graph_dirty`, cast.ToString(define.SwitchOn)).
+		ColumnArr(`id`)
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	for _, libraryId := range libraryIds {
+		if message, err := tool.JsonEncode(map[string]any{`library_id`: libraryId}); err != nil {
+			logs.Error(err.Error())
+		} else if err := common.AddJobs(define.GraphCommunityTopic, message); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+}
@@ -71,7 +71,7 @@ func GetAnswerSource(c *gin.Context) {
 	}
 	list, err := msql.Model(`chat_ai_answer_source`, define.Postgres).Where(`admin_user_id`, cast.ToString(chatBaseParam.AdminUserId)).
 		Where(`message_id`, cast.ToString(messageId)).Where(`file_id`, cast.ToString(fileId)).
-		Order(`id`).Field(`paragraph_id as id,word_total,similarity,title,type,content,question,answer,images`).Select()
+		Order(`id`).Field(`paragraph_id as id,index_id,word_total,similarity,title,page_num,type,content,question,answer,images`).Select()
 	if err != nil {
 		logs.Error(err.Error())
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
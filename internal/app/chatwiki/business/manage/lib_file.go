@@ -54,6 +54,10 @@ func GetLibFileList(c *gin.Context) {
 	if len(fileName) > 0 {
 		m.Where(`file_name`, `like`, fileName)
 	}
+	folderPath := strings.TrimSpace(c.Query(`folder_path`))
+	if len(folderPath) > 0 {
+		m.Where(`folder_path`, `like`, folderPath)
+	}
 	list, total, err := m.Order(`id desc`).Paginate(page, size)
 	if err != nil {
 		logs.Error(err.Error())
@@ -152,51 +156,20 @@ func addLibFile(c *gin.Context, userId, libraryId int) ([]int64, error) {
 	fileIds := make([]int64, 0)
 
 	for _, uploadInfo := range libraryFiles {
-		status := define.FileStatusInitial
-		isTableFile := define.IsTableFile(uploadInfo.Ext)
-		if isTableFile {
-			status = define.FileStatusWaitSplit
-		}
-		insData := msql.Datas{
-			`admin_user_id`:        userId,
-			`library_id`:           libraryId,
-			`file_url`:             uploadInfo.Link,
-			`file_name`:            uploadInfo.Name,
-			`status`:               status,
-			`chunk_size`:           512,
-			`chunk_overlap`:        0,
-			`separators_no`:        `11,12`,
-			`enable_extract_image`: true,
-			`file_ext`:             uploadInfo.Ext,
-			`file_size`:            uploadInfo.Size,
-			`create_time`:          tool.Time2Int(),
-			`update_time`:          tool.Time2Int(),
-			`is_table_file`:        cast.ToInt(isTableFile),
-			`doc_type`:             uploadInfo.GetDocType(),
-			`doc_url`:              uploadInfo.DocUrl,
-		}
+		extra := msql.Datas{}
 		if uploadInfo.Custom {
-			insData[`status`] = define.FileStatusLearned
-			insData[`html_url`] = insData[`file_url`]
-			insData[`is_qa_doc`] = isQaDoc
+			extra[`status`] = define.FileStatusLearned
+			extra[`html_url`] = uploadInfo.Link
+			extra[`is_qa_doc`] = isQaDoc
 			if qaIndexType != 0 {
-				insData[`qa_index_type`] = qaIndexType
+				extra[`qa_index_type`] = qaIndexType
 			}
 		}
-		fileId, err := m.Insert(insData, `id`)
-		//clear cached data
-		lib_redis.DelCacheData(define.Redis, &common.LibFileCacheBuildHandler{FileId: int(fileId)})
+		fileId, err := common.InsertLibraryFile(userId, libraryId, uploadInfo, extra)
 		if err != nil {
 			logs.Error(err.Error())
 		} else {
 			fileIds = append(fileIds, fileId)
-			if !isTableFile && !uploadInfo.Custom { //async task:convert html
-				if message, err := tool.JsonEncode(map[string]any{`file_id`: fileId, `file_url`: uploadInfo.Link}); err != nil {
-					logs.Error(err.Error())
-				} else if err := common.AddJobs(define.ConvertHtmlTopic, message); err != nil {
-					logs.Error(err.Error())
-				}
-			}
 		}
 	}
 	return fileIds, nil
@@ -251,23 +224,11 @@ func DelLibraryFile(c *gin.Context) {
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
 		return
 	}
-	_, err = msql.Model(`chat_ai_library_file`, define.Postgres).Where(`id`, cast.ToString(id)).Delete()
-	if err != nil {
+	if err = common.DeleteLibraryFile(id); err != nil {
 		logs.Error(err.Error())
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
 		return
 	}
-	//clear cached data
-	lib_redis.DelCacheData(define.Redis, &common.LibFileCacheBuildHandler{FileId: id})
-	//dispose relation data
-	_, err = msql.Model(`chat_ai_library_file_data`, define.Postgres).Where(`file_id`, cast.ToString(id)).Delete()
-	if err != nil {
-		logs.Error(err.Error())
-	}
-	_, err = msql.Model(`chat_ai_library_file_data_index`, define.Postgres).Where(`file_id`, cast.ToString(id)).Delete()
-	if err != nil {
-		logs.Error(err.Error())
-	}
 	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
 }
 
@@ -351,14 +312,50 @@ func GetLibFileSplit(c *gin.Context) {
 		QuestionColumn:     strings.TrimSpace(c.Query(`question_column`)),
 		AnswerColumn:       strings.TrimSpace(c.Query(`answer_column`)),
 		EnableExtractImage: cast.ToBool(c.Query(`enable_extract_image`)),
+		SplitMode:          cast.ToInt(c.Query(`split_mode`)),
+		ChunkUnit:          cast.ToInt(c.Query(`chunk_unit`)),
+		TableFormat:        cast.ToInt(c.Query(`table_format`)),
+		JsonRecordPath:     strings.TrimSpace(c.Query(`json_record_path`)),
+		JsonContentField:   strings.TrimSpace(c.Query(`json_content_field`)),
+		JsonQuestionField:  strings.TrimSpace(c.Query(`json_question_field`)),
+		JsonAnswerField:    strings.TrimSpace(c.Query(`json_answer_field`)),
 	}
-	list, wordTotal, err := common.GetLibFileSplit(userId, fileId, splitParams, common.GetLang(c))
+	if err := tool.JsonDecode(c.DefaultQuery(`separator_rules`, `[]`), &splitParams.SeparatorRules); err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `separator_rules`))))
+		return
+	}
+	//preview with the params of a saved preset
+	if presetId := cast.ToInt(c.Query(`preset_id`)); presetId > 0 {
+		preset, err := getSplitPreset(userId, presetId)
+		if err != nil {
+			logs.Error(err.Error())
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+			return
+		}
+		if len(preset) == 0 {
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `preset_id`))))
+			return
+		}
+		splitParams = define.SplitParams{Separators: make([]string, 0)}
+		if err = tool.JsonDecodeUseNumber(preset[`split_params`], &splitParams); err != nil {
+			logs.Error(err.Error())
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+			return
+		}
+	}
+	list, wordTotal, tokenizer, err := common.GetLibFileSplit(userId, fileId, splitParams, common.GetLang(c))
 	if err != nil {
 		logs.Error(err.Error())
 		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
 		return
 	}
-	data := map[string]any{`split_params`: splitParams, `list`: list, `word_total`: wordTotal}
+	tokenTotal := 0
+	for _, item := range list {
+		tokenTotal += item.TokenTotal
+	}
+	//the token counts are estimated for the embedding models without a known tokenizer
+	data := map[string]any{`split_params`: splitParams, `list`: list, `word_total`: wordTotal, `token_total`: tokenTotal,
+		`token_estimated`: tokenizer.Estimated(), `token_limit`: tokenizer.InputLimit()}
 	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
 }
 
@@ -375,7 +372,7 @@ func SaveLibFileSplit(c *gin.Context) {
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `split_params`))))
 		return
 	}
-	list, wordTotal, err := common.GetLibFileSplit(userId, fileId, splitParams, common.GetLang(c))
+	list, wordTotal, _, err := common.GetLibFileSplit(userId, fileId, splitParams, common.GetLang(c))
 	if err != nil {
 		logs.Error(err.Error())
 		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
@@ -486,6 +483,32 @@ func EditLibFile(c *gin.Context) {
 	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
 }
 
+// GetLibFileChangeList the paragraph changes of each learning of the file
+func GetLibFileChangeList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	fileId := cast.ToInt(c.Query(`file_id`))
+	if fileId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	list, total, err := msql.Model(`chat_ai_library_file_change`, define.Postgres).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Where(`file_id`, cast.ToString(fileId)).
+		Order(`id desc`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
+
 func RenewLibraryFile(c *gin.Context) {
 	var userId int
 	if userId = GetAdminUserId(c); userId == 0 {
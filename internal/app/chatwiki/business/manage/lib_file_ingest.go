@@ -0,0 +1,188 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+func GetLibFileIngestList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.Query(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	m := msql.Model(`chat_ai_library_file_ingest`, define.Postgres).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Where(`library_id`, cast.ToString(libraryId))
+	if fileId := cast.ToInt(c.Query(`file_id`)); fileId > 0 {
+		m.Where(`file_id`, cast.ToString(fileId))
+	}
+	if stage := cast.ToInt(c.Query(`stage`)); stage > 0 {
+		m.Where(`stage`, cast.ToString(stage))
+	}
+	if status := cast.ToInt(c.Query(`status`)); status > 0 {
+		m.Where(`status`, cast.ToString(status))
+	}
+	list, total, err := m.Order(`id desc`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
+
+// GetLibFileIngestInfo the ingestion job and the errors of the vectors that failed to convert
+func GetLibFileIngestInfo(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.Query(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	info, err := msql.Model(`chat_ai_library_file_ingest`, define.Postgres).
+		Where(`id`, cast.ToString(id)).
+		Where(`admin_user_id`, cast.ToString(userId)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(info) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	failed, err := msql.Model(`chat_ai_library_file_data_index`, define.Postgres).
+		Where(`file_id`, info[`file_id`]).
+		Where(`status`, cast.ToString(define.VectorStatusException)).
+		Where(`update_time`, `>=`, info[`embed_time`]).
+		Field(`id,data_id,type,errmsg,update_time`).
+		Order(`id`).Limit(100).Select()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`info`: info, `failed`: failed}, nil))
+}
+
+// StreamLibFileIngest push the ingestion jobs of the library as server-sent events when they change.
+// The stream of a file is closed after its job ends
+func StreamLibFileIngest(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId, fileId := cast.ToInt(c.Query(`library_id`)), cast.ToInt(c.Query(`file_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	library, err := common.GetLibraryInfo(libraryId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(library) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	c.Header(`Content-Type`, `text/event-stream`)
+	c.Header(`Cache-Control`, `no-cache`)
+	c.Header(`Connection`, `keep-alive`)
+	if define.IsDev {
+		c.Header(`Access-Control-Allow-Origin`, `*`)
+	}
+	//the running jobs or the last job of the file first,then the jobs updated since the last poll
+	sent, since, first := make(map[string]string), 0, true
+	c.Stream(func(_ io.Writer) bool {
+		if !first {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-time.After(define.IngestStreamInterval * time.Second):
+			}
+		}
+		first = false
+		m := msql.Model(`chat_ai_library_file_ingest`, define.Postgres).
+			Where(`admin_user_id`, cast.ToString(userId)).
+			Where(`library_id`, cast.ToString(libraryId))
+		if fileId > 0 {
+			m.Where(`file_id`, cast.ToString(fileId))
+		}
+		switch {
+		case since > 0:
+			m.Where(`update_time`, `>=`, cast.ToString(since)).Order(`id`)
+		case fileId > 0: //the last job of the file,even if it has ended
+			m.Order(`id desc`).Limit(1)
+		default:
+			m.Where(`status`, cast.ToString(define.IngestStatusRunning)).Order(`id`)
+		}
+		now := tool.Time2Int()
+		list, err := m.Select()
+		if err != nil {
+			logs.Error(err.Error())
+			c.SSEvent(`error`, i18n.Show(common.GetLang(c), `sys_err`))
+			return false
+		}
+		since = int(now) - 1 //the rows updated in the same second are checked again
+		changed := false
+		for _, job := range list {
+			//update_time is in seconds,so the jobs are compared by the hash of the whole row
+			hash, err := tool.JsonEncode(job)
+			if err != nil {
+				logs.Error(err.Error())
+				continue
+			}
+			if hash = tool.MD5(hash); sent[job[`id`]] == hash {
+				continue
+			}
+			sent[job[`id`]] = hash
+			c.SSEvent(`progress`, job)
+			changed = true
+		}
+		if !changed {
+			c.SSEvent(`ping`, now)
+		}
+		if fileId > 0 {
+			running, err := msql.Model(`chat_ai_library_file_ingest`, define.Postgres).
+				Where(`admin_user_id`, cast.ToString(userId)).
+				Where(`library_id`, cast.ToString(libraryId)).
+				Where(`file_id`, cast.ToString(fileId)).
+				Where(`status`, cast.ToString(define.IngestStatusRunning)).Count(`1`)
+			if err != nil {
+				logs.Error(err.Error())
+			}
+			if err == nil && running == 0 {
+				c.SSEvent(`finish`, fileId)
+				return false
+			}
+		}
+		return true
+	})
+}
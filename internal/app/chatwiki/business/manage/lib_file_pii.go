@@ -0,0 +1,73 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+)
+
+func GetPiiDetectorList(c *gin.Context) {
+	if userId := GetAdminUserId(c); userId == 0 {
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(define.PiiDetectorList, nil))
+}
+
+// GetLibFilePiiReport what was redacted in the last learning,of a file or all the files of a library
+func GetLibFilePiiReport(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId, fileId := cast.ToInt(c.Query(`library_id`)), cast.ToInt(c.Query(`file_id`))
+	if libraryId <= 0 && fileId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	m := msql.Model(`chat_ai_library_file_pii`, define.Postgres).Where(`admin_user_id`, cast.ToString(userId))
+	if fileId > 0 {
+		m.Where(`file_id`, cast.ToString(fileId))
+	} else {
+		m.Where(`library_id`, cast.ToString(libraryId))
+	}
+	if detector := strings.TrimSpace(c.Query(`detector`)); len(detector) > 0 {
+		m.Where(`detector`, detector)
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	list, total, err := m.Order(`file_id,number,id`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`list`: list, `total`: total, `page`: page, `size`: size}
+	if fileId > 0 {
+		//the hits of each detector in the file
+		rows, err := msql.Model(`chat_ai_library_file_pii`, define.Postgres).
+			Where(`admin_user_id`, cast.ToString(userId)).
+			Where(`file_id`, cast.ToString(fileId)).Field(`detector,hit_total`).Select()
+		if err != nil {
+			logs.Error(err.Error())
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+			return
+		}
+		summary := make(map[string]int)
+		for _, row := range rows {
+			summary[row[`detector`]] += cast.ToInt(row[`hit_total`])
+		}
+		data[`summary`] = summary
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
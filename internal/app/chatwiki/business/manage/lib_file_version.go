@@ -0,0 +1,160 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+)
+
+const libFileVersionFields = `id,file_id,version,file_name,file_url,file_size,html_url,split_params,qa_index_type,word_total,paragraph_total,rollback_version,create_time`
+
+func getLibFileVersion(userId, id int) (msql.Params, error) {
+	return msql.Model(`chat_ai_library_file_version`, define.Postgres).
+		Where(`id`, cast.ToString(id)).
+		Where(`admin_user_id`, cast.ToString(userId)).Find()
+}
+
+func GetLibFileVersionList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	fileId := cast.ToInt(c.Query(`file_id`))
+	if fileId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	list, total, err := msql.Model(`chat_ai_library_file_version`, define.Postgres).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Where(`file_id`, cast.ToString(fileId)).
+		Field(libFileVersionFields).Order(`version desc`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
+
+// GetLibFileVersionInfo the version with its paragraph snapshot
+func GetLibFileVersionInfo(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.Query(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	version, err := getLibFileVersion(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(version) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	paragraphs, err := common.GetLibFileVersionParagraphs(version)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	delete(version, `paragraphs`)
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`info`: version, `paragraphs`: paragraphs}, nil))
+}
+
+// GetLibFileVersionDiff the changes from the compared version to the version,
+// the previous version of the file is compared when compare_id is empty
+func GetLibFileVersionDiff(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id, compareId := cast.ToInt(c.Query(`id`)), cast.ToInt(c.Query(`compare_id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	version, err := getLibFileVersion(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(version) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	var compare msql.Params
+	if compareId > 0 {
+		compare, err = getLibFileVersion(userId, compareId)
+	} else {
+		compare, err = msql.Model(`chat_ai_library_file_version`, define.Postgres).
+			Where(`file_id`, version[`file_id`]).
+			Where(`version`, `<`, version[`version`]).
+			Order(`version desc`).Find()
+	}
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(compare) == 0 || compare[`file_id`] != version[`file_id`] {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `compare_id`))))
+		return
+	}
+	diff, err := common.DiffLibFileVersion(compare, version)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	delete(version, `paragraphs`)
+	delete(compare, `paragraphs`)
+	diff[`version`], diff[`compare`] = version, compare
+	c.String(http.StatusOK, lib_web.FmtJson(diff, nil))
+}
+
+func RollbackLibFileVersion(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	version, err := getLibFileVersion(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(version) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	if err = common.RollbackLibFileVersion(userId, version, common.GetLang(c)); err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
@@ -145,6 +145,31 @@ func CreateLibrary(c *gin.Context) {
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
 		return
 	}
+	enableParentChild, childChunkSize, err := getParentChildParams(c, nil)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	syntheticParams, err := getSyntheticQuestionParams(c, userId, nil)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	graphParams, err := getGraphParams(c, userId, nil)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	piiParams, err := getPiiParams(c, nil)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	separatorRules, err := getSeparatorRulesParams(c, nil)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
 	//check model_config_id and use_model
 	config, err := common.GetModelConfigInfo(modelConfigId, userId)
 	if err != nil {
@@ -169,13 +194,25 @@ func CreateLibrary(c *gin.Context) {
 	}
 	//database dispose
 	data := msql.Datas{
-		`admin_user_id`:   userId,
-		`library_name`:    libraryName,
-		`library_intro`:   libraryIntro,
-		`model_config_id`: modelConfigId,
-		`use_model`:       useModel,
-		`create_time`:     tool.Time2Int(),
-		`update_time`:     tool.Time2Int(),
+		`admin_user_id`:       userId,
+		`library_name`:        libraryName,
+		`library_intro`:       libraryIntro,
+		`model_config_id`:     modelConfigId,
+		`use_model`:           useModel,
+		`enable_parent_child`: enableParentChild,
+		`child_chunk_size`:    childChunkSize,
+		`separator_rules`:     separatorRules,
+		`create_time`:         tool.Time2Int(),
+		`update_time`:         tool.Time2Int(),
+	}
+	for k, v := range syntheticParams {
+		data[k] = v
+	}
+	for k, v := range graphParams {
+		data[k] = v
+	}
+	for k, v := range piiParams {
+		data[k] = v
 	}
 	if len(avatar) > 0 {
 		data[`avatar`] = avatar
@@ -199,6 +236,155 @@ func CreateLibrary(c *gin.Context) {
 	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`id`: libraryId, `file_ids`: fileIds}, nil))
 }
 
+func getParentChildParams(c *gin.Context, info msql.Params) (int, int, error) {
+	if len(info) == 0 {
+		info = msql.Params{`enable_parent_child`: cast.ToString(define.SwitchOff), `child_chunk_size`: `200`}
+	}
+	enableParentChild := cast.ToInt(c.DefaultPostForm(`enable_parent_child`, info[`enable_parent_child`]))
+	childChunkSize := cast.ToInt(c.DefaultPostForm(`child_chunk_size`, info[`child_chunk_size`]))
+	if enableParentChild != define.SwitchOff && enableParentChild != define.SwitchOn {
+		return 0, 0, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `enable_parent_child`))
+	}
+	if childChunkSize < define.ChildChunkSizeMin || childChunkSize > define.ChildChunkSizeMax {
+		return 0, 0, errors.New(i18n.Show(common.GetLang(c), `child_chunk_size_err`, define.ChildChunkSizeMin, define.ChildChunkSizeMax))
+	}
+	return enableParentChild, childChunkSize, nil
+}
+
+// checkLlmModel the llm of the model config belongs to the user,the field names in the errors start with prefix
+func checkLlmModel(c *gin.Context, userId, modelConfigId int, useModel, prefix string) error {
+	config, err := common.GetModelConfigInfo(modelConfigId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		return errors.New(i18n.Show(common.GetLang(c), `sys_err`))
+	}
+	if len(config) == 0 || !tool.InArrayString(common.Llm, strings.Split(config[`model_types`], `,`)) {
+		return errors.New(i18n.Show(common.GetLang(c), `param_invalid`, prefix+`model_config_id`))
+	}
+	modelInfo, _ := common.GetModelInfoByDefine(config[`model_define`])
+	if !tool.InArrayString(useModel, modelInfo.LlmModelList) && !common.IsMultiConfModel(config["model_define"]) {
+		return errors.New(i18n.Show(common.GetLang(c), `param_invalid`, prefix+`use_model`))
+	}
+	return nil
+}
+
+// getSyntheticQuestionParams the llm used to generate likely user questions for the normal paragraphs
+func getSyntheticQuestionParams(c *gin.Context, userId int, info msql.Params) (msql.Datas, error) {
+	if len(info) == 0 {
+		info = msql.Params{`synthetic_question_status`: cast.ToString(define.SwitchOff), `synthetic_question_num`: `3`}
+	}
+	status := cast.ToInt(c.DefaultPostForm(`synthetic_question_status`, info[`synthetic_question_status`]))
+	num := cast.ToInt(c.DefaultPostForm(`synthetic_question_num`, info[`synthetic_question_num`]))
+	modelConfigId := cast.ToInt(c.DefaultPostForm(`synthetic_model_config_id`, info[`synthetic_model_config_id`]))
+	useModel := strings.TrimSpace(c.DefaultPostForm(`synthetic_use_model`, info[`synthetic_use_model`]))
+	if status != define.SwitchOff && status != define.SwitchOn {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `synthetic_question_status`))
+	}
+	if num < define.SyntheticQuestionNumMin || num > define.SyntheticQuestionNumMax {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `synthetic_question_num_err`, define.SyntheticQuestionNumMin, define.SyntheticQuestionNumMax))
+	}
+	if status == define.SwitchOn {
+		if err := checkLlmModel(c, userId, modelConfigId, useModel, `synthetic_`); err != nil {
+			return nil, err
+		}
+	}
+	return msql.Datas{
+		`synthetic_question_status`: status,
+		`synthetic_question_num`:    num,
+		`synthetic_model_config_id`: modelConfigId,
+		`synthetic_use_model`:       useModel,
+	}, nil
+}
+
+// getGraphParams the llm used to extract the entities and relations of the paragraphs
+func getGraphParams(c *gin.Context, userId int, info msql.Params) (msql.Datas, error) {
+	if len(info) == 0 {
+		info = msql.Params{`graph_status`: cast.ToString(define.SwitchOff)}
+	}
+	status := cast.ToInt(c.DefaultPostForm(`graph_status`, info[`graph_status`]))
+	modelConfigId := cast.ToInt(c.DefaultPostForm(`graph_model_config_id`, info[`graph_model_config_id`]))
+	useModel := strings.TrimSpace(c.DefaultPostForm(`graph_use_model`, info[`graph_use_model`]))
+	if status != define.SwitchOff && status != define.SwitchOn {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `graph_status`))
+	}
+	if status == define.SwitchOn {
+		if err := checkLlmModel(c, userId, modelConfigId, useModel, `graph_`); err != nil {
+			return nil, err
+		}
+	}
+	return msql.Datas{
+		`graph_status`:          status,
+		`graph_model_config_id`: modelConfigId,
+		`graph_use_model`:       useModel,
+	}, nil
+}
+
+// getPiiParams the redaction of the personal information between the split and the save
+func getPiiParams(c *gin.Context, info msql.Params) (msql.Datas, error) {
+	if len(info) == 0 {
+		info = msql.Params{`pii_status`: cast.ToString(define.SwitchOff), `pii_action`: cast.ToString(define.PiiActionMask), `pii_patterns`: `[]`}
+	}
+	status := cast.ToInt(c.DefaultPostForm(`pii_status`, info[`pii_status`]))
+	action := cast.ToInt(c.DefaultPostForm(`pii_action`, info[`pii_action`]))
+	detectors := strings.TrimSpace(c.DefaultPostForm(`pii_detectors`, info[`pii_detectors`]))
+	patterns := strings.TrimSpace(c.DefaultPostForm(`pii_patterns`, info[`pii_patterns`]))
+	if status != define.SwitchOff && status != define.SwitchOn {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `pii_status`))
+	}
+	if !tool.InArrayInt(action, []int{define.PiiActionMask, define.PiiActionDrop, define.PiiActionFlag}) {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `pii_action`))
+	}
+	names := make([]string, 0)
+	for _, name := range strings.Split(detectors, `,`) {
+		if name = strings.TrimSpace(name); len(name) == 0 || tool.InArrayString(name, names) {
+			continue
+		}
+		if !common.IsPiiBuiltinDetector(name) {
+			return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `pii_detectors`))
+		}
+		names = append(names, name)
+	}
+	list, err := common.ParsePiiPatterns(patterns)
+	if err != nil {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `pii_pattern_err`, err.Error()))
+	}
+	if status == define.SwitchOn && len(names) == 0 && len(list) == 0 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))
+	}
+	patterns, err = tool.JsonEncode(list)
+	if err != nil {
+		logs.Error(err.Error())
+		return nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))
+	}
+	return msql.Datas{
+		`pii_status`:    status,
+		`pii_action`:    action,
+		`pii_detectors`: strings.Join(names, `,`),
+		`pii_patterns`:  patterns,
+	}, nil
+}
+
+// getSeparatorRulesParams the default custom separators of the files whose split params have none
+func getSeparatorRulesParams(c *gin.Context, info msql.Params) (string, error) {
+	if len(info) == 0 {
+		info = msql.Params{`separator_rules`: `[]`}
+	}
+	rules := make([]define.SeparatorRule, 0)
+	if err := tool.JsonDecode(c.DefaultPostForm(`separator_rules`, info[`separator_rules`]), &rules); err != nil {
+		return ``, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `separator_rules`))
+	}
+	rules, err := common.CheckSeparatorRules(rules, common.GetLang(c))
+	if err != nil {
+		return ``, err
+	}
+	separatorRules, err := tool.JsonEncode(rules)
+	if err != nil {
+		logs.Error(err.Error())
+		return ``, errors.New(i18n.Show(common.GetLang(c), `sys_err`))
+	}
+	return separatorRules, nil
+}
+
 func DeleteLibrary(c *gin.Context) {
 	var userId int
 	if userId = GetAdminUserId(c); userId == 0 {
@@ -249,6 +435,7 @@ func DeleteLibrary(c *gin.Context) {
 	if err != nil {
 		logs.Error(err.Error())
 	}
+	common.ClearLibraryGraph(id)
 	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
 }
 
@@ -274,11 +461,45 @@ func EditLibrary(c *gin.Context) {
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
 		return
 	}
-	_, err = msql.Model(`chat_ai_library`, define.Postgres).Where(`id`, cast.ToString(id)).Update(msql.Datas{
-		`library_name`:  libraryName,
-		`library_intro`: libraryIntro,
-		`update_time`:   tool.Time2Int(),
-	})
+	//takes effect on the next learning of the files
+	enableParentChild, childChunkSize, err := getParentChildParams(c, info)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	data, err := getSyntheticQuestionParams(c, userId, info)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	graphParams, err := getGraphParams(c, userId, info)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	piiParams, err := getPiiParams(c, info)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	separatorRules, err := getSeparatorRulesParams(c, info)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	for k, v := range graphParams {
+		data[k] = v
+	}
+	for k, v := range piiParams {
+		data[k] = v
+	}
+	data[`library_name`] = libraryName
+	data[`library_intro`] = libraryIntro
+	data[`enable_parent_child`] = enableParentChild
+	data[`child_chunk_size`] = childChunkSize
+	data[`separator_rules`] = separatorRules
+	data[`update_time`] = tool.Time2Int()
+	_, err = msql.Model(`chat_ai_library`, define.Postgres).Where(`id`, cast.ToString(id)).Update(data)
 	if err != nil {
 		logs.Error(err.Error())
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
@@ -289,6 +510,8 @@ func EditLibrary(c *gin.Context) {
 	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
 }
 
+// LibraryRecallTest the list is returned as it is,with query_expansion_type the expanded questions
+// and the hypothetical answers are returned with the list
 func LibraryRecallTest(c *gin.Context) {
 	var userId int
 	if userId = GetAdminUserId(c); userId == 0 {
@@ -322,13 +545,60 @@ func LibraryRecallTest(c *gin.Context) {
 	if err != nil {
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
 	}
-	robot := msql.Params{}
+	rankParams, err := common.CheckRankParams(c, nil)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	robot := msql.Params{
+		`rrf_vector_weight`: cast.ToString(rankParams.VectorWeight),
+		`rrf_vector_k`:      cast.ToString(rankParams.VectorK),
+		`rrf_search_weight`: cast.ToString(rankParams.SearchWeight),
+		`rrf_search_k`:      cast.ToString(rankParams.SearchK),
+		`rrf_rerank_weight`: cast.ToString(rankParams.RerankWeight),
+		`rrf_rerank_k`:      cast.ToString(rankParams.RerankK),
+		`mmr_status`:        cast.ToString(rankParams.MmrStatus),
+		`mmr_lambda`:        cast.ToString(rankParams.MmrLambda),
+		`min_fused_score`:   cast.ToString(rankParams.MinFusedScore),
+		`graph_status`:      cast.ToString(rankParams.GraphStatus),
+		`rrf_graph_weight`:  cast.ToString(rankParams.GraphWeight),
+		`rrf_graph_k`:       cast.ToString(rankParams.GraphK),
+	}
 	if rerankModelConfigID > 0 {
 		robot[`rerank_status`] = cast.ToString(1)
 		robot[`rerank_model_config_id`] = cast.ToString(rerankModelConfigID)
 		robot[`robot_name`] = robotName
 	}
 
-	list, err := common.GetMatchLibraryParagraphList("", "", question, []string{}, cast.ToString(libraryId), size, similarity, searchType, robot)
-	c.String(http.StatusOK, lib_web.FmtJson(list, err))
+	//query expansion,multi question uses model_config_id and hyde uses hyde_model_config_id(default model_config_id)
+	expansionType := cast.ToInt(c.PostForm(`query_expansion_type`))
+	if expansionType == define.QueryExpansionNone {
+		list, err := common.GetMatchLibraryParagraphList("", "", question, nil, nil, cast.ToString(libraryId), size, similarity, searchType, robot)
+		c.String(http.StatusOK, lib_web.FmtJson(list, err))
+		return
+	}
+	if !tool.InArrayInt(expansionType, []int{define.QueryExpansionMulti, define.QueryExpansionHyde, define.QueryExpansionBoth}) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `query_expansion_type`))))
+		return
+	}
+	robot[`query_expansion_type`] = cast.ToString(expansionType)
+	robot[`model_config_id`] = cast.ToString(cast.ToInt(c.PostForm(`model_config_id`)))
+	robot[`use_model`] = strings.TrimSpace(c.PostForm(`use_model`))
+	robot[`hyde_model_config_id`] = cast.ToString(cast.ToInt(c.PostForm(`hyde_model_config_id`)))
+	robot[`hyde_use_model`] = strings.TrimSpace(c.PostForm(`hyde_use_model`))
+	if err = checkLlmModel(c, userId, cast.ToInt(robot[`model_config_id`]), robot[`use_model`], ``); err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	if cast.ToInt(robot[`hyde_model_config_id`]) > 0 {
+		if err = checkLlmModel(c, userId, cast.ToInt(robot[`hyde_model_config_id`]), robot[`hyde_use_model`], `hyde_`); err != nil {
+			c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+			return
+		}
+	}
+	param := &define.ChatRequestParam{ChatBaseParam: &define.ChatBaseParam{AdminUserId: userId, Robot: robot}, Question: question}
+	optimizedQuestions, hydeDrafts := common.ExpandQuery(param, nil)
+	list, err := common.GetMatchLibraryParagraphList("", "", question, optimizedQuestions, hydeDrafts, cast.ToString(libraryId), size, similarity, searchType, robot)
+	data := map[string]any{`list`: list, `optimized_questions`: optimizedQuestions, `hyde_drafts`: hydeDrafts}
+	c.String(http.StatusOK, lib_web.FmtJson(data, err))
 }
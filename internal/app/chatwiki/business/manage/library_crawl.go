@@ -0,0 +1,329 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+func getLibraryCrawl(userId, id int) (msql.Params, error) {
+	return msql.Model(`chat_ai_library_crawl`, define.Postgres).
+		Where(`id`, cast.ToString(id)).
+		Where(`admin_user_id`, cast.ToString(userId)).Find()
+}
+
+// getCrawlParams the seed and the scope of the crawl
+func getCrawlParams(c *gin.Context) (msql.Datas, error) {
+	seedType := cast.ToInt(c.DefaultPostForm(`seed_type`, cast.ToString(define.CrawlSeedUrl)))
+	seedUrl, err := common.NormalizeCrawlUrl(c.PostForm(`seed_url`))
+	domains := strings.ToLower(strings.Join(common.SplitCrawlList(c.PostForm(`domains`)), "\n"))
+	pathPrefixes := strings.Join(common.SplitCrawlList(c.PostForm(`path_prefixes`)), "\n")
+	maxDepth := cast.ToInt(c.DefaultPostForm(`max_depth`, `3`))
+	maxPages := cast.ToInt(c.DefaultPostForm(`max_pages`, `500`))
+	renewFrequency := cast.ToInt(c.DefaultPostForm(`renew_frequency`, `1`))
+	if seedType != define.CrawlSeedUrl && seedType != define.CrawlSeedSitemap {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `seed_type`))
+	}
+	if err != nil || len(seedUrl) > 500 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `seed_url`))
+	}
+	if len(domains) > 1000 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `domains`))
+	}
+	if len(pathPrefixes) > 1000 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `path_prefixes`))
+	}
+	if maxDepth < 0 || maxDepth > define.CrawlMaxDepth {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `crawl_max_depth_err`, define.CrawlMaxDepth))
+	}
+	if maxPages < 1 || maxPages > define.CrawlMaxPages {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `crawl_max_pages_err`, define.CrawlMaxPages))
+	}
+	if renewFrequency < 1 || renewFrequency > 5 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `renew_frequency`))
+	}
+	data := msql.Datas{
+		`seed_type`:       seedType,
+		`seed_url`:        seedUrl,
+		`domains`:         domains,
+		`path_prefixes`:   pathPrefixes,
+		`max_depth`:       maxDepth,
+		`max_pages`:       maxPages,
+		`renew_frequency`: renewFrequency,
+	}
+	//the seed url of the sitemap is not a page,so it is not required to be in scope
+	if seedType == define.CrawlSeedUrl && !common.InCrawlScope(msql.Params{`seed_url`: seedUrl, `domains`: domains, `path_prefixes`: pathPrefixes}, seedUrl) {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `crawl_scope_err`))
+	}
+	return data, nil
+}
+
+func GetLibraryCrawlList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.Query(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	list, err := msql.Model(`chat_ai_library_crawl`, define.Postgres).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Where(`library_id`, cast.ToString(libraryId)).Order(`id desc`).Select()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(list, nil))
+}
+
+// GetLibraryCrawlInfo the job and the pages of its current round,filtered by the page status
+func GetLibraryCrawlInfo(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.Query(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	info, err := getLibraryCrawl(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(info) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	m := msql.Model(`chat_ai_library_crawl_page`, define.Postgres).
+		Where(`crawl_id`, cast.ToString(id)).Where(`round`, info[`round`])
+	if status := c.Query(`status`); len(status) > 0 {
+		m.Where(`status`, cast.ToString(cast.ToInt(status)))
+	}
+	list, total, err := m.Order(`depth,id`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`info`: info, `list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
+
+// CreateLibraryCrawl crawl the site of the seed,every page is saved as a file of the library
+func CreateLibraryCrawl(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.PostForm(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	library, err := common.GetLibraryInfo(libraryId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(library) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	data, err := getCrawlParams(c)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	data[`admin_user_id`] = userId
+	data[`library_id`] = libraryId
+	data[`create_time`] = tool.Time2Int()
+	data[`update_time`] = tool.Time2Int()
+	id, err := msql.Model(`chat_ai_library_crawl`, define.Postgres).Insert(data, `id`)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if err = common.StartCrawlRound(int(id)); err != nil {
+		logs.Error(err.Error())
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`id`: id}, nil))
+}
+
+// CancelLibraryCrawl stop the running job after the page being crawled,it can be resumed later
+func CancelLibraryCrawl(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	info, err := getLibraryCrawl(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(info) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	if cast.ToInt(info[`status`]) != define.CrawlStatusRunning {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `status_exception`))))
+		return
+	}
+	_, err = msql.Model(`chat_ai_library_crawl`, define.Postgres).Where(`id`, cast.ToString(id)).
+		Update(msql.Datas{`status`: define.CrawlStatusCancelled, `update_time`: tool.Time2Int()})
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+// ResumeLibraryCrawl continue the pending pages of the cancelled or failed round
+func ResumeLibraryCrawl(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	info, err := getLibraryCrawl(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(info) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	if status := cast.ToInt(info[`status`]); status != define.CrawlStatusCancelled && status != define.CrawlStatusFailed {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `status_exception`))))
+		return
+	}
+	_, err = msql.Model(`chat_ai_library_crawl`, define.Postgres).Where(`id`, cast.ToString(id)).
+		Update(msql.Datas{`status`: define.CrawlStatusRunning, `errmsg`: ``, `update_time`: tool.Time2Int()})
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if err = common.AddCrawlJob(id); err != nil {
+		logs.Error(err.Error())
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+// RenewLibraryCrawl crawl the site again manually,the added and removed pages are detected
+func RenewLibraryCrawl(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	info, err := getLibraryCrawl(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(info) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	if cast.ToInt(info[`status`]) == define.CrawlStatusRunning {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `op_lock`))))
+		return
+	}
+	if err = common.StartCrawlRound(id); err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+// DeleteLibraryCrawl the files of the crawled pages are deleted with it
+func DeleteLibraryCrawl(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	info, err := getLibraryCrawl(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(info) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	if cast.ToInt(info[`status`]) == define.CrawlStatusRunning {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `op_lock`))))
+		return
+	}
+	fileIds, err := msql.Model(`chat_ai_library_file`, define.Postgres).Where(`crawl_id`, cast.ToString(id)).ColumnArr(`id`)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	for _, fileId := range fileIds {
+		if err = common.DeleteLibraryFile(cast.ToInt(fileId)); err != nil {
+			logs.Error(err.Error())
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+			return
+		}
+	}
+	if _, err = msql.Model(`chat_ai_library_crawl_page`, define.Postgres).Where(`crawl_id`, cast.ToString(id)).Delete(); err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if _, err = msql.Model(`chat_ai_library_crawl`, define.Postgres).Where(`id`, cast.ToString(id)).Delete(); err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
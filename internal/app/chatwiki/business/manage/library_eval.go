@@ -0,0 +1,436 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+const maxEvalConfigNum = 5
+
+var evalImportAllowExt = []string{`xlsx`, `csv`, `jsonl`}
+
+func getOwnEvalDataset(c *gin.Context, userId, datasetId int) (msql.Params, error) {
+	if datasetId <= 0 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))
+	}
+	info, err := msql.Model(`chat_ai_library_eval_dataset`, define.Postgres).
+		Where(`id`, cast.ToString(datasetId)).
+		Where(`admin_user_id`, cast.ToString(userId)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))
+	}
+	if len(info) == 0 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))
+	}
+	return info, nil
+}
+
+func GetEvalDatasetList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.Query(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	list, err := msql.Model(`chat_ai_library_eval_dataset`, define.Postgres).
+		Alias(`a`).
+		Join(`chat_ai_library_eval_question b`, `a.id=b.dataset_id`, `left`).
+		Where(`a.admin_user_id`, cast.ToString(userId)).
+		Where(`a.library_id`, cast.ToString(libraryId)).
+		Field(`a.*,count(b.id) as question_total`).
+		Group(`a.id`).Order(`a.id desc`).Select()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(list, nil))
+}
+
+func SaveEvalDataset(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	libraryId := cast.ToInt(c.PostForm(`library_id`))
+	name := strings.TrimSpace(c.PostForm(`name`))
+	if id < 0 || len(name) == 0 || utf8.RuneCountInString(name) > 100 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	m := msql.Model(`chat_ai_library_eval_dataset`, define.Postgres)
+	var err error
+	if id > 0 {
+		if _, err = getOwnEvalDataset(c, userId, id); err != nil {
+			c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+			return
+		}
+		_, err = m.Where(`id`, cast.ToString(id)).Update(msql.Datas{`name`: name, `update_time`: tool.Time2Int()})
+	} else {
+		var library msql.Params
+		if library, err = common.GetLibraryInfo(libraryId, userId); err != nil {
+			logs.Error(err.Error())
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+			return
+		}
+		if len(library) == 0 {
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+			return
+		}
+		var newId int64
+		newId, err = m.Insert(msql.Datas{
+			`admin_user_id`: userId,
+			`library_id`:    libraryId,
+			`name`:          name,
+			`create_time`:   tool.Time2Int(),
+			`update_time`:   tool.Time2Int(),
+		}, `id`)
+		id = int(newId)
+	}
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`id`: id}, nil))
+}
+
+func DeleteEvalDataset(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	info, err := getOwnEvalDataset(c, userId, cast.ToInt(c.PostForm(`id`)))
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	for _, table := range []string{`chat_ai_library_eval_question`, `chat_ai_library_eval_run`} {
+		if _, err = msql.Model(table, define.Postgres).Where(`dataset_id`, info[`id`]).Delete(); err != nil {
+			logs.Error(err.Error())
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+			return
+		}
+	}
+	if _, err = msql.Model(`chat_ai_library_eval_dataset`, define.Postgres).Where(`id`, info[`id`]).Delete(); err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+func GetEvalQuestionList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	info, err := getOwnEvalDataset(c, userId, cast.ToInt(c.Query(`dataset_id`)))
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	list, total, err := msql.Model(`chat_ai_library_eval_question`, define.Postgres).
+		Where(`dataset_id`, info[`id`]).Order(`id`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`info`: info, `list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
+
+// checkEvalQuestion expected_paragraph_ids or expected_answer is required,
+// the paragraph ids can also be separated by | or ; so that they fit in a csv cell
+func checkEvalQuestion(c *gin.Context, question, paragraphIds, answer string) (msql.Datas, error) {
+	paragraphIds = strings.NewReplacer(` `, ``, `|`, `,`, `;`, `,`).Replace(paragraphIds)
+	paragraphIds = strings.Trim(paragraphIds, `,`)
+	if len(question) == 0 || utf8.RuneCountInString(question) > 1000 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `question`))
+	}
+	if len(paragraphIds) == 0 && len(answer) == 0 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))
+	}
+	if len(paragraphIds) > 0 && (!common.CheckIds(paragraphIds) || len(paragraphIds) > 1000) {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `expected_paragraph_ids`))
+	}
+	if utf8.RuneCountInString(answer) > common.MaxContent {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `expected_answer`))
+	}
+	return msql.Datas{
+		`question`:               question,
+		`expected_paragraph_ids`: paragraphIds,
+		`expected_answer`:        answer,
+		`update_time`:            tool.Time2Int(),
+	}, nil
+}
+
+func SaveEvalQuestion(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	datasetId := cast.ToInt(c.PostForm(`dataset_id`))
+	m := msql.Model(`chat_ai_library_eval_question`, define.Postgres)
+	if id > 0 {
+		datasetIdStr, err := m.Where(`id`, cast.ToString(id)).Where(`admin_user_id`, cast.ToString(userId)).Value(`dataset_id`)
+		if err != nil {
+			logs.Error(err.Error())
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+			return
+		}
+		datasetId = cast.ToInt(datasetIdStr)
+	}
+	if _, err := getOwnEvalDataset(c, userId, datasetId); err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	data, err := checkEvalQuestion(c, strings.TrimSpace(c.PostForm(`question`)),
+		c.PostForm(`expected_paragraph_ids`), strings.TrimSpace(c.PostForm(`expected_answer`)))
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	if id > 0 {
+		_, err = m.Where(`id`, cast.ToString(id)).Update(data)
+	} else {
+		data[`admin_user_id`] = userId
+		data[`dataset_id`] = datasetId
+		data[`create_time`] = data[`update_time`]
+		_, err = m.Insert(data)
+	}
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+func DeleteEvalQuestion(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	_, err := msql.Model(`chat_ai_library_eval_question`, define.Postgres).
+		Where(`id`, cast.ToString(id)).Where(`admin_user_id`, cast.ToString(userId)).Delete()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+// readEvalImportFile the table file columns are question,expected paragraph ids,expected answer with a title row.
+// each line of the jsonl file is {"question":"","paragraph_ids":"1,2","answer":""}
+func readEvalImportFile(uploadInfo *define.UploadInfo) ([][3]string, error) {
+	rows := make([][3]string, 0)
+	if uploadInfo.Ext == `jsonl` {
+		content, err := tool.ReadFile(common.GetFileByLink(uploadInfo.Link))
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(content, "\n") {
+			if line = strings.TrimSpace(line); len(line) == 0 {
+				continue
+			}
+			item := make(map[string]any)
+			if err = tool.JsonDecode(line, &item); err != nil {
+				return nil, err
+			}
+			paragraphIds := cast.ToString(item[`paragraph_ids`])
+			if ids, ok := item[`paragraph_ids`].([]any); ok {
+				strIds := make([]string, 0, len(ids))
+				for _, id := range ids {
+					strIds = append(strIds, cast.ToString(id))
+				}
+				paragraphIds = strings.Join(strIds, `,`)
+			}
+			rows = append(rows, [3]string{cast.ToString(item[`question`]), paragraphIds, cast.ToString(item[`answer`])})
+		}
+		return rows, nil
+	}
+	tabRows, err := common.ParseTabFile(uploadInfo.Link, uploadInfo.Ext)
+	if err != nil {
+		return nil, err
+	}
+	for i, tabRow := range tabRows {
+		if i == 0 {
+			continue //title row
+		}
+		row := [3]string{}
+		for j := 0; j < len(row) && j < len(tabRow); j++ {
+			row[j] = tabRow[j]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func ImportEvalQuestion(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	info, err := getOwnEvalDataset(c, userId, cast.ToInt(c.PostForm(`dataset_id`)))
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	fileHeader, _ := c.FormFile(`file`)
+	uploadInfo, err := common.SaveUploadedFile(fileHeader, define.LibFileLimitSize, userId, `eval_dataset`, evalImportAllowExt)
+	if err != nil || uploadInfo == nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `upload_empty`))))
+		return
+	}
+	rows, err := readEvalImportFile(uploadInfo)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `file`))))
+		return
+	}
+	m := msql.Model(`chat_ai_library_eval_question`, define.Postgres)
+	var importTotal int
+	errs := make([]string, 0)
+	for i, row := range rows {
+		data, err := checkEvalQuestion(c, strings.TrimSpace(row[0]), row[1], strings.TrimSpace(row[2]))
+		if err != nil {
+			errs = append(errs, cast.ToString(i+1)+`:`+err.Error())
+			continue
+		}
+		data[`admin_user_id`] = userId
+		data[`dataset_id`] = info[`id`]
+		data[`create_time`] = data[`update_time`]
+		if _, err = m.Insert(data); err != nil {
+			logs.Error(err.Error())
+			errs = append(errs, cast.ToString(i+1)+`:`+i18n.Show(common.GetLang(c), `sys_err`))
+			continue
+		}
+		importTotal++
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`import_total`: importTotal, `errors`: errs}, nil))
+}
+
+func CreateEvalRun(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	info, err := getOwnEvalDataset(c, userId, cast.ToInt(c.PostForm(`dataset_id`)))
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	configs := make([]define.EvalConfig, 0)
+	if err = tool.JsonDecode(c.PostForm(`configs`), &configs); err != nil || len(configs) == 0 || len(configs) > maxEvalConfigNum {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `configs`))))
+		return
+	}
+	for i, config := range configs {
+		if config.Size <= 0 || config.Size > 100 || config.Similarity <= 0 || config.Similarity > 1 ||
+			!tool.InArrayInt(config.SearchType, []int{define.SearchTypeMixed, define.SearchTypeVector, define.SearchTypeFullText}) ||
+			(config.RerankModelConfigId > 0 && len(config.RerankUseModel) == 0) {
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `configs.`+cast.ToString(i)))))
+			return
+		}
+		if config.RerankModelConfigId > 0 {
+			modelConfig, err := common.GetModelConfigInfo(config.RerankModelConfigId, userId)
+			if err != nil || len(modelConfig) == 0 || !tool.InArrayString(common.Rerank, strings.Split(modelConfig[`model_types`], `,`)) {
+				c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `configs.`+cast.ToString(i)))))
+				return
+			}
+		}
+	}
+	configsJson, err := tool.JsonEncode(configs)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	id, err := msql.Model(`chat_ai_library_eval_run`, define.Postgres).Insert(msql.Datas{
+		`admin_user_id`: userId,
+		`library_id`:    info[`library_id`],
+		`dataset_id`:    info[`id`],
+		`configs`:       configsJson,
+		`status`:        define.EvalRunStatusRunning,
+		`create_time`:   tool.Time2Int(),
+		`update_time`:   tool.Time2Int(),
+	}, `id`)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	//async task:library eval
+	if message, err := tool.JsonEncode(map[string]any{`id`: id}); err != nil {
+		logs.Error(err.Error())
+	} else if err := common.AddJobs(define.LibraryEvalTopic, message); err != nil {
+		logs.Error(err.Error())
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`id`: id}, nil))
+}
+
+func GetEvalRunList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	info, err := getOwnEvalDataset(c, userId, cast.ToInt(c.Query(`dataset_id`)))
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	list, total, err := msql.Model(`chat_ai_library_eval_run`, define.Postgres).
+		Where(`dataset_id`, info[`id`]).Order(`id desc`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	formatedList := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		one := make(map[string]any)
+		for k, v := range item {
+			one[k] = v
+		}
+		var configs []define.EvalConfig
+		var results []define.EvalResult
+		_ = tool.JsonDecode(item[`configs`], &configs)
+		_ = tool.JsonDecode(item[`results`], &results)
+		one[`configs`], one[`results`] = configs, results
+		formatedList = append(formatedList, one)
+	}
+	data := map[string]any{`info`: info, `list`: formatedList, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
@@ -0,0 +1,126 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+)
+
+func GetLibraryGraphEntityList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.Query(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	m := msql.Model(`chat_ai_library_graph_entity`, define.Postgres).
+		Alias(`a`).
+		Join(`chat_ai_library_graph_community b`, `a.community_id=b.id`, `left`).
+		Where(`a.admin_user_id`, cast.ToString(userId)).
+		Where(`a.library_id`, cast.ToString(libraryId))
+	if keyword := strings.TrimSpace(c.Query(`keyword`)); len(keyword) > 0 {
+		m.Where(`a.name`, `like`, keyword)
+	}
+	list, total, err := m.Field(`a.*,COALESCE(b.summary,'') as community_summary`).
+		Field(`(select count(1) from chat_ai_library_graph_mention where entity_id=a.id) as mention_total`).
+		Order(`a.id desc`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
+
+func GetLibraryGraphRelationList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	entityId := cast.ToInt(c.Query(`entity_id`))
+	if entityId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	entity, err := msql.Model(`chat_ai_library_graph_entity`, define.Postgres).
+		Where(`id`, cast.ToString(entityId)).Where(`admin_user_id`, cast.ToString(userId)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(entity) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	list, err := msql.Model(`chat_ai_library_graph_relation`, define.Postgres).
+		Alias(`a`).
+		Join(`chat_ai_library_graph_entity b`, `a.source_id=b.id`, `left`).
+		Join(`chat_ai_library_graph_entity c`, `a.target_id=c.id`, `left`).
+		Where(`(a.source_id=` + entity[`id`] + ` or a.target_id=` + entity[`id`] + `)`).
+		Field(`a.*,b.name as source_name,c.name as target_name`).
+		Order(`a.id`).Limit(500).Select()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`info`: entity, `list`: list}, nil))
+}
+
+// RebuildLibraryGraph extract all the paragraphs again,e.g. after the graph is enabled for a learned library
+func RebuildLibraryGraph(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.PostForm(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	library, err := common.GetLibraryInfo(libraryId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(library) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	if !common.IsGraphLibrary(library) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `graph_off`))))
+		return
+	}
+	ids, err := msql.Model(`chat_ai_library_file_data`, define.Postgres).
+		Where(`library_id`, cast.ToString(libraryId)).ColumnArr(`id`)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	dataIds := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		dataIds = append(dataIds, cast.ToInt64(id))
+	}
+	common.AddGraphExtractJobs(library, dataIds, true)
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`total`: len(dataIds)}, nil))
+}
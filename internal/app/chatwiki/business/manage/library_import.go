@@ -0,0 +1,144 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"archive/zip"
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+func ImportLibraryZip(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.PostForm(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	library, err := common.GetLibraryInfo(libraryId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(library) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	fileHeader, _ := c.FormFile(`zip_file`)
+	if fileHeader == nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `upload_empty`))))
+		return
+	}
+	uploadInfo, err := common.SaveUploadedFile(fileHeader, define.LibZipLimitSize, userId, `library_zip`, []string{`zip`})
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `zip_file`))))
+		return
+	}
+	//check the archive before the async task
+	reader, err := zip.OpenReader(common.GetFileByLink(uploadInfo.Link))
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `zip_file`))))
+		return
+	}
+	_ = reader.Close()
+	id, err := msql.Model(`chat_ai_library_import`, define.Postgres).Insert(msql.Datas{
+		`admin_user_id`: userId,
+		`library_id`:    libraryId,
+		`zip_name`:      common.MbSubstr(uploadInfo.Name, 0, 100),
+		`zip_url`:       uploadInfo.Link,
+		`status`:        define.ImportStatusRunning,
+		`create_time`:   tool.Time2Int(),
+		`update_time`:   tool.Time2Int(),
+	}, `id`)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	//async task:library import
+	if message, err := tool.JsonEncode(map[string]any{`id`: id}); err != nil {
+		logs.Error(err.Error())
+	} else if err := common.AddJobs(define.LibraryImportTopic, message); err != nil {
+		logs.Error(err.Error())
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`id`: id}, nil))
+}
+
+func GetLibraryImportList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.Query(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	list, total, err := msql.Model(`chat_ai_library_import`, define.Postgres).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Where(`library_id`, cast.ToString(libraryId)).
+		Order(`id desc`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
+
+// GetLibraryImportInfo the import job and the status of its files,filtered by the file status
+func GetLibraryImportInfo(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.Query(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	info, err := msql.Model(`chat_ai_library_import`, define.Postgres).
+		Where(`id`, cast.ToString(id)).
+		Where(`admin_user_id`, cast.ToString(userId)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(info) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	m := msql.Model(`chat_ai_library_import_file`, define.Postgres).Where(`import_id`, cast.ToString(id))
+	if status := cast.ToInt(c.Query(`status`)); status > 0 {
+		m.Where(`status`, cast.ToString(status))
+	}
+	list, total, err := m.Order(`id`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`info`: info, `list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
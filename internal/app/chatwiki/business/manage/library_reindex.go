@@ -0,0 +1,206 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+func StartLibraryReindex(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.PostForm(`library_id`))
+	modelConfigId := cast.ToInt(c.PostForm(`model_config_id`))
+	useModel := strings.TrimSpace(c.PostForm(`use_model`))
+	if libraryId <= 0 || modelConfigId <= 0 || len(useModel) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	library, err := common.GetLibraryInfo(libraryId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(library) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	//check model_config_id and use_model
+	config, err := common.GetModelConfigInfo(modelConfigId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(config) == 0 || !tool.InArrayString(common.TextEmbedding, strings.Split(config[`model_types`], `,`)) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `model_config_id`))))
+		return
+	}
+	modelInfo, _ := common.GetModelInfoByDefine(config[`model_define`])
+	if !tool.InArrayString(useModel, modelInfo.VectorModelList) && !common.IsMultiConfModel(config["model_define"]) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `use_model`))))
+		return
+	}
+	if cast.ToInt(library[`model_config_id`]) == modelConfigId && library[`use_model`] == useModel {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `use_model`))))
+		return
+	}
+	running, err := common.GetRunningReindex(libraryId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if cast.ToInt(running[`status`]) == define.ReindexStatusRunning {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `reindex_running`))))
+		return
+	}
+	if cast.ToInt(running[`status`]) == define.ReindexStatusSwitched {
+		//the previous switch is confirmed,release the vectors kept for rollback
+		_, err = msql.Model(`chat_ai_library_reindex`, define.Postgres).Where(`id`, running[`id`]).
+			Update(msql.Datas{`status`: define.ReindexStatusFinished, `update_time`: tool.Time2Int()})
+		if err != nil {
+			logs.Error(err.Error())
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+			return
+		}
+	}
+	if err = common.ClearReindexShadow(libraryId); err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	id, err := msql.Model(`chat_ai_library_reindex`, define.Postgres).Insert(msql.Datas{
+		`admin_user_id`:       userId,
+		`library_id`:          libraryId,
+		`old_model_config_id`: library[`model_config_id`],
+		`old_use_model`:       library[`use_model`],
+		`new_model_config_id`: modelConfigId,
+		`new_use_model`:       useModel,
+		`status`:              define.ReindexStatusRunning,
+		`create_time`:         tool.Time2Int(),
+		`update_time`:         tool.Time2Int(),
+	}, `id`)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if _, err = common.UpdateReindexProgress(msql.Params{`id`: cast.ToString(id), `library_id`: cast.ToString(libraryId)}); err != nil {
+		logs.Error(err.Error())
+	}
+	//async task:library reindex
+	if message, err := tool.JsonEncode(map[string]any{`id`: id}); err != nil {
+		logs.Error(err.Error())
+	} else if err := common.AddJobs(define.LibraryReindexTopic, message); err != nil {
+		logs.Error(err.Error())
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`id`: id}, nil))
+}
+
+func GetLibraryReindexInfo(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.Query(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	info, err := msql.Model(`chat_ai_library_reindex`, define.Postgres).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Where(`library_id`, cast.ToString(libraryId)).
+		Order(`id desc`).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(info, nil))
+}
+
+func getOwnReindex(c *gin.Context, userId int) (msql.Params, error) {
+	id := cast.ToInt(c.PostForm(`id`))
+	if id <= 0 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))
+	}
+	info, err := msql.Model(`chat_ai_library_reindex`, define.Postgres).
+		Where(`id`, cast.ToString(id)).
+		Where(`admin_user_id`, cast.ToString(userId)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))
+	}
+	if len(info) == 0 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))
+	}
+	return info, nil
+}
+
+func CancelLibraryReindex(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	info, err := getOwnReindex(c, userId)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	if cast.ToInt(info[`status`]) != define.ReindexStatusRunning {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `status_exception`))))
+		return
+	}
+	_, err = msql.Model(`chat_ai_library_reindex`, define.Postgres).
+		Where(`id`, info[`id`]).
+		Where(`status`, cast.ToString(define.ReindexStatusRunning)).
+		Update(msql.Datas{`status`: define.ReindexStatusCancelled, `update_time`: tool.Time2Int()})
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	//the old vectors keep serving,only the shadow vectors are discarded
+	if err = common.ClearReindexShadow(cast.ToInt(info[`library_id`])); err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+func RollbackLibraryReindex(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	info, err := getOwnReindex(c, userId)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	if cast.ToInt(info[`status`]) != define.ReindexStatusSwitched {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `status_exception`))))
+		return
+	}
+	if err = common.RollbackReindex(info); err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
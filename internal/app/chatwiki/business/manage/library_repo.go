@@ -0,0 +1,264 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+func getLibraryRepo(userId, id int) (msql.Params, error) {
+	return msql.Model(`chat_ai_library_repo`, define.Postgres).
+		Where(`id`, cast.ToString(id)).
+		Where(`admin_user_id`, cast.ToString(userId)).Find()
+}
+
+func isRepoSyncing(repo msql.Params) bool {
+	return cast.ToInt(repo[`status`]) == define.RepoStatusSyncing && cast.ToInt(repo[`update_time`]) > tool.Time2Int()-define.RepoSyncTimeout
+}
+
+// getRepoParams the source of the repository,the unchanged fields are taken from info when editing
+func getRepoParams(c *gin.Context, info msql.Params) (msql.Datas, error) {
+	if len(info) == 0 {
+		info = msql.Params{`source_type`: cast.ToString(define.RepoSourceGit), `sync_interval`: `60`}
+	}
+	sourceType := cast.ToInt(c.DefaultPostForm(`source_type`, info[`source_type`]))
+	sourceUrl := strings.TrimSpace(c.DefaultPostForm(`source_url`, info[`source_url`]))
+	branch := strings.TrimSpace(c.DefaultPostForm(`branch`, info[`branch`]))
+	includeGlobs := strings.TrimSpace(c.DefaultPostForm(`include_globs`, info[`include_globs`]))
+	excludeGlobs := strings.TrimSpace(c.DefaultPostForm(`exclude_globs`, info[`exclude_globs`]))
+	syncInterval := cast.ToInt(c.DefaultPostForm(`sync_interval`, info[`sync_interval`]))
+	if sourceType != define.RepoSourceGit && sourceType != define.RepoSourceDir {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `source_type`))
+	}
+	if len(sourceUrl) > 500 || !common.CheckRepoSource(sourceType, sourceUrl) {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `repo_source_err`))
+	}
+	if sourceType == define.RepoSourceDir {
+		branch = ``
+	}
+	if len(branch) > 100 || strings.HasPrefix(branch, `-`) {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `branch`))
+	}
+	if len(includeGlobs) > 1000 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `include_globs`))
+	}
+	if len(excludeGlobs) > 1000 {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `exclude_globs`))
+	}
+	if syncInterval != 0 && syncInterval < define.RepoSyncIntervalMin {
+		return nil, errors.New(i18n.Show(common.GetLang(c), `repo_sync_interval_err`, define.RepoSyncIntervalMin))
+	}
+	return msql.Datas{
+		`source_type`:   sourceType,
+		`source_url`:    sourceUrl,
+		`branch`:        branch,
+		`include_globs`: strings.Join(common.SplitRepoGlobs(includeGlobs), "\n"),
+		`exclude_globs`: strings.Join(common.SplitRepoGlobs(excludeGlobs), "\n"),
+		`sync_interval`: syncInterval,
+	}, nil
+}
+
+func GetLibraryRepoList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.Query(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	list, err := msql.Model(`chat_ai_library_repo`, define.Postgres).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Where(`library_id`, cast.ToString(libraryId)).Order(`id desc`).Select()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(list, nil))
+}
+
+// CreateLibraryRepo add a git repository or a local directory as the source of the library,it is synced at once
+func CreateLibraryRepo(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.PostForm(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	library, err := common.GetLibraryInfo(libraryId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(library) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	data, err := getRepoParams(c, nil)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	data[`admin_user_id`] = userId
+	data[`library_id`] = libraryId
+	data[`create_time`] = tool.Time2Int()
+	data[`update_time`] = tool.Time2Int()
+	id, err := msql.Model(`chat_ai_library_repo`, define.Postgres).Insert(data, `id`)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if err = common.AddRepoSyncJob(int(id)); err != nil {
+		logs.Error(err.Error())
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`id`: id}, nil))
+}
+
+func EditLibraryRepo(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	repo, err := getLibraryRepo(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(repo) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	if isRepoSyncing(repo) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `op_lock`))))
+		return
+	}
+	data, err := getRepoParams(c, repo)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	data[`update_time`] = tool.Time2Int()
+	if _, err = msql.Model(`chat_ai_library_repo`, define.Postgres).Where(`id`, cast.ToString(id)).Update(data); err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	//the working copy of another remote or branch is cloned again
+	if cast.ToString(data[`source_url`]) != repo[`source_url`] || cast.ToString(data[`branch`]) != repo[`branch`] {
+		if err = os.RemoveAll(common.GetRepoWorkDir(id)); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	if err = common.AddRepoSyncJob(id); err != nil {
+		logs.Error(err.Error())
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+// StartLibraryRepoSync sync the source manually
+func StartLibraryRepoSync(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	repo, err := getLibraryRepo(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(repo) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	if isRepoSyncing(repo) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `op_lock`))))
+		return
+	}
+	if err = common.AddRepoSyncJob(id); err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+// DeleteLibraryRepo the files synced from the source are deleted with it
+func DeleteLibraryRepo(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	repo, err := getLibraryRepo(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(repo) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	if isRepoSyncing(repo) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `op_lock`))))
+		return
+	}
+	fileIds, err := msql.Model(`chat_ai_library_file`, define.Postgres).Where(`repo_id`, cast.ToString(id)).ColumnArr(`id`)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	for _, fileId := range fileIds {
+		if err = common.DeleteLibraryFile(cast.ToInt(fileId)); err != nil {
+			logs.Error(err.Error())
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+			return
+		}
+	}
+	if _, err = msql.Model(`chat_ai_library_repo`, define.Postgres).Where(`id`, cast.ToString(id)).Delete(); err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if err = os.RemoveAll(common.GetRepoWorkDir(id)); err != nil {
+		logs.Error(err.Error())
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
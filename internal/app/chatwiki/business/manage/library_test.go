@@ -0,0 +1,59 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/pkg/lib_stub"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cast"
+)
+
+// stubRetrievalResponder a graph library of the user,the parser splits the question by the spaces
+func stubRetrievalResponder(query string, args []any) []map[string]string {
+	switch {
+	case lib_stub.TableIs(query, `chat_ai_library`):
+		return []map[string]string{{`id`: `1`, `admin_user_id`: `1`, `graph_status`: `1`, `graph_model_config_id`: `1`}}
+	case strings.Contains(query, `ts_parse('zhparser',$1)`):
+		rows := make([]map[string]string, 0)
+		for _, token := range strings.Fields(cast.ToString(args[0])) {
+			rows = append(rows, map[string]string{`token`: token})
+		}
+		return rows
+	}
+	return nil
+}
+
+func TestLibraryRecallTestBindsQuestion(t *testing.T) {
+	server, db, token := newStubServer(t, http.MethodPost, `/manage/libraryRecallTest`, LibraryRecallTest, stubRetrievalResponder)
+	for _, question := range hostileInputs {
+		db.Reset(stubRetrievalResponder)
+		form := url.Values{`id`: {`1`}, `question`: {question}, `size`: {`5`}, `similarity`: {`0.5`},
+			`search_type`: {cast.ToString(define.SearchTypeFullText)}, `graph_status`: {`1`}}
+		req, err := http.NewRequest(http.MethodPost, server.URL+`/manage/libraryRecallTest`, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(`Content-Type`, `application/x-www-form-urlencoded`)
+		req.Header.Set(`token`, token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		queries := db.Queries()
+		checkBoundInput(t, queries, `ts_parse`, question)
+		if name := common.NormalizeGraphName(question); len(name) > 0 {
+			checkBoundInput(t, queries, `chat_ai_library_graph_alias`, name)
+		}
+		//the ts query built from the tokens is bound to the full text match
+		if tsQuery := common.BuildTsQuery(strings.Fields(question)); len(tsQuery) > 0 {
+			checkBoundInput(t, queries, `to_tsquery`, tsQuery)
+		}
+	}
+}
@@ -183,6 +183,7 @@ func DelModelConfig(c *gin.Context) {
 	}
 	//clear cached data
 	lib_redis.DelCacheData(define.Redis, &common.ModelConfigCacheBuildHandler{ModelConfigId: id})
+	common.DeleteEmbeddingCache(id)
 	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
 }
 
@@ -248,6 +249,7 @@ func EditModelConfig(c *gin.Context) {
 
 	//clear cached data
 	lib_redis.DelCacheData(define.Redis, &common.ModelConfigCacheBuildHandler{ModelConfigId: id})
+	common.DeleteEmbeddingCache(id)
 
 	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
 }
@@ -9,6 +9,7 @@ import (
 	"chatwiki/internal/pkg/lib_web"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"unicode/utf8"
@@ -60,6 +61,7 @@ func GetParagraphList(c *gin.Context) {
     			'no error'
   			) AS errmsg
 		`).
+		Field(fmt.Sprintf(`COALESCE(json_agg(b.content ORDER BY b.id) FILTER (WHERE b.type=%d),'[]') AS synthetic_questions`, define.VectorTypeCustom)).
 		Group(`a.id`).
 		Order(`number asc,id desc`).
 		Paginate(page, size)
@@ -82,6 +84,9 @@ func GetParagraphList(c *gin.Context) {
 			continue
 		}
 		tempItem[`images`] = images
+		var syntheticQuestions []string
+		_ = json.Unmarshal([]byte(item[`synthetic_questions`]), &syntheticQuestions)
+		tempItem[`synthetic_questions`] = syntheticQuestions
 		formatedList = append(formatedList, tempItem)
 	}
 
@@ -228,15 +233,19 @@ func SaveParagraph(c *gin.Context) {
 			_ = m.Rollback()
 			return
 		}
-		vectorID, err := common.SaveVector(int64(userId), cast.ToInt64(fileInfo[`library_id`]),
-			fileId, id, cast.ToString(define.VectorTypeParagraph), content)
+		//keep the chunk mode the file was learned with
+		embedTitle := ``
+		if cast.ToInt(fileInfo[`split_mode`]) == define.SplitModeStructure {
+			embedTitle = title
+		}
+		ids, err := common.SaveParagraphVector(fileInfo, int64(userId), cast.ToInt64(fileInfo[`library_id`]), fileId, id, embedTitle, content)
 		if err != nil {
 			logs.Error(err.Error())
 			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
 			_ = m.Rollback()
 			return
 		}
-		vectorIds = append(vectorIds, vectorID)
+		vectorIds = append(vectorIds, ids...)
 	}
 	err = m.Commit()
 	if err != nil {
@@ -253,6 +262,15 @@ func SaveParagraph(c *gin.Context) {
 			logs.Error(err.Error())
 		}
 	}
+	//async task:synthetic question and graph extract,redone when the content changes
+	if library, err := common.GetLibraryInfo(cast.ToInt(fileInfo[`library_id`]), userId); err != nil {
+		logs.Error(err.Error())
+	} else {
+		if cast.ToInt(fileInfo[`is_qa_doc`]) != define.DocTypeQa {
+			common.AddSyntheticQuestionJobs(library, []int64{id}, false)
+		}
+		common.AddGraphExtractJobs(library, []int64{id}, false)
+	}
 
 	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
 }
@@ -280,6 +298,75 @@ func DeleteParagraph(c *gin.Context) {
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
 		return
 	}
+	if err = common.DeleteParagraphGraph(`data_id`, cast.ToString(id)); err != nil {
+		logs.Error(err.Error())
+	}
+
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+func getOwnNormalParagraph(c *gin.Context, userId int) (msql.Params, msql.Params, error) {
+	id := cast.ToInt(c.PostForm(`data_id`))
+	if id <= 0 {
+		return nil, nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))
+	}
+	paragraph, err := msql.Model(`chat_ai_library_file_data`, define.Postgres).
+		Where(`id`, cast.ToString(id)).Where(`admin_user_id`, cast.ToString(userId)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil, nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))
+	}
+	if len(paragraph) == 0 {
+		return nil, nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))
+	}
+	if cast.ToInt(paragraph[`type`]) != define.ParagraphTypeNormal {
+		return nil, nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `data_id`))
+	}
+	library, err := common.GetLibraryInfo(cast.ToInt(paragraph[`library_id`]), userId)
+	if err != nil {
+		logs.Error(err.Error())
+		return nil, nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))
+	}
+	if len(library) == 0 {
+		return nil, nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))
+	}
+	return paragraph, library, nil
+}
+
+func SaveSyntheticQuestions(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	paragraph, _, err := getOwnNormalParagraph(c, userId)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	questions := common.CheckSyntheticQuestions(c.PostFormArray(`questions`), define.SyntheticQuestionNumMax)
+	//the edited questions are kept until the paragraph content changes
+	if err = common.SaveSyntheticQuestions(paragraph, questions, common.GetSyntheticHash(paragraph[`content`])); err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
 
+func RegenerateSyntheticQuestions(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	paragraph, library, err := getOwnNormalParagraph(c, userId)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	if !common.IsSyntheticQuestionLibrary(library) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `synthetic_question_off`))))
+		return
+	}
+	common.AddSyntheticQuestionJobs(library, []int64{cast.ToInt64(paragraph[`id`])}, true)
 	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
 }
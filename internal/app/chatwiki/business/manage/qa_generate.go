@@ -0,0 +1,269 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_redis"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+func getQaGenerate(userId, id int) (msql.Params, error) {
+	return msql.Model(`chat_ai_library_qa_generate`, define.Postgres).
+		Where(`id`, cast.ToString(id)).
+		Where(`admin_user_id`, cast.ToString(userId)).Find()
+}
+
+// CreateQaGenerate generate the candidate question and answer pairs from the paragraphs of a normal document
+func CreateQaGenerate(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	fileId := cast.ToInt(c.PostForm(`file_id`))
+	modelConfigId := cast.ToInt(c.PostForm(`model_config_id`))
+	useModel := strings.TrimSpace(c.PostForm(`use_model`))
+	pairNum := cast.ToInt(c.DefaultPostForm(`pair_num`, `3`))
+	if fileId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	if pairNum < define.QaGeneratePairNumMin || pairNum > define.QaGeneratePairNumMax {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `pair_num`))))
+		return
+	}
+	if err := checkLlmModel(c, userId, modelConfigId, useModel, ``); err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	info, err := common.GetLibFileInfo(fileId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(info) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	if cast.ToInt(info[`is_qa_doc`]) == define.DocTypeQa ||
+		!tool.InArrayInt(cast.ToInt(info[`status`]), []int{define.FileStatusLearned, define.FileStatusLearnedWithErrors}) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `status_exception`))))
+		return
+	}
+	id, err := msql.Model(`chat_ai_library_qa_generate`, define.Postgres).Insert(msql.Datas{
+		`admin_user_id`:   userId,
+		`library_id`:      info[`library_id`],
+		`file_id`:         fileId,
+		`model_config_id`: modelConfigId,
+		`use_model`:       useModel,
+		`pair_num`:        pairNum,
+		`status`:          define.QaGenerateStatusRunning,
+		`create_time`:     tool.Time2Int(),
+		`update_time`:     tool.Time2Int(),
+	}, `id`)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	//async task:qa generate
+	if message, err := tool.JsonEncode(map[string]any{`id`: id}); err != nil {
+		logs.Error(err.Error())
+	} else if err := common.AddJobs(define.QaGenerateTopic, message); err != nil {
+		logs.Error(err.Error())
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`id`: id}, nil))
+}
+
+func GetQaGenerateList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.Query(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	m := msql.Model(`chat_ai_library_qa_generate`, define.Postgres).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Where(`library_id`, cast.ToString(libraryId))
+	if fileId := cast.ToInt(c.Query(`file_id`)); fileId > 0 {
+		m.Where(`file_id`, cast.ToString(fileId))
+	}
+	list, total, err := m.Order(`id desc`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
+
+// GetQaGenerateInfo the job and its candidates,filtered by the candidate status
+func GetQaGenerateInfo(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.Query(`id`))
+	if id <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	info, err := getQaGenerate(userId, id)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(info) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	m := msql.Model(`chat_ai_library_qa_candidate`, define.Postgres).Where(`generate_id`, cast.ToString(id))
+	if status := c.Query(`status`); len(status) > 0 {
+		m.Where(`status`, cast.ToString(cast.ToInt(status)))
+	}
+	list, total, err := m.Order(`number,id`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`info`: info, `list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
+
+// EditQaCandidate the reviewer can correct a candidate before it is saved
+func EditQaCandidate(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	id := cast.ToInt(c.PostForm(`id`))
+	question, answer := strings.TrimSpace(c.PostForm(`question`)), strings.TrimSpace(c.PostForm(`answer`))
+	if id <= 0 || len(question) == 0 || len(answer) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	if utf8.RuneCountInString(question) > common.MaxContent || utf8.RuneCountInString(answer) > common.MaxContent {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `length_error`))))
+		return
+	}
+	affected, err := msql.Model(`chat_ai_library_qa_candidate`, define.Postgres).
+		Where(`id`, cast.ToString(id)).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Update(msql.Datas{`question`: question, `answer`: answer, `update_time`: tool.Time2Int()})
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if affected == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(nil, nil))
+}
+
+// ReviewQaCandidates accept or reject the candidates in bulk,all the pending ones of the job when ids is empty
+func ReviewQaCandidates(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	generateId, ids, status := cast.ToInt(c.PostForm(`generate_id`)), c.PostForm(`ids`), cast.ToInt(c.PostForm(`status`))
+	if generateId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	if len(ids) > 0 && !common.CheckIds(ids) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `ids`))))
+		return
+	}
+	if status != define.QaCandidateStatusAccepted && status != define.QaCandidateStatusRejected {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `status`))))
+		return
+	}
+	m := msql.Model(`chat_ai_library_qa_candidate`, define.Postgres).
+		Where(`generate_id`, cast.ToString(generateId)).
+		Where(`admin_user_id`, cast.ToString(userId))
+	if len(ids) > 0 {
+		m.Where(`id`, `in`, ids)
+	} else {
+		m.Where(`status`, cast.ToString(define.QaCandidateStatusPending))
+	}
+	affected, err := m.Update(msql.Datas{`status`: status, `update_time`: tool.Time2Int()})
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`total`: affected}, nil))
+}
+
+// SaveQaCandidates save the accepted candidates as a qa document of the library,the library of the source document by default
+func SaveQaCandidates(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	generateId := cast.ToInt(c.PostForm(`generate_id`))
+	if generateId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	job, err := getQaGenerate(userId, generateId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(job) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `no_data`))))
+		return
+	}
+	libraryId := cast.ToInt(c.DefaultPostForm(`library_id`, job[`library_id`]))
+	library, err := common.GetLibraryInfo(libraryId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	if len(library) == 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `library_id`))))
+		return
+	}
+	lockKey := define.LockPreKey + `SaveQaCandidates` + cast.ToString(generateId)
+	if !lib_redis.AddLock(define.Redis, lockKey, time.Minute*5) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `op_lock`))))
+		return
+	}
+	defer lib_redis.UnLock(define.Redis, lockKey)
+	qaFileId, err := common.SaveQaCandidates(userId, libraryId, job, common.GetLang(c))
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`file_id`: qaFileId}, nil))
+}
@@ -180,6 +180,55 @@ func SaveRobot(c *gin.Context) {
 			return
 		}
 	}
+	//check rank params
+	robotInfo := msql.Params{}
+	if len(robotKey) > 0 {
+		if robotInfo, err = common.GetRobotInfo(robotKey); err != nil {
+			logs.Error(err.Error())
+			c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+			return
+		}
+	}
+	rankParams, err := common.CheckRankParams(c, robotInfo)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	routeParams, err := common.CheckLibraryRouteParams(c, robotInfo)
+	if err != nil {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+		return
+	}
+	//query expansion,the question optimize switch is kept in sync for the old clients
+	queryExpansionType := common.GetQueryExpansionType(robotInfo)
+	if expansionType, ok := c.GetPostForm(`query_expansion_type`); ok {
+		queryExpansionType = cast.ToInt(expansionType)
+	} else {
+		hasHyde := queryExpansionType == define.QueryExpansionHyde || queryExpansionType == define.QueryExpansionBoth
+		switch {
+		case enableQuestionOptimize && hasHyde:
+			queryExpansionType = define.QueryExpansionBoth
+		case enableQuestionOptimize:
+			queryExpansionType = define.QueryExpansionMulti
+		case hasHyde:
+			queryExpansionType = define.QueryExpansionHyde
+		default:
+			queryExpansionType = define.QueryExpansionNone
+		}
+	}
+	if !tool.InArrayInt(queryExpansionType, []int{define.QueryExpansionNone, define.QueryExpansionMulti, define.QueryExpansionHyde, define.QueryExpansionBoth}) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `query_expansion_type`))))
+		return
+	}
+	enableQuestionOptimize = queryExpansionType == define.QueryExpansionMulti || queryExpansionType == define.QueryExpansionBoth
+	hydeModelConfigId := cast.ToInt(c.DefaultPostForm(`hyde_model_config_id`, robotInfo[`hyde_model_config_id`]))
+	hydeUseModel := strings.TrimSpace(c.DefaultPostForm(`hyde_use_model`, robotInfo[`hyde_use_model`]))
+	if hydeModelConfigId > 0 {
+		if err = checkLlmModel(c, userId, hydeModelConfigId, hydeUseModel, `hyde_`); err != nil {
+			c.String(http.StatusOK, lib_web.FmtJson(nil, err))
+			return
+		}
+	}
 	//format check
 	welcomes, err = common.CheckMenuJson(welcomes)
 	if err != nil {
@@ -330,6 +379,24 @@ func SaveRobot(c *gin.Context) {
 		`enable_question_guide`:    enableQuestionGuide,
 		`enable_common_question`:   enableCommonQuestion,
 		`common_question_list`:     commonQuestionList,
+		`rrf_vector_weight`:        rankParams.VectorWeight,
+		`rrf_vector_k`:             rankParams.VectorK,
+		`rrf_search_weight`:        rankParams.SearchWeight,
+		`rrf_search_k`:             rankParams.SearchK,
+		`rrf_rerank_weight`:        rankParams.RerankWeight,
+		`rrf_rerank_k`:             rankParams.RerankK,
+		`mmr_status`:               rankParams.MmrStatus,
+		`mmr_lambda`:               rankParams.MmrLambda,
+		`min_fused_score`:          rankParams.MinFusedScore,
+		`graph_status`:             rankParams.GraphStatus,
+		`rrf_graph_weight`:         rankParams.GraphWeight,
+		`rrf_graph_k`:              rankParams.GraphK,
+		`library_route_type`:       routeParams.RouteType,
+		`library_route_top_n`:      routeParams.TopN,
+		`library_route_threshold`:  routeParams.Threshold,
+		`query_expansion_type`:     queryExpansionType,
+		`hyde_model_config_id`:     hydeModelConfigId,
+		`hyde_use_model`:           hydeUseModel,
 		`update_time`:              tool.Time2Int(),
 	}
 	if len(robotAvatar) > 0 {
@@ -8,7 +8,6 @@ import (
 	"chatwiki/internal/app/chatwiki/i18n"
 	"chatwiki/internal/pkg/lib_web"
 	"errors"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cast"
 	"github.com/syyongx/php2go"
@@ -80,6 +79,19 @@ func StatToken(c *gin.Context) {
 	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
 }
 
+// buildStatAnalyseQuery the dates and the channel are bound as parameters
+func buildStatAnalyseQuery(userId, robotId, _type int, startDate, endDate, channel string) (string, []any) {
+	args := []any{_type, startDate, endDate, userId, robotId}
+	condition := `date_series.date=ds.date AND admin_user_id=$4 AND robot_id=$5 AND type=$1::int AND ds.date>=$2::date AND ds.date<=$3::date`
+	if len(channel) > 0 {
+		args = append(args, channel)
+		condition += ` AND app_type=$6`
+	}
+	return `SELECT to_char(date_series.date,'YYYY-MM-DD') AS date,COALESCE(sum(amount),0) as amount,$1::int as type ` +
+		`FROM generate_series($2::date,$3::date,'1 day') AS date_series(date) ` +
+		`LEFT JOIN llm_request_daily_stats ds ON ` + condition + ` GROUP BY date_series.date ORDER BY date asc`, args
+}
+
 func StatAnalyse(c *gin.Context) {
 	var userId int
 	if userId = GetAdminUserId(c); userId == 0 {
@@ -107,18 +119,8 @@ func StatAnalyse(c *gin.Context) {
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `end_date`))))
 		return
 	}
-	condition := fmt.Sprintf(`date_series.date = ds.date and admin_user_id = %d and robot_id = %d and type = %d and ds.date >= '%s' and ds.date <= '%s'`, userId, robotId, _type, startDate, endDate)
-	channel := strings.TrimSpace(c.Query(`channel`))
-	if len(channel) > 0 {
-		condition = condition + fmt.Sprintf(`and app_type = '%s'`, channel)
-	}
-	m := msql.Model(fmt.Sprintf(`generate_series('%s'::date, '%s'::date, '1 day') AS date_series(date)`, startDate, endDate), define.Postgres).
-		Join(`llm_request_daily_stats ds`, condition, `left`).
-		Group(`date_series.date`).
-		Order(`date asc`).
-		Field(fmt.Sprintf(`to_char(date_series.date, 'YYYY-MM-DD') AS date,COALESCE(sum(amount), 0) as amount,%d as type`, _type))
-
-	result, err := m.Select()
+	query, args := buildStatAnalyseQuery(userId, robotId, _type, startDate, endDate, strings.TrimSpace(c.Query(`channel`)))
+	result, err := msql.RawValues(define.Postgres, query, nil, args...)
 	if err != nil {
 		logs.Error(err.Error())
 		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
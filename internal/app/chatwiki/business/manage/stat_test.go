@@ -0,0 +1,98 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/pkg/lib_stub"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhimaAi/go_tools/logs"
+)
+
+// hostileInputs the values must reach the driver as bound arguments,never in the sql text
+var hostileInputs = []string{
+	`''; DROP TABLE chat_ai_library; --`,
+	`a' OR '1'='1`,
+	`yun_h5' OR '1'='1`,
+	`&|!():*<>\`,
+	`x' OR $1='1`,
+	`'::vector)) as similarity FROM pg_user --`,
+	`中文'引号`,
+}
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp(``, `manage_test_logs`)
+	if err != nil {
+		panic(err)
+	}
+	logs.SetLogsDir(dir)
+	gin.SetMode(gin.TestMode)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	_ = os.RemoveAll(`logs`) //written by the i18n init,the locale files are not found from the package directory
+	os.Exit(code)
+}
+
+// newStubServer the handler is served with the stub database and redis,the token of the user is returned
+func newStubServer(t *testing.T, method, path string, handler gin.HandlerFunc, responder lib_stub.Responder) (*httptest.Server, *lib_stub.DB, string) {
+	t.Helper()
+	db, err := lib_stub.RegisterDataBase(define.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Reset(responder)
+	define.Redis = lib_stub.NewRedis()
+	engine := gin.New()
+	engine.Handle(method, path, handler)
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+	token, err := common.GetToken(1, `admin`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, db, token[`token`].(string)
+}
+
+// checkBoundInput the input is bound to the statement of the table and is in no sql text
+func checkBoundInput(t *testing.T, queries []lib_stub.Query, table, input string) {
+	t.Helper()
+	bound := false
+	for _, query := range queries {
+		if strings.Contains(query.Sql, input) {
+			t.Fatalf(`input %q is in the sql:%s`, input, query.Sql)
+		}
+		if strings.Contains(query.Sql, table) && query.HasArg(input) {
+			bound = true
+		}
+	}
+	if !bound {
+		t.Fatalf(`input %q is not bound to the statement of %s:%v`, input, table, queries)
+	}
+}
+
+func TestStatAnalyseBindsChannel(t *testing.T) {
+	server, db, token := newStubServer(t, http.MethodGet, `/manage/stats/analyse`, StatAnalyse, nil)
+	for _, channel := range hostileInputs {
+		db.Reset(nil)
+		query := url.Values{`type`: {`1`}, `robot_id`: {`2`}, `start_date`: {`2024-01-01`}, `end_date`: {`2024-01-31`}, `channel`: {channel}}
+		req, err := http.NewRequest(http.MethodGet, server.URL+`/manage/stats/analyse?`+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(`token`, token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		checkBoundInput(t, db.Queries(), `llm_request_daily_stats`, channel)
+	}
+}
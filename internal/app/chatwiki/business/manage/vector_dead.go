@@ -0,0 +1,97 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package manage
+
+import (
+	"chatwiki/internal/app/chatwiki/common"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_redis"
+	"chatwiki/internal/pkg/lib_web"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+)
+
+// GetDeadVectorList the vectors that failed after the retries,by library or file
+func GetDeadVectorList(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId := cast.ToInt(c.Query(`library_id`))
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	page := max(1, cast.ToInt(c.Query(`page`)))
+	size := max(1, cast.ToInt(c.Query(`size`)))
+	m := msql.Model(`chat_ai_library_vector_dead`, define.Postgres).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Where(`library_id`, cast.ToString(libraryId))
+	if fileId := cast.ToInt(c.Query(`file_id`)); fileId > 0 {
+		m.Where(`file_id`, cast.ToString(fileId))
+	}
+	if status := cast.ToInt(c.Query(`status`)); status > 0 {
+		m.Where(`status`, cast.ToString(status))
+	}
+	list, total, err := m.Order(`id desc`).Paginate(page, size)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	data := map[string]any{`list`: list, `total`: total, `page`: page, `size`: size}
+	c.String(http.StatusOK, lib_web.FmtJson(data, nil))
+}
+
+// RetryDeadVectors retry the waiting dead vectors of the library,the file or the ids in bulk
+func RetryDeadVectors(c *gin.Context) {
+	var userId int
+	if userId = GetAdminUserId(c); userId == 0 {
+		return
+	}
+	libraryId, fileId, ids := cast.ToInt(c.PostForm(`library_id`)), cast.ToInt(c.PostForm(`file_id`)), c.PostForm(`ids`)
+	if libraryId <= 0 {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_lack`))))
+		return
+	}
+	if len(ids) > 0 && !common.CheckIds(ids) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `param_invalid`, `ids`))))
+		return
+	}
+	lockKey := define.LockPreKey + `RetryDeadVectors` + cast.ToString(libraryId)
+	if !lib_redis.AddLock(define.Redis, lockKey, time.Minute) {
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `op_lock`))))
+		return
+	}
+	defer lib_redis.UnLock(define.Redis, lockKey)
+	m := msql.Model(`chat_ai_library_vector_dead`, define.Postgres).
+		Where(`admin_user_id`, cast.ToString(userId)).
+		Where(`library_id`, cast.ToString(libraryId)).
+		Where(`status`, cast.ToString(define.DeadVectorStatusWaiting))
+	if fileId > 0 {
+		m.Where(`file_id`, cast.ToString(fileId))
+	}
+	if len(ids) > 0 {
+		m.Where(`id`, `in`, ids)
+	}
+	list, err := m.Field(`id,file_id,index_id`).Order(`id`).Select()
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	total, err := common.RetryDeadVectors(list)
+	if err != nil {
+		logs.Error(err.Error())
+		c.String(http.StatusOK, lib_web.FmtJson(nil, errors.New(i18n.Show(common.GetLang(c), `sys_err`))))
+		return
+	}
+	c.String(http.StatusOK, lib_web.FmtJson(map[string]any{`total`: total}, nil))
+}
@@ -6,10 +6,12 @@ import (
 	"chatwiki/internal/app/chatwiki/common"
 	"chatwiki/internal/app/chatwiki/define"
 	"chatwiki/internal/pkg/lib_redis"
+	"fmt"
 	"github.com/spf13/cast"
 	"github.com/zhimaAi/go_tools/logs"
 	"github.com/zhimaAi/go_tools/msql"
 	"github.com/zhimaAi/go_tools/tool"
+	"strings"
 	"sync"
 	"time"
 )
@@ -45,8 +47,12 @@ func ConvertHtml(msg string, _ ...string) error {
 		logs.Error(`abnormal state:%s/%v`, msg, info[`status`])
 		return nil
 	}
-	//convert html
-	htmlUrl, err := common.ConvertHtml(link, cast.ToInt(info[`admin_user_id`]))
+	common.SetIngestStage(fileId, define.IngestStageConvert)
+	//convert html,the native files are read directly
+	var htmlUrl string
+	if !define.IsNativeFile(info[`file_ext`]) {
+		htmlUrl, err = common.ConvertHtml(link, cast.ToInt(info[`admin_user_id`]))
+	}
 	if err != nil && err.Error() == `Service Unavailable` {
 		logs.Error(`service unavailable. try again in one minute:%s`, msg)
 		_ = common.AddJobs(define.ConvertHtmlTopic, msg, time.Minute)
@@ -54,9 +60,10 @@ func ConvertHtml(msg string, _ ...string) error {
 	}
 	m := msql.Model(`chat_ai_library_file`, define.Postgres)
 	if err != nil {
+		errmsg := err.Error()
 		_, err = m.Where(`id`, cast.ToString(fileId)).Update(msql.Datas{
 			`status`:      define.FileStatusException,
-			`errmsg`:      err.Error(),
+			`errmsg`:      errmsg,
 			`update_time`: tool.Time2Int(),
 		})
 		if err != nil {
@@ -64,6 +71,7 @@ func ConvertHtml(msg string, _ ...string) error {
 		}
 		//clear cached data
 		lib_redis.DelCacheData(define.Redis, &common.LibFileCacheBuildHandler{FileId: fileId})
+		common.FailIngestJob(fileId, errmsg)
 		return nil
 	}
 	_, err = m.Where(`id`, cast.ToString(fileId)).Update(msql.Datas{
@@ -77,29 +85,38 @@ func ConvertHtml(msg string, _ ...string) error {
 	}
 	//clear cached data
 	lib_redis.DelCacheData(define.Redis, &common.LibFileCacheBuildHandler{FileId: fileId})
+	common.SetIngestStage(fileId, define.IngestStageSplit)
 
-	//create default lib file split
+	//create lib file split:a renewed file is split again by its saved params,so the unchanged paragraphs keep their hash
 	lang := define.LangEnUs
 
-	splitParams := define.SplitParams{}
-	splitParams.ChunkSize = 512
-	splitParams.ChunkOverlap = 0
-	splitParams.SeparatorsNo = `11,12`
-	splitParams.EnableExtractImage = true
-	list, wordTotal, err := common.GetLibFileSplit(cast.ToInt(info[`admin_user_id`]), fileId, splitParams, lang)
+	splitParams, qaIndexType, ok := common.GetSavedSplitParams(info)
+	if !ok {
+		splitParams = define.SplitParams{}
+		splitParams.ChunkSize = 512
+		splitParams.ChunkOverlap = 0
+		splitParams.SeparatorsNo = `11,12`
+		splitParams.EnableExtractImage = true
+		qaIndexType = define.QAIndexTypeQuestionAndAnswer
+	}
+	list, wordTotal, _, err := common.GetLibFileSplit(cast.ToInt(info[`admin_user_id`]), fileId, splitParams, lang)
 	if err != nil {
 		logs.Error(err.Error())
+		common.FailIngestJob(fileId, err.Error())
 		return err
 	}
-	err = common.SaveLibFileSplit(cast.ToInt(info[`admin_user_id`]), fileId, wordTotal, define.QAIndexTypeQuestionAndAnswer, splitParams, list, lang)
+	err = common.SaveLibFileSplit(cast.ToInt(info[`admin_user_id`]), fileId, wordTotal, qaIndexType, splitParams, list, lang)
 	if err != nil {
 		logs.Error(err.Error())
+		common.FailIngestJob(fileId, err.Error())
 		return err
 	}
 
 	return nil
 }
 
+// ConvertVector embed the row of the message and the claimed pending rows of the same model,
+// batched embedding requests are out of scope:the adaptor takes one input,so one request is made per distinct content
 func ConvertVector(msg string, _ ...string) error {
 	logs.Debug(`nsq:%s`, msg)
 	data := make(map[string]any)
@@ -112,12 +129,6 @@ func ConvertVector(msg string, _ ...string) error {
 		logs.Error(`data exception:%s`, msg)
 		return nil
 	}
-	file, err := msql.Model(`chat_ai_library_file`, define.Postgres).Where(`id`, cast.ToString(fileId)).Find()
-	if err != nil {
-		logs.Error(err.Error())
-		return nil
-	}
-
 	info, err := msql.Model(`chat_ai_library_file_data_index`, define.Postgres).Where(`id`, cast.ToString(id)).Find()
 	if err != nil {
 		logs.Error(err.Error())
@@ -128,51 +139,160 @@ func ConvertVector(msg string, _ ...string) error {
 		return nil
 	}
 	if cast.ToInt(info[`status`]) != define.VectorStatusInitial {
-		logs.Error(`abnormal state:%s/%v`, msg, info[`status`])
+		logs.Debug(`converted by another message:%s/%v`, msg, info[`status`])
 		return nil
 	}
-	//start convert
-	library, _ := common.GetLibraryInfo(cast.ToInt(info[`library_id`]), cast.ToInt(info[`admin_user_id`]))
-	embedding, err := common.GetVector2000(
-		cast.ToInt(info[`admin_user_id`]),
-		info[`admin_user_id`],
-		msql.Params{},
-		info,
-		file,
-		cast.ToInt(library[`model_config_id`]),
-		library[`use_model`],
-		info[`content`],
-	)
-	if err != nil {
-		_, err := msql.Model(`chat_ai_library_file_data_index`, define.Postgres).Where(`id`, cast.ToString(id)).Update(msql.Datas{
-			`status`:      define.VectorStatusException,
-			`errmsg`:      err.Error(),
-			`update_time`: tool.Time2Int(),
-		})
+	if cast.ToInt(info[`retry_time`]) > tool.Time2Int() {
+		logs.Debug(`waiting for the retry:%s/%v`, msg, info[`retry_time`])
+		return nil //the delayed message of the retry is added with it
+	}
+	library, err := common.GetLibraryInfo(cast.ToInt(info[`library_id`]), cast.ToInt(info[`admin_user_id`]))
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	//claim:pending rows of the libraries that use the same embedding model
+	libraryIds, err := msql.Model(`chat_ai_library`, define.Postgres).
+		Where(`admin_user_id`, info[`admin_user_id`]).
+		Where(`model_config_id`, library[`model_config_id`]).
+		Where(`use_model`, library[`use_model`]).ColumnArr(`id`)
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	list := []msql.Params{info}
+	if len(libraryIds) > 0 {
+		pending, err := msql.Model(`chat_ai_library_file_data_index`, define.Postgres).
+			Where(`library_id`, `in`, strings.Join(libraryIds, `,`)).
+			Where(`status`, cast.ToString(define.VectorStatusInitial)).
+			Where(`retry_time`, `<=`, cast.ToString(tool.Time2Int())).
+			Where(`id`, `<>`, info[`id`]).
+			Order(`id`).Limit(define.ConvertVectorClaimSize - 1).Select()
 		if err != nil {
 			logs.Error(err.Error())
-			return nil
 		}
+		list = append(list, pending...)
+	}
+	//claim rows,rows claimed by other consumers are skipped
+	claimed := make([]msql.Params, 0, len(list))
+	for _, one := range list {
+		if lib_redis.AddLock(define.Redis, define.LockPreKey+`ConvertVector`+one[`id`], time.Minute*10) {
+			claimed = append(claimed, one)
+		}
+	}
+	defer func() {
+		for _, one := range claimed {
+			lib_redis.UnLock(define.Redis, define.LockPreKey+`ConvertVector`+one[`id`])
+		}
+	}()
+	//the same content only needs to be embedded once
+	contents := make(map[string][]msql.Params)
+	for _, one := range claimed {
+		contents[one[`content`]] = append(contents[one[`content`]], one)
+	}
+	wg, limiter := &sync.WaitGroup{}, make(chan struct{}, define.ConvertVectorConcurrency)
+	statuses, errs, resultMutex := make(map[string]int), make(map[string]error), &sync.Mutex{}
+	for _, rows := range contents {
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func(rows []msql.Params) {
+			defer func() { <-limiter; wg.Done() }()
+			file, _ := common.GetLibFileInfo(cast.ToInt(rows[0][`file_id`]), 0)
+			rowLibrary, _ := common.GetLibraryInfo(cast.ToInt(rows[0][`library_id`]), 0)
+			embedding, err := common.GetVector2000(
+				cast.ToInt(rows[0][`admin_user_id`]),
+				rows[0][`admin_user_id`],
+				msql.Params{},
+				rowLibrary,
+				file,
+				cast.ToInt(library[`model_config_id`]),
+				library[`use_model`],
+				rows[0][`content`],
+			)
+			for _, row := range rows {
+				status := saveConvertVectorResult(row, embedding, err)
+				resultMutex.Lock()
+				statuses[row[`id`]], errs[row[`id`]] = status, err
+				resultMutex.Unlock()
+			}
+		}(rows)
+	}
+	wg.Wait()
 
-		//check finish
-		CheckFileLearned(fileId)
-		return nil
+	//ingestion progress and check finish
+	type embedResult struct {
+		embedded, failed int
+		errmsg           string
+	}
+	results := make(map[int]*embedResult)
+	for _, one := range claimed {
+		fileId := cast.ToInt(one[`file_id`])
+		if _, ok := results[fileId]; !ok {
+			results[fileId] = &embedResult{}
+		}
+		switch statuses[one[`id`]] {
+		case define.VectorStatusConverted:
+			results[fileId].embedded++
+		case define.VectorStatusException:
+			results[fileId].failed++
+			results[fileId].errmsg = errs[one[`id`]].Error()
+		}
+	}
+	for id, result := range results {
+		common.AddIngestEmbedded(id, result.embedded, result.failed, result.errmsg)
+		CheckFileLearned(id)
 	}
+	return nil
+}
 
-	_, err = msql.Model(`chat_ai_library_file_data_index`, define.Postgres).Where(`id`, cast.ToString(id)).Update(msql.Datas{
-		`status`:      define.VectorStatusConverted,
-		`embedding`:   embedding,
-		`errmsg`:      `success`,
+// saveConvertVectorResult the failed row is requeued with an exponential backoff,
+// it is moved to the dead letters after the retries are used up
+func saveConvertVectorResult(row msql.Params, embedding string, err error) int {
+	m := msql.Model(`chat_ai_library_file_data_index`, define.Postgres)
+	if err == nil {
+		_, err = m.Where(`id`, row[`id`]).Where(`status`, cast.ToString(define.VectorStatusInitial)).Update(msql.Datas{
+			`status`:      define.VectorStatusConverted,
+			`embedding`:   embedding,
+			`errmsg`:      `success`,
+			`retry_times`: 0,
+			`retry_time`:  0,
+			`update_time`: tool.Time2Int(),
+		})
+		if err != nil {
+			logs.Error(err.Error())
+		}
+		common.DeleteDeadVector(row[`id`])
+		return define.VectorStatusConverted
+	}
+	errmsg, retryTimes := err.Error(), cast.ToInt(row[`retry_times`])
+	if retryTimes < define.ConvertVectorRetryMax {
+		delay := time.Duration(define.ConvertVectorRetryDelay<<retryTimes) * time.Second
+		_, err = m.Where(`id`, row[`id`]).Where(`status`, cast.ToString(define.VectorStatusInitial)).Update(msql.Datas{
+			`errmsg`:      errmsg,
+			`retry_times`: retryTimes + 1,
+			`retry_time`:  time.Now().Add(delay).Unix(),
+			`update_time`: tool.Time2Int(),
+		})
+		if err != nil {
+			logs.Error(err.Error())
+		}
+		if message, err := tool.JsonEncode(map[string]any{`id`: row[`id`], `file_id`: row[`file_id`]}); err != nil {
+			logs.Error(err.Error())
+		} else if err := common.AddJobs(define.ConvertVectorTopic, message, delay); err != nil {
+			logs.Error(err.Error())
+		}
+		return define.VectorStatusInitial
+	}
+	_, err = m.Where(`id`, row[`id`]).Where(`status`, cast.ToString(define.VectorStatusInitial)).Update(msql.Datas{
+		`status`:      define.VectorStatusException,
+		`errmsg`:      errmsg,
 		`update_time`: tool.Time2Int(),
 	})
 	if err != nil {
 		logs.Error(err.Error())
-		return nil
 	}
-
-	//check finish
-	CheckFileLearned(fileId)
-	return nil
+	common.SaveDeadVector(row, errmsg)
+	return define.VectorStatusException
 }
 
 func CheckFileLearned(fileId int) {
@@ -192,9 +312,18 @@ func CheckFileLearned(fileId int) {
 		return //not finish
 	}
 
-	// finished
+	// finished,the vectors that failed after the retries are in the dead letters
+	failed, err := m.Where(`file_id`, cast.ToString(fileId)).Where(`status`, cast.ToString(define.VectorStatusException)).Count(`1`)
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	status := define.FileStatusLearned
+	if failed > 0 {
+		status = define.FileStatusLearnedWithErrors
+	}
 	_, err = msql.Model(`chat_ai_library_file`, define.Postgres).Where(`id`, cast.ToString(fileId)).Update(msql.Datas{
-		`status`:      define.FileStatusLearned,
+		`status`:      status,
 		`update_time`: tool.Time2Int(),
 	})
 	if err != nil {
@@ -203,6 +332,7 @@ func CheckFileLearned(fileId int) {
 	}
 	//clear cached data
 	lib_redis.DelCacheData(define.Redis, &common.LibFileCacheBuildHandler{FileId: fileId})
+	common.FinishIngestJob(fileId)
 }
 
 func CrawlArticle(msg string, _ ...string) error {
@@ -239,10 +369,12 @@ func CrawlArticle(msg string, _ ...string) error {
 		logs.Error(err.Error())
 		return nil
 	}
+	common.StartIngestJob(fileId, define.IngestStageCrawl)
 
 	//start crawl
 	uploadInfo, err := common.SaveUrlPage(cast.ToInt(file[`admin_user_id`]), file[`doc_url`], "library_file")
 	if err != nil {
+		common.FailIngestJob(fileId, err.Error())
 		_, err := m.Where(`id`, cast.ToString(fileId)).Update(msql.Datas{
 			`status`: define.FileStatusCrawlException,
 			`errmsg`: err.Error(),
@@ -269,6 +401,7 @@ func CrawlArticle(msg string, _ ...string) error {
 	}
 
 	// convert html
+	common.SetIngestStage(fileId, define.IngestStageConvert)
 	if message, err := tool.JsonEncode(map[string]any{`file_id`: fileId, `file_url`: uploadInfo.Link}); err != nil {
 		logs.Error(err.Error())
 	} else if err := common.AddJobs(define.ConvertHtmlTopic, message); err != nil {
@@ -276,3 +409,436 @@ func CrawlArticle(msg string, _ ...string) error {
 	}
 	return nil
 }
+
+func LibraryReindex(msg string, _ ...string) error {
+	logs.Debug(`nsq:%s`, msg)
+	data := make(map[string]any)
+	if err := tool.JsonDecode(msg, &data); err != nil {
+		logs.Error(`parsing failure:%s/%s`, msg, err.Error())
+		return nil
+	}
+	id := cast.ToInt(data[`id`])
+	if id <= 0 {
+		logs.Error(`data exception:%s`, msg)
+		return nil
+	}
+	lockKey := define.LockPreKey + `LibraryReindex` + cast.ToString(id)
+	if !lib_redis.AddLock(define.Redis, lockKey, time.Minute*10) {
+		return nil //processing by another consumer
+	}
+	locked := true
+	unlock := func() {
+		if locked {
+			locked = false
+			lib_redis.UnLock(define.Redis, lockKey)
+		}
+	}
+	defer unlock()
+	reindex, err := msql.Model(`chat_ai_library_reindex`, define.Postgres).Where(`id`, cast.ToString(id)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return err //redelivered by nsq
+	}
+	if len(reindex) == 0 || cast.ToInt(reindex[`status`]) != define.ReindexStatusRunning {
+		return nil //cancelled or finished
+	}
+	library, err := common.GetLibraryInfo(cast.ToInt(reindex[`library_id`]), 0)
+	if err != nil {
+		logs.Error(err.Error())
+		return err
+	}
+	m := msql.Model(`chat_ai_library_file_data_index`, define.Postgres)
+	list, err := m.Where(`library_id`, reindex[`library_id`]).
+		Where(`shadow_status`, cast.ToString(define.VectorStatusInitial)).
+		Order(`id`).Limit(define.LibraryReindexBatchSize).Field(`id,file_id,admin_user_id,content`).Select()
+	if err != nil {
+		logs.Error(err.Error())
+		return err
+	}
+	for _, one := range list {
+		file, _ := common.GetLibFileInfo(cast.ToInt(one[`file_id`]), 0)
+		embedding, err := common.GetVector2000(
+			cast.ToInt(one[`admin_user_id`]),
+			one[`admin_user_id`],
+			msql.Params{},
+			library,
+			file,
+			cast.ToInt(reindex[`new_model_config_id`]),
+			reindex[`new_use_model`],
+			one[`content`],
+		)
+		upData := msql.Datas{`shadow_embedding`: embedding, `shadow_status`: define.VectorStatusConverted}
+		if err != nil {
+			logs.Error(err.Error())
+			upData = msql.Datas{`shadow_status`: define.VectorStatusException}
+		}
+		if _, err = m.Where(`id`, one[`id`]).Update(upData); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	progress, err := common.UpdateReindexProgress(reindex)
+	if err != nil {
+		logs.Error(err.Error())
+		return err
+	}
+	if len(list) > 0 {
+		//next batch,the lock is released first for the consumer of it
+		unlock()
+		if err = common.AddJobs(define.LibraryReindexTopic, msg); err != nil {
+			logs.Error(err.Error())
+		}
+		return nil
+	}
+	//all converted
+	if cast.ToInt(progress[`error_total`]) > 0 {
+		_, err = msql.Model(`chat_ai_library_reindex`, define.Postgres).Where(`id`, reindex[`id`]).Update(msql.Datas{
+			`status`:      define.ReindexStatusFailed,
+			`errmsg`:      fmt.Sprintf(`%d index convert failed`, cast.ToInt(progress[`error_total`])),
+			`update_time`: tool.Time2Int(),
+		})
+		if err != nil {
+			logs.Error(err.Error())
+		}
+		_ = common.ClearReindexShadow(cast.ToInt(reindex[`library_id`]))
+		return nil
+	}
+	if err = common.SwitchReindex(reindex); err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+func LibraryEval(msg string, _ ...string) error {
+	logs.Debug(`nsq:%s`, msg)
+	data := make(map[string]any)
+	if err := tool.JsonDecode(msg, &data); err != nil {
+		logs.Error(`parsing failure:%s/%s`, msg, err.Error())
+		return nil
+	}
+	id := cast.ToInt(data[`id`])
+	if id <= 0 {
+		logs.Error(`data exception:%s`, msg)
+		return nil
+	}
+	if !lib_redis.AddLock(define.Redis, define.LockPreKey+`LibraryEval`+cast.ToString(id), time.Hour) {
+		return nil //processing by another consumer
+	}
+	defer lib_redis.UnLock(define.Redis, define.LockPreKey+`LibraryEval`+cast.ToString(id))
+	m := msql.Model(`chat_ai_library_eval_run`, define.Postgres)
+	run, err := m.Where(`id`, cast.ToString(id)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	if len(run) == 0 || cast.ToInt(run[`status`]) != define.EvalRunStatusRunning {
+		logs.Error(`abnormal state:%s/%v`, msg, run[`status`])
+		return nil
+	}
+	configs := make([]define.EvalConfig, 0)
+	if err = tool.JsonDecode(run[`configs`], &configs); err != nil {
+		logs.Error(`parsing failure:%s/%s`, run[`configs`], err.Error())
+		return nil
+	}
+	upData := msql.Datas{`status`: define.EvalRunStatusFinished, `update_time`: tool.Time2Int()}
+	results, err := common.RunLibraryEval(run, configs)
+	if err == nil {
+		upData[`results`], err = tool.JsonEncode(results)
+	}
+	if err != nil {
+		logs.Error(err.Error())
+		upData[`status`] = define.EvalRunStatusFailed
+		upData[`errmsg`] = err.Error()
+	}
+	if _, err = m.Where(`id`, cast.ToString(id)).Update(upData); err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+func LibraryImport(msg string, _ ...string) error {
+	logs.Debug(`nsq:%s`, msg)
+	data := make(map[string]any)
+	if err := tool.JsonDecode(msg, &data); err != nil {
+		logs.Error(`parsing failure:%s/%s`, msg, err.Error())
+		return nil
+	}
+	id := cast.ToInt(data[`id`])
+	if id <= 0 {
+		logs.Error(`data exception:%s`, msg)
+		return nil
+	}
+	if !lib_redis.AddLock(define.Redis, define.LockPreKey+`LibraryImport`+cast.ToString(id), time.Hour) {
+		return nil //processing by another consumer
+	}
+	defer lib_redis.UnLock(define.Redis, define.LockPreKey+`LibraryImport`+cast.ToString(id))
+	m := msql.Model(`chat_ai_library_import`, define.Postgres)
+	job, err := m.Where(`id`, cast.ToString(id)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	if len(job) == 0 || cast.ToInt(job[`status`]) != define.ImportStatusRunning {
+		logs.Error(`abnormal state:%s/%v`, msg, job[`status`])
+		return nil
+	}
+	upData := msql.Datas{`status`: define.ImportStatusFinished, `update_time`: tool.Time2Int()}
+	if err = common.RunLibraryImport(job); err != nil {
+		logs.Error(err.Error())
+		upData[`status`] = define.ImportStatusFailed
+		upData[`errmsg`] = err.Error()
+	}
+	if _, err = m.Where(`id`, cast.ToString(id)).Update(upData); err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+func QaGenerate(msg string, _ ...string) error {
+	logs.Debug(`nsq:%s`, msg)
+	data := make(map[string]any)
+	if err := tool.JsonDecode(msg, &data); err != nil {
+		logs.Error(`parsing failure:%s/%s`, msg, err.Error())
+		return nil
+	}
+	id := cast.ToInt(data[`id`])
+	if id <= 0 {
+		logs.Error(`data exception:%s`, msg)
+		return nil
+	}
+	if !lib_redis.AddLock(define.Redis, define.LockPreKey+`QaGenerate`+cast.ToString(id), time.Hour) {
+		return nil //processing by another consumer
+	}
+	defer lib_redis.UnLock(define.Redis, define.LockPreKey+`QaGenerate`+cast.ToString(id))
+	m := msql.Model(`chat_ai_library_qa_generate`, define.Postgres)
+	job, err := m.Where(`id`, cast.ToString(id)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	if len(job) == 0 || cast.ToInt(job[`status`]) != define.QaGenerateStatusRunning {
+		logs.Error(`abnormal state:%s/%v`, msg, job[`status`])
+		return nil
+	}
+	upData := msql.Datas{`status`: define.QaGenerateStatusFinished, `update_time`: tool.Time2Int()}
+	if err = common.RunQaGenerate(job); err != nil {
+		logs.Error(err.Error())
+		upData[`status`] = define.QaGenerateStatusFailed
+		upData[`errmsg`] = common.MbSubstr(err.Error(), 0, 1000)
+	}
+	if _, err = m.Where(`id`, cast.ToString(id)).Update(upData); err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+func SyntheticQuestion(msg string, _ ...string) error {
+	logs.Debug(`nsq:%s`, msg)
+	data := make(map[string]any)
+	if err := tool.JsonDecode(msg, &data); err != nil {
+		logs.Error(`parsing failure:%s/%s`, msg, err.Error())
+		return nil
+	}
+	dataId := cast.ToInt(data[`data_id`])
+	if dataId <= 0 {
+		logs.Error(`data exception:%s`, msg)
+		return nil
+	}
+	if !lib_redis.AddLock(define.Redis, define.LockPreKey+`SyntheticQuestion`+cast.ToString(dataId), time.Minute*5) {
+		return nil //processing by another consumer
+	}
+	defer lib_redis.UnLock(define.Redis, define.LockPreKey+`SyntheticQuestion`+cast.ToString(dataId))
+	paragraph, err := msql.Model(`chat_ai_library_file_data`, define.Postgres).Where(`id`, cast.ToString(dataId)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	if len(paragraph) == 0 || cast.ToInt(paragraph[`type`]) != define.ParagraphTypeNormal {
+		return nil //deleted or not a normal paragraph
+	}
+	hash := common.GetSyntheticHash(paragraph[`content`])
+	if !cast.ToBool(data[`force`]) && paragraph[`synthetic_hash`] == hash {
+		return nil //the content has not changed
+	}
+	library, err := common.GetLibraryInfo(cast.ToInt(paragraph[`library_id`]), 0)
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	if !common.IsSyntheticQuestionLibrary(library) {
+		return nil
+	}
+	questions, err := common.GenerateSyntheticQuestions(library, paragraph)
+	if err != nil {
+		logs.Error(`generate synthetic question:%d/%s`, dataId, err.Error())
+		return nil
+	}
+	if err = common.SaveSyntheticQuestions(paragraph, questions, hash); err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+func GraphExtract(msg string, _ ...string) error {
+	logs.Debug(`nsq:%s`, msg)
+	data := make(map[string]any)
+	if err := tool.JsonDecode(msg, &data); err != nil {
+		logs.Error(`parsing failure:%s/%s`, msg, err.Error())
+		return nil
+	}
+	dataId := cast.ToInt(data[`data_id`])
+	if dataId <= 0 {
+		logs.Error(`data exception:%s`, msg)
+		return nil
+	}
+	if !lib_redis.AddLock(define.Redis, define.LockPreKey+`GraphExtract`+cast.ToString(dataId), time.Minute*5) {
+		return nil //processing by another consumer
+	}
+	defer lib_redis.UnLock(define.Redis, define.LockPreKey+`GraphExtract`+cast.ToString(dataId))
+	paragraph, err := msql.Model(`chat_ai_library_file_data`, define.Postgres).Where(`id`, cast.ToString(dataId)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	if len(paragraph) == 0 {
+		return nil //deleted
+	}
+	hash := tool.MD5(common.GetGraphParagraphText(paragraph))
+	if !cast.ToBool(data[`force`]) && paragraph[`graph_hash`] == hash {
+		return nil //the content has not changed
+	}
+	library, err := common.GetLibraryInfo(cast.ToInt(paragraph[`library_id`]), 0)
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	if !common.IsGraphLibrary(library) {
+		return nil
+	}
+	result, err := common.ExtractParagraphGraph(library, paragraph)
+	if err != nil {
+		logs.Error(`graph extract:%d/%s`, dataId, err.Error())
+		return nil
+	}
+	if err = common.SaveParagraphGraph(paragraph, result, hash); err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+func LibraryRepoSync(msg string, _ ...string) error {
+	logs.Debug(`nsq:%s`, msg)
+	data := make(map[string]any)
+	if err := tool.JsonDecode(msg, &data); err != nil {
+		logs.Error(`parsing failure:%s/%s`, msg, err.Error())
+		return nil
+	}
+	id := cast.ToInt(data[`id`])
+	if id <= 0 {
+		logs.Error(`data exception:%s`, msg)
+		return nil
+	}
+	if !lib_redis.AddLock(define.Redis, define.LockPreKey+`LibraryRepoSync`+cast.ToString(id), time.Hour) {
+		return nil //processing by another consumer
+	}
+	defer lib_redis.UnLock(define.Redis, define.LockPreKey+`LibraryRepoSync`+cast.ToString(id))
+	m := msql.Model(`chat_ai_library_repo`, define.Postgres)
+	repo, err := m.Where(`id`, cast.ToString(id)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	if len(repo) == 0 || cast.ToInt(repo[`status`]) != define.RepoStatusSyncing {
+		logs.Error(`abnormal state:%s/%v`, msg, repo[`status`])
+		return nil
+	}
+	upData, err := common.RunRepoSync(repo)
+	if err != nil {
+		logs.Error(err.Error())
+		upData = msql.Datas{`status`: define.RepoStatusFailed, `errmsg`: common.MbSubstr(err.Error(), 0, 1000)}
+	} else {
+		upData[`status`] = define.RepoStatusSynced
+	}
+	upData[`last_sync_time`] = tool.Time2Int()
+	upData[`update_time`] = tool.Time2Int()
+	if _, err = m.Where(`id`, cast.ToString(id)).Update(upData); err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+func LibraryCrawl(msg string, _ ...string) error {
+	logs.Debug(`nsq:%s`, msg)
+	data := make(map[string]any)
+	if err := tool.JsonDecode(msg, &data); err != nil {
+		logs.Error(`parsing failure:%s/%s`, msg, err.Error())
+		return nil
+	}
+	id := cast.ToInt(data[`id`])
+	if id <= 0 {
+		logs.Error(`data exception:%s`, msg)
+		return nil
+	}
+	if !lib_redis.AddLock(define.Redis, define.LockPreKey+`LibraryCrawl`+cast.ToString(id), time.Hour) {
+		return nil //processing by another consumer
+	}
+	defer lib_redis.UnLock(define.Redis, define.LockPreKey+`LibraryCrawl`+cast.ToString(id))
+	m := msql.Model(`chat_ai_library_crawl`, define.Postgres)
+	job, err := m.Where(`id`, cast.ToString(id)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	if len(job) == 0 || cast.ToInt(job[`status`]) != define.CrawlStatusRunning {
+		logs.Error(`abnormal state:%s/%v`, msg, job[`status`])
+		return nil
+	}
+	more, err := common.RunCrawlBatch(job)
+	if err == nil && more {
+		//the rest pages are continued by the next message,so that the job can be cancelled or resumed
+		if err = common.AddCrawlJob(id); err != nil {
+			logs.Error(err.Error())
+		}
+		return nil
+	}
+	upData := msql.Datas{`status`: define.CrawlStatusFinished, `update_time`: tool.Time2Int()}
+	if err != nil {
+		logs.Error(err.Error())
+		upData = msql.Datas{`status`: define.CrawlStatusFailed, `errmsg`: common.MbSubstr(err.Error(), 0, 1000), `update_time`: tool.Time2Int()}
+	}
+	_, err = m.Where(`id`, cast.ToString(id)).Where(`status`, cast.ToString(define.CrawlStatusRunning)).Update(upData)
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+func GraphCommunity(msg string, _ ...string) error {
+	logs.Debug(`nsq:%s`, msg)
+	data := make(map[string]any)
+	if err := tool.JsonDecode(msg, &data); err != nil {
+		logs.Error(`parsing failure:%s/%s`, msg, err.Error())
+		return nil
+	}
+	libraryId := cast.ToInt(data[`library_id`])
+	if libraryId <= 0 {
+		logs.Error(`data exception:%s`, msg)
+		return nil
+	}
+	if !lib_redis.AddLock(define.Redis, define.LockPreKey+`GraphCommunity`+cast.ToString(libraryId), time.Hour) {
+		return nil //processing by another consumer
+	}
+	defer lib_redis.UnLock(define.Redis, define.LockPreKey+`GraphCommunity`+cast.ToString(libraryId))
+	//graph_dirty is read from the table,the cached library info may be stale
+	library, err := msql.Model(`chat_ai_library`, define.Postgres).Where(`id`, cast.ToString(libraryId)).Find()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	if !common.IsGraphLibrary(library) || cast.ToInt(library[`graph_dirty`]) != define.SwitchOn {
+		return nil //built by the previous job
+	}
+	if err = common.BuildLibraryGraphCommunity(library); err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
@@ -9,7 +9,9 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -131,13 +133,22 @@ func GetImgInMessage(message string) (string, []string) {
 	return message, out
 }
 
-func CheckSplitParams(splitParams define.SplitParams, lang string) (define.SplitParams, error) {
+func CheckSplitParams(splitParams define.SplitParams, tokenizer *EmbeddingTokenizer, lang string) (define.SplitParams, error) {
 	//diy split
 	if len(splitParams.SeparatorsNo) == 0 {
 		return splitParams, errors.New(i18n.Show(lang, `param_empty`, `separators_no`))
 	}
-	if splitParams.ChunkSize < 200 || splitParams.ChunkSize > 2000 {
-		return splitParams, errors.New(i18n.Show(lang, `chunk_size_err`, 200, 2000))
+	switch splitParams.ChunkUnit {
+	case define.ChunkUnitChar:
+		if splitParams.ChunkSize < 200 || splitParams.ChunkSize > 2000 {
+			return splitParams, errors.New(i18n.Show(lang, `chunk_size_err`, 200, 2000))
+		}
+	case define.ChunkUnitToken: //within the max input of the library embedding model
+		if splitParams.ChunkSize < define.ChunkTokenSizeMin || splitParams.ChunkSize > tokenizer.InputLimit() {
+			return splitParams, errors.New(i18n.Show(lang, `chunk_token_size_err`, define.ChunkTokenSizeMin, tokenizer.InputLimit()))
+		}
+	default:
+		return splitParams, errors.New(i18n.Show(lang, `param_invalid`, `chunk_unit`))
 	}
 	maxChunkOverlap := splitParams.ChunkSize / 2
 	if splitParams.ChunkOverlap < 0 || splitParams.ChunkOverlap > maxChunkOverlap {
@@ -155,9 +166,28 @@ func CheckSplitParams(splitParams define.SplitParams, lang string) (define.Split
 			splitParams.Separators = append(splitParams.Separators, cast.ToString(code))
 		}
 	}
+	rules, err := CheckSeparatorRules(splitParams.SeparatorRules, lang)
+	if err != nil {
+		return splitParams, err
+	}
+	splitParams.SeparatorRules = rules
+	if !tool.InArrayInt(splitParams.SplitMode, []int{define.SplitModeRecursive, define.SplitModeStructure}) {
+		return splitParams, errors.New(i18n.Show(lang, `param_invalid`, `split_mode`))
+	}
+	if !tool.InArrayInt(splitParams.TableFormat, []int{define.TableFormatMarkdown, define.TableFormatRow}) {
+		return splitParams, errors.New(i18n.Show(lang, `param_invalid`, `table_format`))
+	}
 	//qa_doc
 	if splitParams.IsQaDoc == define.DocTypeQa {
-		if splitParams.IsTableFile == define.FileIsTable {
+		splitParams.SplitMode = define.SplitModeRecursive
+		if define.IsJsonFile(splitParams.FileExt) {
+			if len(splitParams.JsonQuestionField) == 0 {
+				return splitParams, errors.New(i18n.Show(lang, `param_empty`, `json_question_field`))
+			}
+			if len(splitParams.JsonAnswerField) == 0 {
+				return splitParams, errors.New(i18n.Show(lang, `param_empty`, `json_answer_field`))
+			}
+		} else if splitParams.IsTableFile == define.FileIsTable {
 			if len(splitParams.QuestionColumn) == 0 {
 				return splitParams, errors.New(i18n.Show(lang, `param_empty`, `question_column`))
 			}
@@ -179,6 +209,26 @@ func CheckSplitParams(splitParams define.SplitParams, lang string) (define.Split
 	return splitParams, nil
 }
 
+// CheckSeparatorRules the custom separators are sorted by the priority,the same priority keeps the given order
+func CheckSeparatorRules(rules []define.SeparatorRule, lang string) ([]define.SeparatorRule, error) {
+	if len(rules) > define.SeparatorRuleMax {
+		return nil, errors.New(i18n.Show(lang, `separator_rule_max`, define.SeparatorRuleMax))
+	}
+	list := make([]define.SeparatorRule, 0, len(rules))
+	for i, rule := range rules {
+		if len(rule.Pattern) == 0 || len(rule.Pattern) > define.SeparatorRuleMaxLen {
+			return nil, errors.New(i18n.Show(lang, `separator_rule_err`, i+1))
+		}
+		//the pattern matching an empty string can not split the text
+		if re, err := regexp.Compile(rule.Pattern); err != nil || re.MatchString(``) {
+			return nil, errors.New(i18n.Show(lang, `separator_rule_err`, i+1))
+		}
+		list = append(list, rule)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Priority < list[j].Priority })
+	return list, nil
+}
+
 func CheckLibraryImage(images []string) (string, error) {
 	extensions := strings.Join(define.ImageAllowExt, "|")
 	pattern := `^\/upload\/chat_ai\/\d+\/library_image\/\d+\/[a-f0-9]{32}\.(` + extensions + `)$`
@@ -197,3 +247,47 @@ func CheckLibraryImage(images []string) (string, error) {
 	}
 	return string(jsonImages), nil
 }
+
+// CheckRankParams fields not submitted keep the value of the robot
+func CheckRankParams(c *gin.Context, robot msql.Params) (define.RankParams, error) {
+	params := GetRankParams(robot)
+	params.VectorWeight = cast.ToFloat64(c.DefaultPostForm(`rrf_vector_weight`, cast.ToString(params.VectorWeight)))
+	params.VectorK = cast.ToInt(c.DefaultPostForm(`rrf_vector_k`, cast.ToString(params.VectorK)))
+	params.SearchWeight = cast.ToFloat64(c.DefaultPostForm(`rrf_search_weight`, cast.ToString(params.SearchWeight)))
+	params.SearchK = cast.ToInt(c.DefaultPostForm(`rrf_search_k`, cast.ToString(params.SearchK)))
+	params.RerankWeight = cast.ToFloat64(c.DefaultPostForm(`rrf_rerank_weight`, cast.ToString(params.RerankWeight)))
+	params.RerankK = cast.ToInt(c.DefaultPostForm(`rrf_rerank_k`, cast.ToString(params.RerankK)))
+	params.MmrStatus = cast.ToInt(c.DefaultPostForm(`mmr_status`, cast.ToString(params.MmrStatus)))
+	params.MmrLambda = cast.ToFloat64(c.DefaultPostForm(`mmr_lambda`, cast.ToString(params.MmrLambda)))
+	params.MinFusedScore = cast.ToFloat64(c.DefaultPostForm(`min_fused_score`, cast.ToString(params.MinFusedScore)))
+	params.GraphStatus = cast.ToInt(c.DefaultPostForm(`graph_status`, cast.ToString(params.GraphStatus)))
+	params.GraphWeight = cast.ToFloat64(c.DefaultPostForm(`rrf_graph_weight`, cast.ToString(params.GraphWeight)))
+	params.GraphK = cast.ToInt(c.DefaultPostForm(`rrf_graph_k`, cast.ToString(params.GraphK)))
+	for field, weight := range map[string]float64{`rrf_vector_weight`: params.VectorWeight, `rrf_search_weight`: params.SearchWeight,
+		`rrf_rerank_weight`: params.RerankWeight, `rrf_graph_weight`: params.GraphWeight} {
+		if weight < 0 || weight > 10 {
+			return params, errors.New(i18n.Show(GetLang(c), `param_invalid`, field))
+		}
+	}
+	if params.VectorWeight+params.SearchWeight+params.RerankWeight <= 0 {
+		return params, errors.New(i18n.Show(GetLang(c), `param_invalid`, `rrf_vector_weight`))
+	}
+	for field, k := range map[string]int{`rrf_vector_k`: params.VectorK, `rrf_search_k`: params.SearchK, `rrf_rerank_k`: params.RerankK, `rrf_graph_k`: params.GraphK} {
+		if k < 0 || k > 1000 {
+			return params, errors.New(i18n.Show(GetLang(c), `param_invalid`, field))
+		}
+	}
+	if params.MmrStatus != define.SwitchOff && params.MmrStatus != define.SwitchOn {
+		return params, errors.New(i18n.Show(GetLang(c), `param_invalid`, `mmr_status`))
+	}
+	if params.GraphStatus != define.SwitchOff && params.GraphStatus != define.SwitchOn {
+		return params, errors.New(i18n.Show(GetLang(c), `param_invalid`, `graph_status`))
+	}
+	if params.MmrLambda < 0 || params.MmrLambda > 1 {
+		return params, errors.New(i18n.Show(GetLang(c), `param_invalid`, `mmr_lambda`))
+	}
+	if params.MinFusedScore < 0 || params.MinFusedScore > 1 {
+		return params, errors.New(i18n.Show(GetLang(c), `param_invalid`, `min_fused_score`))
+	}
+	return params, nil
+}
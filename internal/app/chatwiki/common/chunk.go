@@ -0,0 +1,105 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/tmc/langchaingo/textsplitter"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+var childChunkSeparators = []string{"\n\n", "\n", `。`, `！`, `？`, `；`, `. `, `! `, `? `, `; `, `，`, `, `, ` `, ``}
+
+// IsParentChildLibrary parent sections are stored as paragraphs, only the child chunks are vectorized.
+// Both library info and file info carry the enable_parent_child and child_chunk_size fields
+func IsParentChildLibrary(info msql.Params) bool {
+	return cast.ToInt(info[`enable_parent_child`]) == define.SwitchOn && cast.ToInt(info[`child_chunk_size`]) > 0
+}
+
+func SplitChildChunks(content string, childChunkSize int) []string {
+	split := textsplitter.NewRecursiveCharacter()
+	split.Separators = childChunkSeparators
+	split.ChunkSize = childChunkSize
+	split.ChunkOverlap = 0
+	chunks, _ := split.SplitText(content)
+	list := make([]string, 0)
+	for _, chunk := range chunks {
+		if chunk = strings.TrimSpace(chunk); len(chunk) > 0 {
+			list = append(list, chunk)
+		}
+	}
+	if len(list) == 0 {
+		list = append(list, strings.TrimSpace(content))
+	}
+	return list
+}
+
+// GetEmbedText the section breadcrumb of the structure split is embedded along with the content
+func GetEmbedText(title, content string) string {
+	if title = strings.TrimSpace(title); len(title) == 0 {
+		return content
+	}
+	return title + "\n" + content
+}
+
+// SaveParagraphVector save the index of a normal paragraph according to the library chunk mode
+func SaveParagraphVector(info msql.Params, adminUserID, libraryID, fileID, dataID int64, title, content string) ([]int64, error) {
+	m := msql.Model(`chat_ai_library_file_data_index`, define.Postgres)
+	if !IsParentChildLibrary(info) {
+		//switch back from parent child mode
+		_, err := m.Where(`data_id`, cast.ToString(dataID)).Where(`type`, cast.ToString(define.VectorTypeChild)).Delete()
+		if err != nil {
+			logs.Error(err.Error())
+			return nil, err
+		}
+		vectorID, err := SaveVector(adminUserID, libraryID, fileID, dataID, cast.ToString(define.VectorTypeParagraph), GetEmbedText(title, content))
+		if err != nil {
+			return nil, err
+		}
+		return []int64{vectorID}, nil
+	}
+	chunks := SplitChildChunks(content, cast.ToInt(info[`child_chunk_size`]))
+	for i := range chunks {
+		chunks[i] = GetEmbedText(title, chunks[i])
+	}
+	olds, err := m.Where(`data_id`, cast.ToString(dataID)).Where(`type`, cast.ToString(define.VectorTypeChild)).
+		Order(`id`).ColumnArr(`content`)
+	if err != nil {
+		logs.Error(err.Error())
+		return nil, err
+	}
+	if strings.Join(olds, "\x00") == strings.Join(chunks, "\x00") {
+		return nil, nil //no change
+	}
+	_, err = m.Where(`data_id`, cast.ToString(dataID)).Where(`type`, `in`,
+		cast.ToString(define.VectorTypeParagraph)+`,`+cast.ToString(define.VectorTypeChild)).Delete()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil, err
+	}
+	vectorIds := make([]int64, 0, len(chunks))
+	for _, chunk := range chunks {
+		id, err := m.Insert(msql.Datas{
+			`admin_user_id`: adminUserID,
+			`library_id`:    libraryID,
+			`file_id`:       fileID,
+			`data_id`:       dataID,
+			`type`:          define.VectorTypeChild,
+			`content`:       chunk,
+			`status`:        define.VectorStatusInitial,
+			`create_time`:   tool.Time2Int(),
+			`update_time`:   tool.Time2Int(),
+		}, `id`)
+		if err != nil {
+			logs.Error(err.Error())
+			return nil, err
+		}
+		vectorIds = append(vectorIds, id)
+	}
+	return vectorIds, nil
+}
@@ -0,0 +1,96 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/pkg/lib_redis"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+// GetEmbeddingHash the update time of the model config is part of the hash,
+// so the vectors cached before the key,endpoint or dimension changed are never served
+func GetEmbeddingHash(modelConfigId int, useModel, input string) string {
+	version := ``
+	if config, err := GetModelConfigInfo(modelConfigId, 0); err != nil {
+		logs.Error(err.Error())
+	} else {
+		version = config[`update_time`]
+	}
+	return tool.MD5(fmt.Sprintf(`%d|%s|%s|%s`, modelConfigId, version, useModel, input))
+}
+
+func embeddingCacheTtl() time.Duration {
+	if ttl := cast.ToInt(define.Config.EmbeddingCache[`ttl`]); ttl > 0 {
+		return time.Second * time.Duration(ttl)
+	}
+	return time.Hour * 24
+}
+
+func embeddingPgPersist() bool {
+	return cast.ToInt(define.Config.EmbeddingCache[`pg_persist`]) == define.SwitchOn
+}
+
+// EmbeddingCacheBuildHandler the same text embedded by the same model is only requested once,
+// shared by retrieval and ingestion
+type EmbeddingCacheBuildHandler struct {
+	AdminUserId   int
+	Openid        string
+	Robot         msql.Params
+	Library       msql.Params
+	File          msql.Params
+	ModelConfigId int
+	UseModel      string
+	Input         string
+}
+
+func (h *EmbeddingCacheBuildHandler) GetCacheKey() string {
+	return fmt.Sprintf(`chatwiki.embedding.%s`, GetEmbeddingHash(h.ModelConfigId, h.UseModel, h.Input))
+}
+func (h *EmbeddingCacheBuildHandler) GetCacheData() (any, error) {
+	hash := GetEmbeddingHash(h.ModelConfigId, h.UseModel, h.Input)
+	if embeddingPgPersist() {
+		embedding, err := msql.Model(`chat_ai_embedding_cache`, define.Postgres).Where(`hash`, hash).Value(`embedding::text`)
+		if err != nil {
+			logs.Error(err.Error())
+		} else if len(embedding) > 0 {
+			return embedding, nil
+		}
+	}
+	handler, err := GetModelCallHandler(h.ModelConfigId, h.UseModel)
+	if err != nil {
+		return nil, err
+	}
+	embedding, err := handler.GetVector2000(h.AdminUserId, h.Openid, h.Robot, h.Library, h.File, h.Input)
+	if err != nil {
+		return nil, err
+	}
+	if embeddingPgPersist() {
+		_, err = msql.RawExec(define.Postgres, `INSERT INTO "chat_ai_embedding_cache" ("hash","model_config_id","use_model","embedding","create_time","update_time") `+
+			`VALUES ($1,$2,$3,$4,$5,$5) ON CONFLICT ("hash") DO NOTHING`, nil, hash, h.ModelConfigId, h.UseModel, embedding, tool.Time2Int())
+		if err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	return embedding, nil
+}
+
+// DeleteEmbeddingCache the persisted vectors of the model config,
+// the redis keys of the old config version expire by themselves
+func DeleteEmbeddingCache(modelConfigId int) {
+	if _, err := msql.Model(`chat_ai_embedding_cache`, define.Postgres).Where(`model_config_id`, cast.ToString(modelConfigId)).Delete(); err != nil {
+		logs.Error(err.Error())
+	}
+}
+
+func getVector2000WithCache(h *EmbeddingCacheBuildHandler) (string, error) {
+	var embedding string
+	err := lib_redis.GetCacheWithBuild(define.Redis, h, &embedding, embeddingCacheTtl())
+	return embedding, err
+}
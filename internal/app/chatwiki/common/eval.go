@@ -0,0 +1,136 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+// EvalAnswerMatchRate a paragraph contains the expected answer when it covers this rate of the answer bigrams
+const EvalAnswerMatchRate = 0.6
+
+func evalBigrams(text string) map[string]struct{} {
+	runes := make([]rune, 0)
+	for _, r := range strings.ToLower(text) {
+		if !unicode.IsSpace(r) && !unicode.IsPunct(r) {
+			runes = append(runes, r)
+		}
+	}
+	bigrams := make(map[string]struct{})
+	if len(runes) == 1 {
+		bigrams[string(runes)] = struct{}{}
+	}
+	for i := 0; i+1 < len(runes); i++ {
+		bigrams[string(runes[i:i+2])] = struct{}{}
+	}
+	return bigrams
+}
+
+func IsEvalAnswerMatch(content, answer string) bool {
+	if strings.Contains(content, answer) {
+		return true
+	}
+	answerBigrams, contentBigrams := evalBigrams(answer), evalBigrams(content)
+	if len(answerBigrams) == 0 {
+		return false
+	}
+	var hit int
+	for bigram := range answerBigrams {
+		if _, ok := contentBigrams[bigram]; ok {
+			hit++
+		}
+	}
+	return float64(hit)/float64(len(answerBigrams)) >= EvalAnswerMatchRate
+}
+
+// EvalQuestionMetrics recall@k,reciprocal rank and nDCG@k with binary relevance.
+// expected paragraph ids take precedence,otherwise the expected answer text is matched
+func EvalQuestionMetrics(list []msql.Params, k int, expectedIds []string, expectedAnswer string) (recall, rr, ndcg float64) {
+	relevantTotal := len(expectedIds)
+	if relevantTotal == 0 {
+		relevantTotal = 1
+	}
+	var hit int
+	var dcg float64
+	for i, one := range list {
+		var relevant bool
+		if len(expectedIds) > 0 {
+			relevant = tool.InArrayString(one[`id`], expectedIds)
+		} else {
+			relevant = IsEvalAnswerMatch(one[`content`]+one[`question`]+one[`answer`], expectedAnswer)
+		}
+		if !relevant {
+			continue
+		}
+		if hit < relevantTotal {
+			hit++
+			dcg += 1 / math.Log2(float64(i+2))
+		}
+		if rr == 0 {
+			rr = 1 / float64(i+1)
+		}
+	}
+	var idcg float64
+	for i := 0; i < min(relevantTotal, k); i++ {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+	if idcg > 0 {
+		ndcg = dcg / idcg
+	}
+	return float64(hit) / float64(relevantTotal), rr, ndcg
+}
+
+func RunLibraryEval(run msql.Params, configs []define.EvalConfig) ([]define.EvalResult, error) {
+	questions, err := msql.Model(`chat_ai_library_eval_question`, define.Postgres).
+		Where(`dataset_id`, run[`dataset_id`]).Order(`id`).Select()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]define.EvalResult, 0, len(configs))
+	for _, config := range configs {
+		robot := msql.Params{`admin_user_id`: run[`admin_user_id`]}
+		if config.RerankModelConfigId > 0 {
+			robot[`rerank_status`] = cast.ToString(define.SwitchOn)
+			robot[`rerank_model_config_id`] = cast.ToString(config.RerankModelConfigId)
+			robot[`rerank_use_model`] = config.RerankUseModel
+		}
+		result := define.EvalResult{Config: config}
+		for _, question := range questions {
+			expectedIds := make([]string, 0)
+			for _, id := range strings.Split(question[`expected_paragraph_ids`], `,`) {
+				if id = strings.TrimSpace(id); len(id) > 0 {
+					expectedIds = append(expectedIds, id)
+				}
+			}
+			if len(expectedIds) == 0 && len(question[`expected_answer`]) == 0 {
+				continue
+			}
+			result.QuestionTotal++
+			list, err := GetMatchLibraryParagraphList(``, ``, question[`question`], nil, nil, run[`library_id`], config.Size, config.Similarity, config.SearchType, robot)
+			if err != nil {
+				logs.Error(err.Error())
+				result.ErrorTotal++ //counted as a miss
+				continue
+			}
+			recall, rr, ndcg := EvalQuestionMetrics(list, config.Size, expectedIds, question[`expected_answer`])
+			result.Recall += recall
+			result.MRR += rr
+			result.NDCG += ndcg
+		}
+		if result.QuestionTotal > 0 {
+			result.Recall /= float64(result.QuestionTotal)
+			result.MRR /= float64(result.QuestionTotal)
+			result.NDCG /= float64(result.QuestionTotal)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,541 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+	"github.com/zhimaAi/llm_adaptor/adaptor"
+)
+
+// IsGraphLibrary entities and relations are extracted from the paragraphs by the llm at ingest time
+func IsGraphLibrary(library msql.Params) bool {
+	return cast.ToInt(library[`graph_status`]) == define.SwitchOn && cast.ToInt(library[`graph_model_config_id`]) > 0
+}
+
+// AddGraphExtractJobs the task skips the paragraphs whose content has not changed since the last extraction
+func AddGraphExtractJobs(library msql.Params, dataIds []int64, force bool) {
+	if !IsGraphLibrary(library) {
+		return
+	}
+	for _, dataId := range dataIds {
+		if message, err := tool.JsonEncode(map[string]any{`data_id`: dataId, `force`: force}); err != nil {
+			logs.Error(err.Error())
+		} else if err := AddJobs(define.GraphExtractTopic, message); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+}
+
+// NormalizeGraphName entity resolution key:lower case without spaces,punctuations and symbols
+func NormalizeGraphName(name string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+func GetGraphParagraphText(paragraph msql.Params) string {
+	if cast.ToInt(paragraph[`type`]) == define.ParagraphTypeNormal {
+		return paragraph[`content`]
+	}
+	return paragraph[`question`] + "\n" + paragraph[`answer`]
+}
+
+func ExtractParagraphGraph(library, paragraph msql.Params) (define.GraphExtractResult, error) {
+	result := define.GraphExtractResult{}
+	prompt := strings.ReplaceAll(define.PromptDefaultGraphExtract, `{{content}}`, GetGraphParagraphText(paragraph))
+	messages := []adaptor.ZhimaChatCompletionMessage{{Role: `user`, Content: prompt}}
+	chatResp, _, err := RequestChat(
+		cast.ToInt(paragraph[`admin_user_id`]),
+		``,
+		msql.Params{},
+		``,
+		cast.ToInt(library[`graph_model_config_id`]),
+		library[`graph_use_model`],
+		messages,
+		nil,
+		0.1,
+		2000,
+	)
+	if err != nil {
+		return result, err
+	}
+	start, end := strings.Index(chatResp.Result, `{`), strings.LastIndex(chatResp.Result, `}`)
+	if start < 0 || end <= start {
+		return result, errors.New(`graph extract result is not a json object:` + chatResp.Result)
+	}
+	err = tool.JsonDecode(chatResp.Result[start:end+1], &result)
+	return result, err
+}
+
+func saveGraphAlias(libraryId, entityId int, alias string) error {
+	_, err := msql.RawExec(define.Postgres, `INSERT INTO "chat_ai_library_graph_alias" ("library_id","entity_id","alias") `+
+		`VALUES ($1,$2,$3) ON CONFLICT ("library_id","alias") DO NOTHING`, nil, libraryId, entityId, alias)
+	return err
+}
+
+// resolveGraphEntity the entity whose name or alias is already known in the library is merged
+func resolveGraphEntity(adminUserId, libraryId int, entity define.GraphEntity) (int, error) {
+	keys := make([]string, 0)
+	for _, name := range append([]string{entity.Name}, entity.Aliases...) {
+		key := NormalizeGraphName(name)
+		if len(key) == 0 || utf8.RuneCountInString(key) > define.GraphEntityNameMaxLen || tool.InArrayString(key, keys) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	m := msql.Model(`chat_ai_library_graph_alias`, define.Postgres)
+	var entityId int
+	for _, key := range keys {
+		id, err := m.Where(`library_id`, cast.ToString(libraryId)).Where(`alias`, key).Value(`entity_id`)
+		if err != nil {
+			return 0, err
+		}
+		if entityId = cast.ToInt(id); entityId > 0 {
+			break
+		}
+	}
+	em := msql.Model(`chat_ai_library_graph_entity`, define.Postgres)
+	description := MbSubstr(strings.TrimSpace(entity.Description), 0, 1000)
+	if entityId == 0 {
+		id, err := em.Insert(msql.Datas{
+			`admin_user_id`: adminUserId,
+			`library_id`:    libraryId,
+			`name`:          MbSubstr(strings.TrimSpace(entity.Name), 0, define.GraphEntityNameMaxLen),
+			`type`:          MbSubstr(strings.TrimSpace(entity.Type), 0, 50),
+			`description`:   description,
+			`create_time`:   tool.Time2Int(),
+			`update_time`:   tool.Time2Int(),
+		}, `id`)
+		if err != nil {
+			return 0, err
+		}
+		entityId = int(id)
+	} else if len(description) > 0 {
+		_, err := em.Where(`id`, cast.ToString(entityId)).Where(`description`, ``).
+			Update(msql.Datas{`description`: description, `update_time`: tool.Time2Int()})
+		if err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	for _, key := range keys {
+		if err := saveGraphAlias(libraryId, entityId, key); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	return entityId, nil
+}
+
+// SaveParagraphGraph replace the mentions and relations extracted from the paragraph
+func SaveParagraphGraph(paragraph msql.Params, result define.GraphExtractResult, hash string) error {
+	adminUserId, libraryId := cast.ToInt(paragraph[`admin_user_id`]), cast.ToInt(paragraph[`library_id`])
+	for _, table := range []string{`chat_ai_library_graph_mention`, `chat_ai_library_graph_relation`} {
+		if _, err := msql.Model(table, define.Postgres).Where(`data_id`, paragraph[`id`]).Delete(); err != nil {
+			return err
+		}
+	}
+	entityIds := make(map[string]int)
+	getEntityId := func(entity define.GraphEntity) (int, error) {
+		key := NormalizeGraphName(entity.Name)
+		if id, ok := entityIds[key]; ok {
+			return id, nil
+		}
+		id, err := resolveGraphEntity(adminUserId, libraryId, entity)
+		if err != nil {
+			return 0, err
+		}
+		if id > 0 {
+			entityIds[key] = id
+		}
+		return id, nil
+	}
+	mentioned := make(map[int]struct{})
+	saveMention := func(entityId int) error {
+		if _, ok := mentioned[entityId]; ok || entityId == 0 {
+			return nil
+		}
+		mentioned[entityId] = struct{}{}
+		_, err := msql.Model(`chat_ai_library_graph_mention`, define.Postgres).Insert(msql.Datas{
+			`library_id`: libraryId,
+			`file_id`:    paragraph[`file_id`],
+			`data_id`:    paragraph[`id`],
+			`entity_id`:  entityId,
+		})
+		return err
+	}
+	for _, entity := range result.Entities {
+		entityId, err := getEntityId(entity)
+		if err != nil {
+			return err
+		}
+		if err = saveMention(entityId); err != nil {
+			return err
+		}
+	}
+	for _, relation := range result.Relations {
+		sourceId, err := getEntityId(define.GraphEntity{Name: relation.Source})
+		if err != nil {
+			return err
+		}
+		targetId, err := getEntityId(define.GraphEntity{Name: relation.Target})
+		if err != nil {
+			return err
+		}
+		if sourceId == 0 || targetId == 0 || sourceId == targetId {
+			continue
+		}
+		for _, entityId := range []int{sourceId, targetId} {
+			if err = saveMention(entityId); err != nil {
+				return err
+			}
+		}
+		_, err = msql.Model(`chat_ai_library_graph_relation`, define.Postgres).Insert(msql.Datas{
+			`library_id`: libraryId,
+			`file_id`:    paragraph[`file_id`],
+			`data_id`:    paragraph[`id`],
+			`source_id`:  sourceId,
+			`target_id`:  targetId,
+			`relation`:   MbSubstr(strings.TrimSpace(relation.Relation), 0, 200),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := msql.Model(`chat_ai_library_file_data`, define.Postgres).Where(`id`, paragraph[`id`]).Update(msql.Datas{`graph_hash`: hash})
+	if err != nil {
+		return err
+	}
+	//the community summaries are rebuilt by the crontab
+	_, err = msql.Model(`chat_ai_library`, define.Postgres).Where(`id`, cast.ToString(libraryId)).Update(msql.Datas{`graph_dirty`: define.SwitchOn})
+	return err
+}
+
+// DeleteParagraphGraph remove the mentions and relations of the deleted paragraphs or files by data_id or file_id,
+// the orphan entities and the community summaries are rebuilt by the graph community job
+func DeleteParagraphGraph(field, ids string) error {
+	libraryIds, err := msql.Model(`chat_ai_library_graph_mention`, define.Postgres).Where(field, `in`, ids).ColumnArr(`library_id`)
+	if err != nil {
+		return err
+	}
+	if len(libraryIds) == 0 {
+		return nil
+	}
+	for _, table := range []string{`chat_ai_library_graph_mention`, `chat_ai_library_graph_relation`} {
+		if _, err = msql.Model(table, define.Postgres).Where(field, `in`, ids).Delete(); err != nil {
+			return err
+		}
+	}
+	_, err = msql.Model(`chat_ai_library`, define.Postgres).Where(`id`, `in`, tool.GetStringUnique(strings.Join(libraryIds, `,`), `,`)).
+		Update(msql.Datas{`graph_dirty`: define.SwitchOn})
+	return err
+}
+
+func ClearLibraryGraph(libraryId int) {
+	for _, table := range []string{`chat_ai_library_graph_entity`, `chat_ai_library_graph_alias`, `chat_ai_library_graph_mention`,
+		`chat_ai_library_graph_relation`, `chat_ai_library_graph_community`} {
+		if _, err := msql.Model(table, define.Postgres).Where(`library_id`, cast.ToString(libraryId)).Delete(); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+}
+
+// cleanLibraryGraph remove the data of deleted paragraphs and the entities no longer mentioned
+func cleanLibraryGraph(libraryId int) error {
+	paragraphIds := fmt.Sprintf(`data_id not in (select id from chat_ai_library_file_data where library_id=%d)`, libraryId)
+	for _, table := range []string{`chat_ai_library_graph_mention`, `chat_ai_library_graph_relation`} {
+		_, err := msql.Model(table, define.Postgres).Where(`library_id`, cast.ToString(libraryId)).Where(paragraphIds).Delete()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := msql.Model(`chat_ai_library_graph_entity`, define.Postgres).Where(`library_id`, cast.ToString(libraryId)).
+		Where(fmt.Sprintf(`id not in (select entity_id from chat_ai_library_graph_mention where library_id=%d)`, libraryId)).Delete()
+	if err != nil {
+		return err
+	}
+	_, err = msql.Model(`chat_ai_library_graph_alias`, define.Postgres).Where(`library_id`, cast.ToString(libraryId)).
+		Where(fmt.Sprintf(`entity_id not in (select id from chat_ai_library_graph_entity where library_id=%d)`, libraryId)).Delete()
+	return err
+}
+
+func findGraphRoot(parents map[string]string, id string) string {
+	for parents[id] != id {
+		parents[id] = parents[parents[id]]
+		id = parents[id]
+	}
+	return id
+}
+
+// summarizeGraphCommunity summarize the community by the llm and save it
+func summarizeGraphCommunity(library msql.Params, entities map[string]msql.Params, relations []msql.Params, degrees map[string]int, ids []string, memberHash string) (int64, error) {
+	//large communities are summarized by the most connected entities
+	sorted := append([]string{}, ids...)
+	sort.SliceStable(sorted, func(i, j int) bool { return degrees[sorted[i]] > degrees[sorted[j]] })
+	selected := sorted[:min(len(sorted), define.GraphCommunityMaxEntity)]
+	entityLines, relationLines := make([]string, 0), make([]string, 0)
+	for _, id := range selected {
+		entityLines = append(entityLines, fmt.Sprintf(`%s(%s):%s`, entities[id][`name`], entities[id][`type`], entities[id][`description`]))
+	}
+	for _, relation := range relations {
+		if tool.InArrayString(relation[`source_id`], selected) && tool.InArrayString(relation[`target_id`], selected) {
+			relationLines = append(relationLines, fmt.Sprintf(`%s -> %s -> %s`,
+				entities[relation[`source_id`]][`name`], relation[`relation`], entities[relation[`target_id`]][`name`]))
+		}
+	}
+	prompt := strings.ReplaceAll(define.PromptDefaultGraphCommunity, `{{entities}}`, strings.Join(entityLines, "\n"))
+	prompt = strings.ReplaceAll(prompt, `{{relations}}`, strings.Join(relationLines[:min(len(relationLines), 100)], "\n"))
+	chatResp, _, err := RequestChat(
+		cast.ToInt(library[`admin_user_id`]),
+		``,
+		msql.Params{},
+		``,
+		cast.ToInt(library[`graph_model_config_id`]),
+		library[`graph_use_model`],
+		[]adaptor.ZhimaChatCompletionMessage{{Role: `user`, Content: prompt}},
+		nil,
+		0.3,
+		800,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return msql.Model(`chat_ai_library_graph_community`, define.Postgres).Insert(msql.Datas{
+		`library_id`:   library[`id`],
+		`entity_total`: len(ids),
+		`member_hash`:  memberHash,
+		`summary`:      strings.TrimSpace(chatResp.Result),
+		`create_time`:  tool.Time2Int(),
+		`update_time`:  tool.Time2Int(),
+	}, `id`)
+}
+
+// BuildLibraryGraphCommunity the connected entities make up a community, summarized by the llm
+func BuildLibraryGraphCommunity(library msql.Params) error {
+	libraryId := cast.ToInt(library[`id`])
+	//reset first,the paragraphs extracted during building mark it again
+	_, err := msql.Model(`chat_ai_library`, define.Postgres).Where(`id`, library[`id`]).Update(msql.Datas{`graph_dirty`: define.SwitchOff})
+	if err != nil {
+		return err
+	}
+	if err = cleanLibraryGraph(libraryId); err != nil {
+		return err
+	}
+	entities, err := msql.Model(`chat_ai_library_graph_entity`, define.Postgres).Where(`library_id`, library[`id`]).
+		ColumnMap(`id,name,type,description`, `id`)
+	if err != nil {
+		return err
+	}
+	relations, err := msql.Model(`chat_ai_library_graph_relation`, define.Postgres).Where(`library_id`, library[`id`]).
+		Field(`source_id,target_id,relation`).Select()
+	if err != nil {
+		return err
+	}
+	parents, degrees := make(map[string]string), make(map[string]int)
+	for id := range entities {
+		parents[id] = id
+	}
+	for _, relation := range relations {
+		if _, ok := parents[relation[`source_id`]]; !ok {
+			continue
+		}
+		if _, ok := parents[relation[`target_id`]]; !ok {
+			continue
+		}
+		degrees[relation[`source_id`]]++
+		degrees[relation[`target_id`]]++
+		parents[findGraphRoot(parents, relation[`source_id`])] = findGraphRoot(parents, relation[`target_id`])
+	}
+	communities := make(map[string][]string)
+	for id := range entities {
+		root := findGraphRoot(parents, id)
+		communities[root] = append(communities[root], id)
+	}
+	//the summaries of the communities whose members are unchanged are kept
+	olds, err := msql.Model(`chat_ai_library_graph_community`, define.Postgres).Where(`library_id`, library[`id`]).
+		Field(`id,member_hash`).Select()
+	if err != nil {
+		return err
+	}
+	oldMap, keptIds := make(map[string]string), make([]string, 0)
+	for _, old := range olds {
+		if len(old[`member_hash`]) > 0 {
+			oldMap[old[`member_hash`]] = old[`id`]
+		}
+	}
+	_, err = msql.Model(`chat_ai_library_graph_entity`, define.Postgres).Where(`library_id`, library[`id`]).Update(msql.Datas{`community_id`: 0})
+	if err != nil {
+		return err
+	}
+	for _, ids := range communities {
+		if len(ids) < define.GraphCommunityMinEntity {
+			continue
+		}
+		sort.Strings(ids)
+		memberHash := tool.MD5(strings.Join(ids, `,`))
+		var communityId int64
+		if oldId, ok := oldMap[memberHash]; ok {
+			communityId = cast.ToInt64(oldId)
+			delete(oldMap, memberHash)
+		} else if communityId, err = summarizeGraphCommunity(library, entities, relations, degrees, ids, memberHash); err != nil {
+			logs.Error(err.Error())
+			continue
+		}
+		keptIds = append(keptIds, cast.ToString(communityId))
+		_, err = msql.Model(`chat_ai_library_graph_entity`, define.Postgres).Where(`id`, `in`, strings.Join(ids, `,`)).
+			Update(msql.Datas{`community_id`: communityId})
+		if err != nil {
+			return err
+		}
+	}
+	//the communities split,merged or gone
+	m := msql.Model(`chat_ai_library_graph_community`, define.Postgres).Where(`library_id`, library[`id`])
+	if len(keptIds) > 0 {
+		m.Where(`id`, `not in`, strings.Join(keptIds, `,`))
+	}
+	if _, err = m.Delete(); err != nil {
+		return err
+	}
+	_, err = msql.Model(`chat_ai_library`, define.Postgres).Where(`id`, library[`id`]).Update(msql.Datas{`graph_community_time`: tool.Time2Int()})
+	return err
+}
+
+// buildGraphAliasQuery the aliases contained in the question,the question is bound as a parameter
+func buildGraphAliasQuery(libraryIds, question string) (string, []any) {
+	return `SELECT entity_id FROM "chat_ai_library_graph_alias" ` +
+		`WHERE library_id=ANY(string_to_array($1,',')::int[]) AND strpos($2,alias)>0 AND char_length(alias)>=2 ` +
+		`ORDER BY char_length(alias) desc LIMIT $3`, []any{libraryIds, question, define.GraphSeedEntityLimit}
+}
+
+// GetMatchLibraryParagraphByGraph expand the entities found in the question to the related paragraphs,
+// the summaries of their communities are carried in graph_summary
+func GetMatchLibraryParagraphByGraph(question, libraryIds string, size int, robot msql.Params) ([]msql.Params, error) {
+	list := make([]msql.Params, 0)
+	if GetRankParams(robot).GraphStatus != define.SwitchOn {
+		return list, nil
+	}
+	graphLibraryIds := make([]string, 0)
+	for _, libraryId := range strings.Split(libraryIds, `,`) {
+		library, err := GetLibraryInfo(cast.ToInt(libraryId), 0)
+		if err != nil {
+			logs.Error(err.Error())
+			continue
+		}
+		if IsGraphLibrary(library) {
+			graphLibraryIds = append(graphLibraryIds, libraryId)
+		}
+	}
+	query := NormalizeGraphName(question)
+	if len(graphLibraryIds) == 0 || len(query) == 0 {
+		return list, nil
+	}
+	aliasQuery, args := buildGraphAliasQuery(strings.Join(graphLibraryIds, `,`), query)
+	aliases, err := msql.RawValues(define.Postgres, aliasQuery, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	seedIds := make([]string, 0)
+	for _, alias := range aliases {
+		if !tool.InArrayString(alias[`entity_id`], seedIds) {
+			seedIds = append(seedIds, alias[`entity_id`])
+		}
+	}
+	if len(seedIds) == 0 {
+		return list, nil
+	}
+	seeds := strings.Join(seedIds, `,`)
+	scores := make(map[string]float64)
+	mentions, err := msql.Model(`chat_ai_library_graph_mention`, define.Postgres).
+		Where(`entity_id`, `in`, seeds).Field(`data_id`).Limit(500).Select()
+	if err != nil {
+		return nil, err
+	}
+	for _, mention := range mentions {
+		scores[mention[`data_id`]] += 1
+	}
+	//one hop:the paragraphs describing the relations and mentioning the neighbors
+	relations, err := msql.Model(`chat_ai_library_graph_relation`, define.Postgres).
+		Where(fmt.Sprintf(`(source_id in (%s) or target_id in (%s))`, seeds, seeds)).
+		Field(`source_id,target_id,data_id`).Limit(500).Select()
+	if err != nil {
+		return nil, err
+	}
+	neighborIds := make([]string, 0)
+	for _, relation := range relations {
+		scores[relation[`data_id`]] += 1
+		for _, id := range []string{relation[`source_id`], relation[`target_id`]} {
+			if !tool.InArrayString(id, seedIds) && !tool.InArrayString(id, neighborIds) {
+				neighborIds = append(neighborIds, id)
+			}
+		}
+	}
+	if len(neighborIds) > 0 {
+		mentions, err = msql.Model(`chat_ai_library_graph_mention`, define.Postgres).
+			Where(`entity_id`, `in`, strings.Join(neighborIds, `,`)).Field(`data_id`).Limit(500).Select()
+		if err != nil {
+			return nil, err
+		}
+		for _, mention := range mentions {
+			scores[mention[`data_id`]] += 0.5
+		}
+	}
+	dataIds := make([]string, 0, len(scores))
+	var maxScore float64
+	for dataId, score := range scores {
+		dataIds = append(dataIds, dataId)
+		maxScore = max(maxScore, score)
+	}
+	sort.Slice(dataIds, func(i, j int) bool {
+		if scores[dataIds[i]] != scores[dataIds[j]] {
+			return scores[dataIds[i]] > scores[dataIds[j]]
+		}
+		return cast.ToInt(dataIds[i]) < cast.ToInt(dataIds[j]) //the same score,the earlier paragraph first
+	})
+	dataIds = dataIds[:min(len(dataIds), size)]
+	paragraphs, err := msql.Model(`chat_ai_library_file_data`, define.Postgres).
+		Where(`id`, `in`, strings.Join(dataIds, `,`)).ColumnMap(`*`, `id`)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := msql.Model(`chat_ai_library_graph_community`, define.Postgres).
+		Where(fmt.Sprintf(`id in (select community_id from chat_ai_library_graph_entity where id in (%s))`, seeds)).
+		Where(`summary`, `<>`, ``).Order(`entity_total desc,id`).Limit(define.GraphCommunitySummaryMax).ColumnArr(`summary`)
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	for _, dataId := range dataIds {
+		if one, ok := paragraphs[dataId]; ok {
+			one[`similarity`] = cast.ToString(scores[dataId] / maxScore)
+			one[`graph_summary`] = strings.Join(summaries, "\n")
+			list = append(list, one)
+		}
+	}
+	return list, nil
+}
+
+// GetGraphSummary the community summaries attached to the matched paragraphs
+func GetGraphSummary(list []msql.Params) string {
+	for _, one := range list {
+		if len(one[`graph_summary`]) > 0 {
+			return one[`graph_summary`]
+		}
+	}
+	return ``
+}
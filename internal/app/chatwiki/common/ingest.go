@@ -0,0 +1,159 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"fmt"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+// the start time of each stage is saved in its own column
+var ingestStageTimeFields = map[int]string{
+	define.IngestStageCrawl:   `crawl_time`,
+	define.IngestStageConvert: `convert_time`,
+	define.IngestStageSplit:   `split_time`,
+	define.IngestStageEmbed:   `embed_time`,
+}
+
+func getRunningIngestJob(fileId int) (msql.Params, error) {
+	return msql.Model(`chat_ai_library_file_ingest`, define.Postgres).
+		Where(`file_id`, cast.ToString(fileId)).
+		Where(`status`, cast.ToString(define.IngestStatusRunning)).
+		Order(`id desc`).Find()
+}
+
+// StartIngestJob a new ingestion of the file,the unfinished one is cancelled.
+// The tracking errors are only logged,they never stop the learning
+func StartIngestJob(fileId, stage int) {
+	info, err := GetLibFileInfo(fileId, 0)
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	if len(info) == 0 {
+		return
+	}
+	m := msql.Model(`chat_ai_library_file_ingest`, define.Postgres)
+	_, err = m.Where(`file_id`, cast.ToString(fileId)).
+		Where(`status`, cast.ToString(define.IngestStatusRunning)).
+		Update(msql.Datas{
+			`status`:      define.IngestStatusCancelled,
+			`finish_time`: tool.Time2Int(),
+			`update_time`: tool.Time2Int(),
+		})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	_, err = m.Insert(msql.Datas{
+		`admin_user_id`:              info[`admin_user_id`],
+		`library_id`:                 info[`library_id`],
+		`file_id`:                    fileId,
+		`stage`:                      stage,
+		`status`:                     define.IngestStatusRunning,
+		ingestStageTimeFields[stage]: tool.Time2Int(),
+		`create_time`:                tool.Time2Int(),
+		`update_time`:                tool.Time2Int(),
+	})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
+
+// SetIngestStage move the running ingestion to the stage,a job is started when there is none
+func SetIngestStage(fileId, stage int) {
+	job, err := getRunningIngestJob(fileId)
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	if len(job) == 0 {
+		StartIngestJob(fileId, stage)
+		return
+	}
+	if cast.ToInt(job[`stage`]) == stage {
+		return
+	}
+	_, err = msql.Model(`chat_ai_library_file_ingest`, define.Postgres).Where(`id`, job[`id`]).Update(msql.Datas{
+		`stage`:                      stage,
+		ingestStageTimeFields[stage]: tool.Time2Int(),
+		`update_time`:                tool.Time2Int(),
+	})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
+
+// SetIngestEmbed the paragraphs are saved,the job is finished when nothing needs embedding
+func SetIngestEmbed(fileId, paragraphTotal, embedTotal int) {
+	SetIngestStage(fileId, define.IngestStageEmbed)
+	_, err := msql.Model(`chat_ai_library_file_ingest`, define.Postgres).
+		Where(`file_id`, cast.ToString(fileId)).
+		Where(`status`, cast.ToString(define.IngestStatusRunning)).
+		Update(msql.Datas{
+			`paragraph_total`: paragraphTotal,
+			`embed_total`:     embedTotal,
+			`update_time`:     tool.Time2Int(),
+		})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	if embedTotal == 0 {
+		FinishIngestJob(fileId)
+	}
+}
+
+// AddIngestEmbedded count the converted vectors,the error of the last failed one is kept
+func AddIngestEmbedded(fileId, embedded, failed int, errmsg string) {
+	m := msql.Model(`chat_ai_library_file_ingest`, define.Postgres)
+	_, err := m.Where(`file_id`, cast.ToString(fileId)).
+		Where(`status`, cast.ToString(define.IngestStatusRunning)).
+		Update2(fmt.Sprintf(`embedded_total=embedded_total+%d,failed_total=failed_total+%d,update_time=%d`,
+			embedded, failed, tool.Time2Int()))
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	if failed == 0 {
+		return
+	}
+	_, err = m.Where(`file_id`, cast.ToString(fileId)).
+		Where(`status`, cast.ToString(define.IngestStatusRunning)).
+		Update(msql.Datas{`errmsg`: MbSubstr(errmsg, 0, 1000)})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
+
+func FinishIngestJob(fileId int) {
+	_, err := msql.Model(`chat_ai_library_file_ingest`, define.Postgres).
+		Where(`file_id`, cast.ToString(fileId)).
+		Where(`status`, cast.ToString(define.IngestStatusRunning)).
+		Update(msql.Datas{
+			`status`:      define.IngestStatusFinished,
+			`finish_time`: tool.Time2Int(),
+			`update_time`: tool.Time2Int(),
+		})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
+
+// FailIngestJob the stage where the job failed is kept
+func FailIngestJob(fileId int, errmsg string) {
+	_, err := msql.Model(`chat_ai_library_file_ingest`, define.Postgres).
+		Where(`file_id`, cast.ToString(fileId)).
+		Where(`status`, cast.ToString(define.IngestStatusRunning)).
+		Update(msql.Datas{
+			`status`:      define.IngestStatusFailed,
+			`errmsg`:      MbSubstr(errmsg, 0, 1000),
+			`finish_time`: tool.Time2Int(),
+			`update_time`: tool.Time2Int(),
+		})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_redis"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+type LibFileVersionParagraph struct {
+	Type     int      `json:"type"`
+	Number   int      `json:"number"`
+	PageNum  int      `json:"page_num"`
+	Title    string   `json:"title"`
+	Content  string   `json:"content"`
+	Question string   `json:"question"`
+	Answer   string   `json:"answer"`
+	Images   []string `json:"images"`
+}
+
+func (p LibFileVersionParagraph) hash() string {
+	return GetParagraphHash(p.Type, p.Content, p.Question, p.Answer)
+}
+
+// SaveLibFileVersion snapshot the source,the split params and the paragraphs of the learned file.
+// Only the last define.LibFileVersionKeep versions are kept
+func SaveLibFileVersion(fileId, qaIndexType int, splitParams define.SplitParams) {
+	info, err := GetLibFileInfo(fileId, 0)
+	if err != nil || len(info) == 0 {
+		logs.Error(`file version %d:%v`, fileId, err)
+		return
+	}
+	paragraphs, err := getLibFileParagraphs(fileId)
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	paragraphsJson, err := tool.JsonEncode(paragraphs)
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	paramsJson, err := tool.JsonEncode(splitParams)
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	if qaIndexType == 0 {
+		qaIndexType = cast.ToInt(info[`qa_index_type`])
+	}
+	m := msql.Model(`chat_ai_library_file_version`, define.Postgres)
+	version, err := m.Where(`file_id`, cast.ToString(fileId)).Max(`version`)
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	_, err = m.Insert(msql.Datas{
+		`admin_user_id`:   info[`admin_user_id`],
+		`library_id`:      info[`library_id`],
+		`file_id`:         fileId,
+		`version`:         cast.ToInt(version) + 1,
+		`file_name`:       info[`file_name`],
+		`file_url`:        info[`file_url`],
+		`file_size`:       cast.ToInt(info[`file_size`]),
+		`file_hash`:       info[`file_hash`],
+		`html_url`:        info[`html_url`],
+		`split_params`:    paramsJson,
+		`qa_index_type`:   qaIndexType,
+		`word_total`:      cast.ToInt(info[`word_total`]),
+		`paragraph_total`: len(paragraphs),
+		`paragraphs`:      paragraphsJson,
+		`create_time`:     tool.Time2Int(),
+	})
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	_, err = m.Where(`file_id`, cast.ToString(fileId)).
+		Where(`version`, `<=`, cast.ToString(cast.ToInt(version)+1-define.LibFileVersionKeep)).Delete()
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
+
+// getLibFileParagraphs the paragraphs of the file in the current learning
+func getLibFileParagraphs(fileId int) ([]LibFileVersionParagraph, error) {
+	rows, err := msql.Model(`chat_ai_library_file_data`, define.Postgres).Where(`file_id`, cast.ToString(fileId)).
+		Field(`type,number,page_num,title,content,question,answer,images`).Order(`number,id`).Select()
+	if err != nil {
+		return nil, err
+	}
+	paragraphs := make([]LibFileVersionParagraph, 0, len(rows))
+	for _, row := range rows {
+		paragraph := LibFileVersionParagraph{
+			Type:     cast.ToInt(row[`type`]),
+			Number:   cast.ToInt(row[`number`]),
+			PageNum:  cast.ToInt(row[`page_num`]),
+			Title:    row[`title`],
+			Content:  row[`content`],
+			Question: row[`question`],
+			Answer:   row[`answer`],
+		}
+		_ = tool.JsonDecode(row[`images`], &paragraph.Images)
+		paragraphs = append(paragraphs, paragraph)
+	}
+	return paragraphs, nil
+}
+
+func toDocSplitItems(paragraphs []LibFileVersionParagraph) []define.DocSplitItem {
+	list := make([]define.DocSplitItem, 0, len(paragraphs))
+	for _, paragraph := range paragraphs {
+		list = append(list, define.DocSplitItem{
+			PageNum:  paragraph.PageNum,
+			Title:    paragraph.Title,
+			Content:  paragraph.Content,
+			Question: paragraph.Question,
+			Answer:   paragraph.Answer,
+			Images:   paragraph.Images,
+		})
+	}
+	return list
+}
+
+func GetLibFileVersionParagraphs(version msql.Params) ([]LibFileVersionParagraph, error) {
+	paragraphs := make([]LibFileVersionParagraph, 0)
+	err := tool.JsonDecode(version[`paragraphs`], &paragraphs)
+	return paragraphs, err
+}
+
+// DiffLibFileVersion the split params that changed and the paragraphs added or deleted from the old version to the new one,
+// the paragraphs are matched by the content hash like the incremental learning
+func DiffLibFileVersion(oldVersion, newVersion msql.Params) (map[string]any, error) {
+	oldParagraphs, err := GetLibFileVersionParagraphs(oldVersion)
+	if err != nil {
+		return nil, err
+	}
+	newParagraphs, err := GetLibFileVersionParagraphs(newVersion)
+	if err != nil {
+		return nil, err
+	}
+	pool := make(map[string][]LibFileVersionParagraph)
+	for _, paragraph := range oldParagraphs {
+		pool[paragraph.hash()] = append(pool[paragraph.hash()], paragraph)
+	}
+	added, unchanged, moved := make([]LibFileVersionParagraph, 0), 0, 0
+	for _, paragraph := range newParagraphs {
+		matches := pool[paragraph.hash()]
+		if len(matches) == 0 {
+			added = append(added, paragraph)
+			continue
+		}
+		pool[paragraph.hash()] = matches[1:]
+		if matches[0].Number == paragraph.Number && matches[0].PageNum == paragraph.PageNum && matches[0].Title == paragraph.Title {
+			unchanged++
+		} else {
+			moved++
+		}
+	}
+	deleted := make([]LibFileVersionParagraph, 0)
+	for _, matches := range pool {
+		deleted = append(deleted, matches...)
+	}
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].Number < deleted[j].Number })
+
+	oldParams, newParams := make(map[string]any), make(map[string]any)
+	_ = tool.JsonDecode(oldVersion[`split_params`], &oldParams)
+	_ = tool.JsonDecode(newVersion[`split_params`], &newParams)
+	oldParams[`qa_index_type`], newParams[`qa_index_type`] = oldVersion[`qa_index_type`], newVersion[`qa_index_type`]
+	params := make([]map[string]any, 0)
+	for key, value := range newParams {
+		if fmt.Sprint(oldParams[key]) != fmt.Sprint(value) {
+			params = append(params, map[string]any{`field`: key, `old`: oldParams[key], `new`: value})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool { return cast.ToString(params[i][`field`]) < cast.ToString(params[j][`field`]) })
+
+	return map[string]any{
+		`source_changed`:  oldVersion[`file_url`] != newVersion[`file_url`],
+		`params`:          params,
+		`unchanged_total`: unchanged,
+		`moved_total`:     moved,
+		`added`:           added,
+		`deleted`:         deleted,
+	}, nil
+}
+
+// RollbackLibFileVersion restore the source,the split params and the paragraphs of the version.
+// The paragraphs still in the file keep their vectors,the others are embedded through the embedding cache
+func RollbackLibFileVersion(userId int, version msql.Params, lang string) error {
+	fileId := cast.ToInt(version[`file_id`])
+	info, err := GetLibFileInfo(fileId, userId)
+	if err != nil {
+		logs.Error(err.Error())
+		return errors.New(i18n.Show(lang, `sys_err`))
+	}
+	if len(info) == 0 {
+		return errors.New(i18n.Show(lang, `no_data`))
+	}
+	if !tool.InArrayInt(cast.ToInt(info[`status`]), []int{define.FileStatusWaitSplit, define.FileStatusLearned, define.FileStatusLearnedWithErrors}) {
+		return errors.New(i18n.Show(lang, `status_exception`))
+	}
+	paragraphs, err := GetLibFileVersionParagraphs(version)
+	if err != nil {
+		logs.Error(err.Error())
+		return errors.New(i18n.Show(lang, `sys_err`))
+	}
+	splitParams := define.SplitParams{}
+	if err = tool.JsonDecode(version[`split_params`], &splitParams); err != nil {
+		logs.Error(err.Error())
+		return errors.New(i18n.Show(lang, `sys_err`))
+	}
+	splitParams.FileExt = info[`file_ext`]
+	//the current paragraphs are saved back when the rollback fails halfway
+	currents, err := getLibFileParagraphs(fileId)
+	if err != nil {
+		logs.Error(err.Error())
+		return errors.New(i18n.Show(lang, `sys_err`))
+	}
+	//wait split:the file is saved even if the params are the same as the current ones
+	_, err = msql.Model(`chat_ai_library_file`, define.Postgres).Where(`id`, cast.ToString(fileId)).Update(msql.Datas{
+		`file_name`:   version[`file_name`],
+		`file_url`:    version[`file_url`],
+		`file_size`:   cast.ToInt(version[`file_size`]),
+		`file_hash`:   version[`file_hash`],
+		`html_url`:    version[`html_url`],
+		`status`:      define.FileStatusWaitSplit,
+		`update_time`: tool.Time2Int(),
+	})
+	if err != nil {
+		logs.Error(err.Error())
+		return errors.New(i18n.Show(lang, `sys_err`))
+	}
+	//clear cached data
+	lib_redis.DelCacheData(define.Redis, &LibFileCacheBuildHandler{FileId: fileId})
+	err = SaveLibFileSplit(userId, fileId, cast.ToInt(version[`word_total`]), cast.ToInt(version[`qa_index_type`]), splitParams, toDocSplitItems(paragraphs), lang)
+	if err != nil {
+		restoreLibFileCurrent(userId, info, currents, lang)
+		return err
+	}
+	//the version saved by this rollback
+	m := msql.Model(`chat_ai_library_file_version`, define.Postgres)
+	latest, err := m.Where(`file_id`, cast.ToString(fileId)).Max(`version`)
+	if err != nil {
+		logs.Error(err.Error())
+		return nil
+	}
+	_, err = m.Where(`file_id`, cast.ToString(fileId)).Where(`version`, latest).
+		Update(msql.Datas{`rollback_version`: cast.ToInt(version[`version`])})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+// restoreLibFileCurrent restore the source of the file after a failed rollback.
+// The paragraphs are written outside the transaction of the file,so the ones already
+// changed by the rollback are replaced by the current paragraphs learned again
+func restoreLibFileCurrent(userId int, info msql.Params, currents []LibFileVersionParagraph, lang string) {
+	fileId := cast.ToInt(info[`id`])
+	status := cast.ToInt(info[`status`])
+	changed := true
+	if paragraphs, err := getLibFileParagraphs(fileId); err != nil {
+		logs.Error(err.Error())
+	} else {
+		before, _ := tool.JsonEncode(currents)
+		after, _ := tool.JsonEncode(paragraphs)
+		changed = before != after
+	}
+	splitParams, qaIndexType, ok := GetSavedSplitParams(info)
+	if changed && ok {
+		status = define.FileStatusWaitSplit //learned again below
+	}
+	_, err := msql.Model(`chat_ai_library_file`, define.Postgres).Where(`id`, cast.ToString(fileId)).Update(msql.Datas{
+		`file_name`:   info[`file_name`],
+		`file_url`:    info[`file_url`],
+		`file_size`:   cast.ToInt(info[`file_size`]),
+		`file_hash`:   info[`file_hash`],
+		`html_url`:    info[`html_url`],
+		`status`:      status,
+		`update_time`: tool.Time2Int(),
+	})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	lib_redis.DelCacheData(define.Redis, &LibFileCacheBuildHandler{FileId: fileId})
+	if !changed {
+		return
+	}
+	if !ok {
+		logs.Error(`file %d:the paragraphs are not restored,no saved split params`, fileId)
+		return
+	}
+	splitParams.FileExt, splitParams.IsTableFile = info[`file_ext`], cast.ToInt(info[`is_table_file`])
+	err = SaveLibFileSplit(userId, fileId, cast.ToInt(info[`word_total`]), qaIndexType, splitParams, toDocSplitItems(currents), lang)
+	if err != nil {
+		logs.Error(`file %d:the paragraphs are not restored:%s`, fileId, err.Error())
+	}
+}
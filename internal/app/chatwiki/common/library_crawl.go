@@ -0,0 +1,456 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/pkg/lib_redis"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	netURL "net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/curl"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+// NormalizeCrawlUrl the canonical form used to dedupe the pages:
+// lower scheme and host,no fragment,default port or tracking params,sorted query and no trailing slash
+func NormalizeCrawlUrl(link string) (string, error) {
+	u, err := netURL.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ``, err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if (u.Scheme != `http` && u.Scheme != `https`) || len(u.Hostname()) == 0 {
+		return ``, errors.New(`invalid url:` + link)
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if len(port) > 0 && !(u.Scheme == `http` && port == `80`) && !(u.Scheme == `https` && port == `443`) {
+		host += `:` + port
+	}
+	u.Host, u.User, u.Fragment, u.RawFragment = host, nil, ``, ``
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), `utm_`) {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+	if u.Path = strings.TrimRight(u.Path, `/`); len(u.Path) == 0 {
+		u.Path = `/`
+	}
+	u.RawPath = ``
+	return u.String(), nil
+}
+
+// SplitCrawlList the domains or the path prefixes are separated by the line breaks or the commas
+func SplitCrawlList(str string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.FieldsFunc(str, func(r rune) bool { return r == '\n' || r == '\r' || r == ',' }) {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// InCrawlScope the domain starting with a dot matches its subdomains,the domain of the seed is used when empty
+func InCrawlScope(job msql.Params, link string) bool {
+	u, err := netURL.Parse(link)
+	if err != nil {
+		return false
+	}
+	domains := SplitCrawlList(strings.ToLower(job[`domains`]))
+	if len(domains) == 0 {
+		if seed, err := netURL.Parse(job[`seed_url`]); err == nil {
+			domains = append(domains, strings.ToLower(seed.Hostname()))
+		}
+	}
+	host, matched := u.Hostname(), false
+	for _, domain := range domains {
+		if host == strings.TrimPrefix(domain, `.`) || (strings.HasPrefix(domain, `.`) && strings.HasSuffix(host, domain)) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	prefixes := SplitCrawlList(job[`path_prefixes`])
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		//matched on the path segments,so /docs does not match /docs-old
+		prefix = strings.TrimRight(`/`+strings.Trim(prefix, `/`), `/`)
+		if len(prefix) == 0 || u.Path == prefix || strings.HasPrefix(u.Path, prefix+`/`) {
+			return true
+		}
+	}
+	return false
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapXml both the urlset and the sitemapindex
+type sitemapXml struct {
+	Urls     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// readSitemap the page urls of the sitemap,the nested sitemap index is followed up to the level
+func readSitemap(link string, level, limit int) ([]string, error) {
+	bs, err := curl.Get(link).SetTimeout(10*time.Second, 60*time.Second).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	sitemap := sitemapXml{}
+	if err = xml.Unmarshal(bs, &sitemap); err != nil {
+		return nil, fmt.Errorf(`parse sitemap %s:%s`, link, err.Error())
+	}
+	links := make([]string, 0)
+	for _, item := range sitemap.Urls {
+		if len(links) >= limit {
+			return links, nil
+		}
+		if loc := strings.TrimSpace(item.Loc); len(loc) > 0 {
+			links = append(links, loc)
+		}
+	}
+	if level >= define.CrawlSitemapNested {
+		return links, nil
+	}
+	for _, item := range sitemap.Sitemaps {
+		if len(links) >= limit || len(strings.TrimSpace(item.Loc)) == 0 {
+			break
+		}
+		nested, err := readSitemap(strings.TrimSpace(item.Loc), level+1, limit-len(links))
+		if err != nil {
+			logs.Error(err.Error())
+			continue
+		}
+		links = append(links, nested...)
+	}
+	return links, nil
+}
+
+// addCrawlPage queue the page for the current round,false is returned when it is not crawled in the round
+func addCrawlPage(job msql.Params, link string, depth int) (bool, error) {
+	m := msql.Model(`chat_ai_library_crawl_page`, define.Postgres)
+	urlHash := tool.MD5(link)
+	page, err := m.Where(`crawl_id`, job[`id`]).Where(`url_hash`, urlHash).Field(`id,round`).Find()
+	if err != nil {
+		return false, err
+	}
+	if len(page) > 0 && cast.ToInt(page[`round`]) >= cast.ToInt(job[`round`]) {
+		return true, nil //already queued in the round
+	}
+	total, err := m.Where(`crawl_id`, job[`id`]).Where(`round`, job[`round`]).Count()
+	if err != nil {
+		return false, err
+	}
+	if total >= cast.ToInt(job[`max_pages`]) {
+		return false, nil
+	}
+	data := msql.Datas{
+		`depth`:       depth,
+		`round`:       job[`round`],
+		`status`:      define.CrawlPageStatusPending,
+		`errmsg`:      ``,
+		`update_time`: tool.Time2Int(),
+	}
+	if len(page) > 0 {
+		_, err = m.Where(`id`, page[`id`]).Update(data)
+	} else {
+		data[`crawl_id`] = job[`id`]
+		data[`url`] = link
+		data[`url_hash`] = urlHash
+		data[`create_time`] = tool.Time2Int()
+		_, err = m.Insert(data, `id`)
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = msql.Model(`chat_ai_library_crawl`, define.Postgres).Where(`id`, job[`id`]).
+		Update2(fmt.Sprintf(`page_total=page_total+1,update_time=%d`, tool.Time2Int()))
+	return true, err
+}
+
+// addCrawlSeeds queue the seed url or the pages of the sitemap at depth 0
+func addCrawlSeeds(job msql.Params) error {
+	links := []string{job[`seed_url`]}
+	if cast.ToInt(job[`seed_type`]) == define.CrawlSeedSitemap {
+		var err error
+		if links, err = readSitemap(job[`seed_url`], 0, cast.ToInt(job[`max_pages`])); err != nil {
+			return err
+		}
+	}
+	added := 0
+	for _, link := range links {
+		link, err := NormalizeCrawlUrl(link)
+		if err != nil || !InCrawlScope(job, link) {
+			continue
+		}
+		ok, err := addCrawlPage(job, link, 0)
+		if err != nil {
+			return err
+		}
+		if ok {
+			added++
+		}
+	}
+	if added == 0 {
+		return errors.New(`no page of the seed is in the crawl scope`)
+	}
+	return nil
+}
+
+// saveCrawlFile add the file of the page or update it when the content hash changed
+func saveCrawlFile(job, page msql.Params, uploadInfo *define.UploadInfo) (int, string, error) {
+	userId := cast.ToInt(job[`admin_user_id`])
+	var file msql.Params
+	if fileId := cast.ToInt(page[`file_id`]); fileId > 0 {
+		var err error
+		if file, err = GetLibFileInfo(fileId, userId); err != nil {
+			return 0, ``, err
+		}
+	}
+	if len(file) == 0 { //new page,or the file was deleted by the user
+		fileId, err := InsertLibraryFile(userId, cast.ToInt(job[`library_id`]), uploadInfo, msql.Datas{
+			`crawl_id`:                 job[`id`],
+			`doc_auto_renew_frequency`: 1, //renewed by the crawl job
+			`doc_last_renew_time`:      tool.Time2Int(),
+		})
+		return int(fileId), `added_total`, err
+	}
+	fileId := cast.ToInt(file[`id`])
+	if file[`file_hash`] == uploadInfo.Hash {
+		return fileId, ``, nil
+	}
+	_, err := msql.Model(`chat_ai_library_file`, define.Postgres).Where(`id`, cast.ToString(fileId)).Update(msql.Datas{
+		`status`:              define.FileStatusInitial,
+		`file_name`:           uploadInfo.Name,
+		`file_size`:           uploadInfo.Size,
+		`file_url`:            uploadInfo.Link,
+		`file_hash`:           uploadInfo.Hash,
+		`update_time`:         tool.Time2Int(),
+		`doc_last_renew_time`: tool.Time2Int(),
+	})
+	//clear cached data
+	lib_redis.DelCacheData(define.Redis, &LibFileCacheBuildHandler{FileId: fileId})
+	if err != nil {
+		return 0, ``, err
+	}
+	//async task:convert html,the unchanged paragraphs keep their vectors when it is split again
+	StartIngestJob(fileId, define.IngestStageConvert)
+	if message, err := tool.JsonEncode(map[string]any{`file_id`: fileId, `file_url`: uploadInfo.Link}); err != nil {
+		logs.Error(err.Error())
+	} else if err := AddJobs(define.ConvertHtmlTopic, message); err != nil {
+		logs.Error(err.Error())
+	}
+	return fileId, `updated_total`, nil
+}
+
+// crawlPage fetch the page,save its file and queue the links in scope
+func crawlPage(job, page msql.Params) (msql.Datas, string, error) {
+	crawlerPage, err := RequestCrawlerPage(page[`url`])
+	if err != nil {
+		return nil, ``, err
+	}
+	depth := cast.ToInt(page[`depth`])
+	//the canonical url is crawled as its own page,this page is a duplicate only when the canonical one is done in the round,
+	//so one of the mutually canonical pages is kept
+	canonicalHash := ``
+	if canonical, err := NormalizeCrawlUrl(crawlerPage.Canonical); err == nil && canonical != page[`url`] && InCrawlScope(job, canonical) {
+		if _, err = addCrawlPage(job, canonical, depth); err != nil {
+			return nil, ``, err
+		}
+		canonicalHash = tool.MD5(canonical)
+		done, err := msql.Model(`chat_ai_library_crawl_page`, define.Postgres).Where(`crawl_id`, job[`id`]).
+			Where(`url_hash`, canonicalHash).Where(`round`, job[`round`]).
+			Where(`status`, cast.ToString(define.CrawlPageStatusDone)).Count()
+		if err != nil {
+			return nil, ``, err
+		}
+		if done > 0 {
+			if fileId := cast.ToInt(page[`file_id`]); fileId > 0 {
+				if err = DeleteLibraryFile(fileId); err != nil {
+					return nil, ``, err
+				}
+			}
+			return msql.Datas{`status`: define.CrawlPageStatusDuplicate, `file_id`: 0, `canonical_hash`: canonicalHash}, ``, nil
+		}
+	}
+	uploadInfo, err := SaveCrawlerPage(cast.ToInt(job[`admin_user_id`]), page[`url`], `library_file`, crawlerPage)
+	if err != nil {
+		return nil, ``, err
+	}
+	fileId, counter, err := saveCrawlFile(job, page, uploadInfo)
+	if err != nil {
+		return nil, ``, err
+	}
+	if depth < cast.ToInt(job[`max_depth`]) {
+		for _, link := range crawlerPage.Links {
+			link, err := NormalizeCrawlUrl(link)
+			if err != nil || !InCrawlScope(job, link) {
+				continue
+			}
+			if _, err = addCrawlPage(job, link, depth+1); err != nil {
+				return nil, ``, err
+			}
+		}
+	}
+	if err = dropCrawlAliases(job, page); err != nil {
+		return nil, ``, err
+	}
+	return msql.Datas{`status`: define.CrawlPageStatusDone, `file_id`: fileId, `canonical_hash`: canonicalHash}, counter, nil
+}
+
+// dropCrawlAliases the pages of the round saved before their canonical page is done become duplicates of it
+func dropCrawlAliases(job, page msql.Params) error {
+	m := msql.Model(`chat_ai_library_crawl_page`, define.Postgres)
+	aliases, err := m.Where(`crawl_id`, job[`id`]).Where(`round`, job[`round`]).
+		Where(`canonical_hash`, page[`url_hash`]).Where(`status`, cast.ToString(define.CrawlPageStatusDone)).
+		Where(`id`, `<>`, page[`id`]).Field(`id,file_id`).Select()
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		if fileId := cast.ToInt(alias[`file_id`]); fileId > 0 {
+			if err = DeleteLibraryFile(fileId); err != nil {
+				return err
+			}
+		}
+		_, err = m.Where(`id`, alias[`id`]).Update(msql.Datas{
+			`status`:      define.CrawlPageStatusDuplicate,
+			`file_id`:     0,
+			`update_time`: tool.Time2Int(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishCrawlRound delete the files of the pages not found again in the round
+func finishCrawlRound(job msql.Params) (int, error) {
+	m := msql.Model(`chat_ai_library_crawl_page`, define.Postgres)
+	pages, err := m.Where(`crawl_id`, job[`id`]).Where(`round`, `<`, job[`round`]).Field(`id,file_id`).Select()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, page := range pages {
+		if fileId := cast.ToInt(page[`file_id`]); fileId > 0 {
+			if err = DeleteLibraryFile(fileId); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if _, err = m.Where(`id`, page[`id`]).Delete(); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// RunCrawlBatch crawl a batch of the pending pages,true is returned when some pages are still pending
+func RunCrawlBatch(job msql.Params) (bool, error) {
+	m := msql.Model(`chat_ai_library_crawl_page`, define.Postgres)
+	total, err := m.Where(`crawl_id`, job[`id`]).Where(`round`, job[`round`]).Count()
+	if err != nil {
+		return false, err
+	}
+	if total == 0 {
+		if err = addCrawlSeeds(job); err != nil {
+			return false, err
+		}
+	}
+	pages, err := m.Where(`crawl_id`, job[`id`]).Where(`round`, job[`round`]).
+		Where(`status`, cast.ToString(define.CrawlPageStatusPending)).
+		Order(`depth,id`).Limit(define.CrawlBatchPages).Select()
+	if err != nil {
+		return false, err
+	}
+	jobModel := msql.Model(`chat_ai_library_crawl`, define.Postgres)
+	for _, page := range pages {
+		//cancelled while crawling
+		status, err := jobModel.Where(`id`, job[`id`]).Value(`status`)
+		if err != nil {
+			return false, err
+		}
+		if cast.ToInt(status) != define.CrawlStatusRunning {
+			return false, nil
+		}
+		upData, counter, err := crawlPage(job, page)
+		counters := `done_total=done_total+1`
+		if err != nil {
+			logs.Error(`crawl:%s/%s`, page[`url`], err.Error())
+			upData = msql.Datas{`status`: define.CrawlPageStatusFailed, `errmsg`: MbSubstr(err.Error(), 0, 500)}
+			counters = `failed_total=failed_total+1`
+		} else {
+			upData[`errmsg`] = ``
+			if len(counter) > 0 {
+				counters += fmt.Sprintf(`,%s=%s+1`, counter, counter)
+			}
+		}
+		upData[`update_time`] = tool.Time2Int()
+		if _, err = m.Where(`id`, page[`id`]).Update(upData); err != nil {
+			return false, err
+		}
+		_, err = jobModel.Where(`id`, job[`id`]).Update2(fmt.Sprintf(`%s,update_time=%d`, counters, tool.Time2Int()))
+		if err != nil {
+			return false, err
+		}
+	}
+	pending, err := m.Where(`crawl_id`, job[`id`]).Where(`round`, job[`round`]).
+		Where(`status`, cast.ToString(define.CrawlPageStatusPending)).Count()
+	if err != nil || pending > 0 {
+		return pending > 0, err
+	}
+	deleted, err := finishCrawlRound(job)
+	if _, err := jobModel.Where(`id`, job[`id`]).Update(msql.Datas{`deleted_total`: deleted}); err != nil {
+		logs.Error(err.Error())
+	}
+	return false, err
+}
+
+// AddCrawlJob add the job continuing the crawl
+func AddCrawlJob(crawlId int) error {
+	message, err := tool.JsonEncode(map[string]any{`id`: crawlId})
+	if err != nil {
+		return err
+	}
+	return AddJobs(define.LibraryCrawlTopic, message)
+}
+
+// StartCrawlRound crawl the site again,the pages not found in the new round are deleted when it finishes
+func StartCrawlRound(crawlId int) error {
+	_, err := msql.Model(`chat_ai_library_crawl`, define.Postgres).Where(`id`, cast.ToString(crawlId)).
+		Update2(fmt.Sprintf(`round=round+1,status=%d,errmsg='',page_total=0,done_total=0,failed_total=0,`+
+			`added_total=0,updated_total=0,deleted_total=0,last_renew_time=%d,update_time=%d`,
+			define.CrawlStatusRunning, tool.Time2Int(), tool.Time2Int()))
+	if err != nil {
+		return err
+	}
+	return AddCrawlJob(crawlId)
+}
+
+// IsCrawlRenewDue the renew frequency has the same meaning as doc_auto_renew_frequency
+func IsCrawlRenewDue(job msql.Params) bool {
+	days := map[int]int{2: 1, 3: 3, 4: 7, 5: 30}[cast.ToInt(job[`renew_frequency`])]
+	if days == 0 {
+		return false
+	}
+	return cast.ToInt64(job[`last_renew_time`]) <= time.Now().Add(-time.Duration(days)*24*time.Hour).Unix()
+}
@@ -0,0 +1,247 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"archive/zip"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/pkg/lib_redis"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+// InsertLibraryFile save an uploaded file to the library,the documents are converted to html asynchronously
+func InsertLibraryFile(userId, libraryId int, uploadInfo *define.UploadInfo, extra msql.Datas) (int64, error) {
+	status := define.FileStatusInitial
+	isTableFile := define.IsTableFile(uploadInfo.Ext)
+	if isTableFile {
+		status = define.FileStatusWaitSplit
+	}
+	insData := msql.Datas{
+		`admin_user_id`:        userId,
+		`library_id`:           libraryId,
+		`file_url`:             uploadInfo.Link,
+		`file_name`:            uploadInfo.Name,
+		`file_hash`:            uploadInfo.Hash,
+		`status`:               status,
+		`chunk_size`:           512,
+		`chunk_overlap`:        0,
+		`separators_no`:        `11,12`,
+		`enable_extract_image`: true,
+		`file_ext`:             uploadInfo.Ext,
+		`file_size`:            uploadInfo.Size,
+		`create_time`:          tool.Time2Int(),
+		`update_time`:          tool.Time2Int(),
+		`is_table_file`:        cast.ToInt(isTableFile),
+		`doc_type`:             uploadInfo.GetDocType(),
+		`doc_url`:              uploadInfo.DocUrl,
+	}
+	for key, value := range extra {
+		insData[key] = value
+	}
+	fileId, err := msql.Model(`chat_ai_library_file`, define.Postgres).Insert(insData, `id`)
+	//clear cached data
+	lib_redis.DelCacheData(define.Redis, &LibFileCacheBuildHandler{FileId: int(fileId)})
+	if err != nil {
+		return 0, err
+	}
+	if isTableFile {
+		StartIngestJob(int(fileId), define.IngestStageSplit)
+	}
+	if !isTableFile && !uploadInfo.Custom { //async task:convert html
+		StartIngestJob(int(fileId), define.IngestStageConvert)
+		if message, err := tool.JsonEncode(map[string]any{`file_id`: fileId, `file_url`: uploadInfo.Link}); err != nil {
+			logs.Error(err.Error())
+		} else if err := AddJobs(define.ConvertHtmlTopic, message); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	return fileId, nil
+}
+
+// DeleteLibraryFile delete the file with its paragraphs and vectors
+func DeleteLibraryFile(fileId int) error {
+	_, err := msql.Model(`chat_ai_library_file`, define.Postgres).Where(`id`, cast.ToString(fileId)).Delete()
+	if err != nil {
+		return err
+	}
+	//clear cached data
+	lib_redis.DelCacheData(define.Redis, &LibFileCacheBuildHandler{FileId: fileId})
+	//dispose relation data
+	_, err = msql.Model(`chat_ai_library_file_data`, define.Postgres).Where(`file_id`, cast.ToString(fileId)).Delete()
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	_, err = msql.Model(`chat_ai_library_file_data_index`, define.Postgres).Where(`file_id`, cast.ToString(fileId)).Delete()
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	if err = DeleteParagraphGraph(`file_id`, cast.ToString(fileId)); err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+// getZipEntryName the zip tools on windows save the names in the local encoding
+func getZipEntryName(file *zip.File) string {
+	name := file.Name
+	if file.NonUTF8 || !utf8.ValidString(name) {
+		name = tool.Convert(name, `gbk`, `utf-8`)
+	}
+	return strings.TrimPrefix(path.Clean(`/`+strings.ReplaceAll(name, `\`, `/`)), `/`)
+}
+
+// isZipMetaEntry the resource forks of macos and the hidden files are not documents
+func isZipMetaEntry(name string) bool {
+	for _, part := range strings.Split(name, `/`) {
+		if part == `__MACOSX` || strings.HasPrefix(part, `.`) {
+			return true
+		}
+	}
+	return false
+}
+
+// importZipEntry save a file of the zip to the library,the duplicates are detected by the md5 of the content
+func importZipEntry(job msql.Params, file *zip.File, name string) (int, int64, error) {
+	ext := strings.ToLower(strings.TrimLeft(path.Ext(name), `.`))
+	if !tool.InArrayString(ext, define.LibFileAllowExt) {
+		return define.ImportFileStatusUnsupported, 0, errors.New(ext + ` not allow`)
+	}
+	if file.UncompressedSize64 > define.LibFileLimitSize {
+		return define.ImportFileStatusFailed, 0, errors.New(`file size too big`)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return define.ImportFileStatusFailed, 0, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	bs, err := io.ReadAll(io.LimitReader(reader, define.LibFileLimitSize+1))
+	if err != nil {
+		return define.ImportFileStatusFailed, 0, err
+	}
+	if len(bs) > define.LibFileLimitSize {
+		return define.ImportFileStatusFailed, 0, errors.New(`file size too big`)
+	}
+	if len(bs) == 0 {
+		return define.ImportFileStatusFailed, 0, errors.New(`file content is empty`)
+	}
+	content := string(bs)
+	md5Hash := tool.MD5(content)
+	fileName := MbSubstr(path.Base(name), 0, 100)
+	duplicateId, err := msql.Model(`chat_ai_library_file`, define.Postgres).
+		Where(`library_id`, job[`library_id`]).
+		Where(`file_hash`, md5Hash).Value(`id`)
+	if err != nil {
+		return define.ImportFileStatusFailed, 0, err
+	}
+	if cast.ToInt64(duplicateId) == 0 { //the files uploaded before the hash was saved are matched by the name and the size
+		duplicateId, err = msql.Model(`chat_ai_library_file`, define.Postgres).
+			Where(`library_id`, job[`library_id`]).Where(`file_hash`, ``).
+			Where(`file_name`, fileName).Where(`file_size`, cast.ToString(len(bs))).Value(`id`)
+		if err != nil {
+			return define.ImportFileStatusFailed, 0, err
+		}
+	}
+	if cast.ToInt64(duplicateId) > 0 {
+		return define.ImportFileStatusDuplicate, cast.ToInt64(duplicateId), nil
+	}
+	userId := cast.ToInt(job[`admin_user_id`])
+	objectKey := fmt.Sprintf(`chat_ai/%d/%s/%s/%s.%s`, userId, `library_file`, tool.Date(`Ym`), md5Hash, ext)
+	link, err := WriteFileByString(objectKey, content)
+	if err != nil {
+		return define.ImportFileStatusFailed, 0, err
+	}
+	folderPath := path.Dir(name)
+	if folderPath == `.` {
+		folderPath = ``
+	}
+	uploadInfo := &define.UploadInfo{Name: fileName, Size: int64(len(bs)), Ext: ext, Link: link, Hash: md5Hash}
+	fileId, err := InsertLibraryFile(userId, cast.ToInt(job[`library_id`]), uploadInfo, msql.Datas{
+		`folder_path`: MbSubstr(folderPath, 0, 500),
+	})
+	if err != nil {
+		return define.ImportFileStatusFailed, 0, err
+	}
+	return define.ImportFileStatusImported, fileId, nil
+}
+
+// RunLibraryImport unpack the zip and import each file,the files recorded by an interrupted run are skipped
+func RunLibraryImport(job msql.Params) error {
+	reader, err := zip.OpenReader(GetFileByLink(job[`zip_url`]))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	m := msql.Model(`chat_ai_library_import_file`, define.Postgres)
+	recorded, err := m.Where(`import_id`, job[`id`]).ColumnArr(`file_path`)
+	if err != nil {
+		return err
+	}
+	for _, file := range reader.File {
+		name := getZipEntryName(file)
+		if file.FileInfo().IsDir() || len(name) == 0 || isZipMetaEntry(name) || tool.InArrayString(name, recorded) {
+			continue
+		}
+		status, fileId, err := importZipEntry(job, file, name)
+		errmsg := `success`
+		if err != nil {
+			errmsg = err.Error()
+		}
+		_, err = m.Insert(msql.Datas{
+			`admin_user_id`: job[`admin_user_id`],
+			`library_id`:    job[`library_id`],
+			`import_id`:     job[`id`],
+			`file_path`:     MbSubstr(name, 0, 500),
+			`status`:        status,
+			`file_id`:       fileId,
+			`errmsg`:        MbSubstr(errmsg, 0, 1000),
+			`create_time`:   tool.Time2Int(),
+			`update_time`:   tool.Time2Int(),
+		})
+		if err != nil {
+			return err
+		}
+		recorded = append(recorded, name)
+		if _, err = UpdateImportProgress(job); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	return nil
+}
+
+func UpdateImportProgress(job msql.Params) (msql.Datas, error) {
+	stats, err := msql.Model(`chat_ai_library_import_file`, define.Postgres).
+		Where(`import_id`, job[`id`]).
+		Field(`count(1) as total`).
+		Field(fmt.Sprintf(`count(1) filter (where status=%d) as imported_total`, define.ImportFileStatusImported)).
+		Field(fmt.Sprintf(`count(1) filter (where status=%d) as duplicate_total`, define.ImportFileStatusDuplicate)).
+		Field(fmt.Sprintf(`count(1) filter (where status=%d) as unsupported_total`, define.ImportFileStatusUnsupported)).
+		Field(fmt.Sprintf(`count(1) filter (where status=%d) as failed_total`, define.ImportFileStatusFailed)).
+		Find()
+	if err != nil {
+		return nil, err
+	}
+	data := msql.Datas{
+		`total`:             cast.ToInt(stats[`total`]),
+		`imported_total`:    cast.ToInt(stats[`imported_total`]),
+		`duplicate_total`:   cast.ToInt(stats[`duplicate_total`]),
+		`unsupported_total`: cast.ToInt(stats[`unsupported_total`]),
+		`failed_total`:      cast.ToInt(stats[`failed_total`]),
+		`update_time`:       tool.Time2Int(),
+	}
+	_, err = msql.Model(`chat_ai_library_import`, define.Postgres).Where(`id`, job[`id`]).Update(data)
+	return data, err
+}
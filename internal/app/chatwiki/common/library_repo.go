@@ -0,0 +1,392 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"bytes"
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/pkg/lib_redis"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+// SplitRepoGlobs the globs are separated by the line breaks or the commas
+func SplitRepoGlobs(str string) []string {
+	globs := make([]string, 0)
+	for _, glob := range strings.FieldsFunc(str, func(r rune) bool { return r == '\n' || r == '\r' || r == ',' }) {
+		if glob = strings.Trim(strings.TrimSpace(glob), `/`); len(glob) > 0 {
+			globs = append(globs, glob)
+		}
+	}
+	return globs
+}
+
+// repoGlobRegexp ** matches any directories,* and ? do not match the slash
+func repoGlobRegexp(glob string) (*regexp.Regexp, error) {
+	var builder strings.Builder
+	builder.WriteString(`^`)
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], `**/`):
+			builder.WriteString(`(?:.*/)?`)
+			i += 2
+		case strings.HasPrefix(glob[i:], `**`):
+			builder.WriteString(`.*`)
+			i++
+		case glob[i] == '*':
+			builder.WriteString(`[^/]*`)
+		case glob[i] == '?':
+			builder.WriteString(`[^/]`)
+		default:
+			builder.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	builder.WriteString(`$`)
+	return regexp.Compile(builder.String())
+}
+
+// MatchRepoGlobs the glob without a slash matches the file name in any directory
+func MatchRepoGlobs(globs []string, name string) bool {
+	for _, glob := range globs {
+		target := name
+		if !strings.Contains(glob, `/`) {
+			target = path.Base(name)
+		}
+		if re, err := repoGlobRegexp(glob); err == nil && re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRepoLocalPath the local directories and the file repositories must be under the configured root
+func CheckRepoLocalPath(dir string) bool {
+	root := strings.TrimSpace(define.Config.RepoSync[`dir_root`])
+	if len(root) == 0 || !filepath.IsAbs(dir) {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(dir))
+	return err == nil && rel != `..` && !strings.HasPrefix(rel, `..`+string(filepath.Separator))
+}
+
+// CheckRepoSource the git remote or the local directory of the source
+func CheckRepoSource(sourceType int, sourceUrl string) bool {
+	if len(sourceUrl) == 0 || strings.HasPrefix(sourceUrl, `-`) {
+		return false
+	}
+	if sourceType == define.RepoSourceDir {
+		return CheckRepoLocalPath(sourceUrl)
+	}
+	if strings.HasPrefix(sourceUrl, `file://`) {
+		return CheckRepoLocalPath(strings.TrimPrefix(sourceUrl, `file://`))
+	}
+	if filepath.IsAbs(sourceUrl) {
+		return CheckRepoLocalPath(sourceUrl)
+	}
+	for _, prefix := range []string{`https://`, `http://`, `ssh://`, `git@`} {
+		if strings.HasPrefix(sourceUrl, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// repoWorkRoot the working copies are cloned under it,replaced by the tests
+var repoWorkRoot = define.RepoDir
+
+func GetRepoWorkDir(repoId int) string {
+	return repoWorkRoot + cast.ToString(repoId)
+}
+
+func runGit(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), define.RepoSyncTimeout*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, `git`, args...)
+	cmd.Env = append(os.Environ(), `GIT_TERMINAL_PROMPT=0`)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return ``, errors.New(`git ` + args[0] + `:` + strings.TrimSpace(stderr.String()) + `:` + err.Error())
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// pullRepoTree the shallow working copy of the branch,cloned again when it is broken
+func pullRepoTree(repo msql.Params) (string, string, error) {
+	if cast.ToInt(repo[`source_type`]) == define.RepoSourceDir {
+		if !CheckRepoLocalPath(repo[`source_url`]) { //the root may be changed after the source is created
+			return ``, ``, errors.New(`the directory is not under the dir_root of repo_sync`)
+		}
+		return repo[`source_url`], ``, nil
+	}
+	dir, branch := GetRepoWorkDir(cast.ToInt(repo[`id`])), repo[`branch`]
+	if _, err := os.Stat(dir + `/.git`); err == nil {
+		ref := `HEAD`
+		if len(branch) > 0 {
+			ref = branch
+		}
+		_, err = runGit(`-C`, dir, `fetch`, `--depth`, `1`, `origin`, ref)
+		if err == nil {
+			_, err = runGit(`-C`, dir, `reset`, `--hard`, `FETCH_HEAD`)
+		}
+		if err != nil {
+			logs.Error(err.Error())
+			_ = os.RemoveAll(dir)
+		}
+	}
+	if _, err := os.Stat(dir + `/.git`); err != nil {
+		if err = os.MkdirAll(repoWorkRoot, os.ModePerm); err != nil {
+			return ``, ``, err
+		}
+		args := []string{`clone`, `--depth`, `1`}
+		if len(branch) > 0 {
+			args = append(args, `--branch`, branch)
+		}
+		if _, err = runGit(append(args, `--`, repo[`source_url`], dir)...); err != nil {
+			return ``, ``, err
+		}
+	}
+	commit, err := runGit(`-C`, dir, `rev-parse`, `HEAD`)
+	return dir, commit, err
+}
+
+// walkRepoTree the documents of the tree matched by the globs,the key is the path relative to the root
+func walkRepoTree(root string, repo msql.Params) (map[string]string, error) {
+	includes, excludes := SplitRepoGlobs(repo[`include_globs`]), SplitRepoGlobs(repo[`exclude_globs`])
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == `.git` {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() { //the symlinks may point out of the tree
+			return nil
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		ext := strings.ToLower(strings.TrimLeft(path.Ext(rel), `.`))
+		if !tool.InArrayString(ext, define.LibFileAllowExt) {
+			return nil
+		}
+		if (len(includes) > 0 && !MatchRepoGlobs(includes, rel)) || MatchRepoGlobs(excludes, rel) {
+			return nil
+		}
+		files[rel] = file
+		return nil
+	})
+	return files, err
+}
+
+// repoTreeFile a document of the tree,old is the file of the library synced from it before
+type repoTreeFile struct {
+	rel, file, hash string
+	size            int64
+	old             msql.Params
+}
+
+// repoSyncPlan the changes making the files of the library match the tree
+type repoSyncPlan struct {
+	added, updated []repoTreeFile
+	unchanged      int
+	deleted        []msql.Params
+	errs           []error
+}
+
+// planRepoSync compare the tree with the files synced before by the content hash.
+// An empty tree never deletes the files of the library,it is taken as a wrong source or wrong globs
+func planRepoSync(files map[string]string, olds []msql.Params) (repoSyncPlan, error) {
+	plan := repoSyncPlan{}
+	if len(files) == 0 && len(olds) > 0 {
+		return plan, errors.New(`no documents are matched in the tree,the files of the library are kept`)
+	}
+	oldMap := make(map[string]msql.Params)
+	for _, old := range olds {
+		oldMap[old[`doc_url`]] = old
+	}
+	rels := make([]string, 0, len(files))
+	for rel := range files {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		old := oldMap[rel]
+		delete(oldMap, rel)
+		stat, err := os.Stat(files[rel])
+		if err != nil {
+			plan.errs = append(plan.errs, err)
+			continue
+		}
+		if stat.Size() == 0 || stat.Size() > define.LibFileLimitSize {
+			plan.errs = append(plan.errs, errors.New(rel+`:file size is empty or too big`))
+			continue
+		}
+		bs, err := os.ReadFile(files[rel])
+		if err != nil {
+			plan.errs = append(plan.errs, err)
+			continue
+		}
+		treeFile := repoTreeFile{rel: rel, file: files[rel], hash: tool.MD5(string(bs)), size: stat.Size(), old: old}
+		switch {
+		case len(old) == 0:
+			plan.added = append(plan.added, treeFile)
+		case old[`file_hash`] != treeFile.hash:
+			plan.updated = append(plan.updated, treeFile)
+		default:
+			plan.unchanged++
+		}
+	}
+	//the files removed from the tree
+	for _, old := range olds {
+		if _, ok := oldMap[old[`doc_url`]]; ok && len(plan.deleted) < define.RepoSyncDeleteLimit {
+			plan.deleted = append(plan.deleted, old)
+		}
+	}
+	return plan, nil
+}
+
+// saveRepoFile add the file of the tree or update the file synced from it before
+func saveRepoFile(repo msql.Params, treeFile repoTreeFile) error {
+	bs, err := os.ReadFile(treeFile.file)
+	if err != nil {
+		return err
+	}
+	userId, ext := cast.ToInt(repo[`admin_user_id`]), strings.ToLower(strings.TrimLeft(path.Ext(treeFile.rel), `.`))
+	objectKey := fmt.Sprintf(`chat_ai/%d/%s/%s/%s.%s`, userId, `library_file`, tool.Date(`Ym`), treeFile.hash, ext)
+	link, err := WriteFileByString(objectKey, string(bs))
+	if err != nil {
+		return err
+	}
+	uploadInfo := &define.UploadInfo{Name: MbSubstr(path.Base(treeFile.rel), 0, 100), Size: treeFile.size, Ext: ext, Link: link, Hash: treeFile.hash}
+	if len(treeFile.old) == 0 {
+		folderPath := path.Dir(treeFile.rel)
+		if folderPath == `.` {
+			folderPath = ``
+		}
+		_, err = InsertLibraryFile(userId, cast.ToInt(repo[`library_id`]), uploadInfo, msql.Datas{
+			`doc_type`:    define.DocTypeRepo,
+			`doc_url`:     treeFile.rel,
+			`repo_id`:     repo[`id`],
+			`folder_path`: MbSubstr(folderPath, 0, 500),
+		})
+		return err
+	}
+	fileId, isTableFile := cast.ToInt(treeFile.old[`id`]), define.IsTableFile(ext)
+	status := define.FileStatusInitial
+	if isTableFile {
+		status = define.FileStatusWaitSplit
+	}
+	_, err = msql.Model(`chat_ai_library_file`, define.Postgres).Where(`id`, cast.ToString(fileId)).Update(msql.Datas{
+		`status`:      status,
+		`file_url`:    link,
+		`file_hash`:   treeFile.hash,
+		`file_size`:   treeFile.size,
+		`update_time`: tool.Time2Int(),
+	})
+	//clear cached data
+	lib_redis.DelCacheData(define.Redis, &LibFileCacheBuildHandler{FileId: fileId})
+	if err != nil {
+		return err
+	}
+	if isTableFile {
+		StartIngestJob(fileId, define.IngestStageSplit)
+		return nil
+	}
+	//async task:convert html,the unchanged paragraphs keep their vectors when it is split again
+	StartIngestJob(fileId, define.IngestStageConvert)
+	if message, err := tool.JsonEncode(map[string]any{`file_id`: fileId, `file_url`: link}); err != nil {
+		logs.Error(err.Error())
+	} else if err := AddJobs(define.ConvertHtmlTopic, message); err != nil {
+		logs.Error(err.Error())
+	}
+	return nil
+}
+
+// RunRepoSync make the files of the library match the tree of the source
+func RunRepoSync(repo msql.Params) (msql.Datas, error) {
+	root, commit, err := pullRepoTree(repo)
+	if err != nil {
+		return nil, err
+	}
+	files, err := walkRepoTree(root, repo)
+	if err != nil {
+		return nil, err
+	}
+	olds, err := msql.Model(`chat_ai_library_file`, define.Postgres).
+		Where(`repo_id`, repo[`id`]).Field(`id,doc_url,file_hash`).Order(`id`).Select()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planRepoSync(files, olds)
+	if err != nil {
+		return nil, err
+	}
+	stat := msql.Datas{`last_commit`: commit, `file_total`: len(files), `added_total`: 0, `updated_total`: 0, `deleted_total`: 0}
+	var lastErr error
+	for _, err = range plan.errs {
+		logs.Error(`repo sync:%s/%s`, repo[`id`], err.Error())
+		lastErr = err
+	}
+	for _, treeFile := range append(plan.added, plan.updated...) {
+		if err = saveRepoFile(repo, treeFile); err != nil {
+			logs.Error(`repo sync:%s/%s`, repo[`id`], err.Error())
+			lastErr = err
+			continue
+		}
+		if len(treeFile.old) == 0 {
+			stat[`added_total`] = cast.ToInt(stat[`added_total`]) + 1
+		} else {
+			stat[`updated_total`] = cast.ToInt(stat[`updated_total`]) + 1
+		}
+	}
+	for _, old := range plan.deleted {
+		if err = DeleteLibraryFile(cast.ToInt(old[`id`])); err != nil {
+			logs.Error(err.Error())
+			lastErr = err
+			continue
+		}
+		stat[`deleted_total`] = cast.ToInt(stat[`deleted_total`]) + 1
+	}
+	if lastErr != nil {
+		stat[`errmsg`] = MbSubstr(lastErr.Error(), 0, 1000)
+	} else {
+		stat[`errmsg`] = ``
+	}
+	return stat, nil
+}
+
+// AddRepoSyncJob mark the source syncing and add the job
+func AddRepoSyncJob(repoId int) error {
+	_, err := msql.Model(`chat_ai_library_repo`, define.Postgres).Where(`id`, cast.ToString(repoId)).
+		Update(msql.Datas{`status`: define.RepoStatusSyncing, `update_time`: tool.Time2Int()})
+	if err != nil {
+		return err
+	}
+	message, err := tool.JsonEncode(map[string]any{`id`: repoId})
+	if err != nil {
+		return err
+	}
+	return AddJobs(define.LibraryRepoSyncTopic, message)
+}
@@ -0,0 +1,157 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+func writeRepoFiles(t *testing.T, work string, files map[string]string, message string) {
+	for name, content := range files {
+		file := filepath.Join(work, name)
+		if len(content) == 0 {
+			if _, err := runGit(`-C`, work, `rm`, `-q`, name); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{`-C`, work, `add`, `-A`},
+		{`-C`, work, `-c`, `user.name=test`, `-c`, `user.email=test@example.com`, `commit`, `-q`, `-m`, message},
+		{`-C`, work, `push`, `-q`, `origin`, `HEAD:main`},
+	} {
+		if _, err := runGit(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func treeFileRels(list []repoTreeFile) []string {
+	rels := make([]string, 0, len(list))
+	for _, treeFile := range list {
+		rels = append(rels, treeFile.rel)
+	}
+	sort.Strings(rels)
+	return rels
+}
+
+func TestRepoSyncPlan(t *testing.T) {
+	if _, err := exec.LookPath(`git`); err != nil {
+		t.Skip(`git is not installed`)
+	}
+	root := t.TempDir()
+	config, workRoot := define.Config.RepoSync, repoWorkRoot
+	define.Config.RepoSync = map[string]string{`dir_root`: root}
+	repoWorkRoot = filepath.Join(root, `repo`) + `/`
+	t.Cleanup(func() {
+		define.Config.RepoSync, repoWorkRoot = config, workRoot
+	})
+
+	bare, work := filepath.Join(root, `origin.git`), filepath.Join(root, `work`)
+	_, err := runGit(`init`, `-q`, `--bare`, bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = runGit(`init`, `-q`, work); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = runGit(`-C`, work, `remote`, `add`, `origin`, bare); err != nil {
+		t.Fatal(err)
+	}
+	writeRepoFiles(t, work, map[string]string{`a.md`: `# a`, `b.md`: `# b`, `docs/d.md`: `# d`, `notes.txt`: `excluded`}, `init`)
+
+	repo := msql.Params{`id`: `1`, `source_type`: cast.ToString(define.RepoSourceGit), `source_url`: `file://` + bare,
+		`branch`: `main`, `include_globs`: `**/*.md`}
+	if !CheckRepoSource(define.RepoSourceGit, repo[`source_url`]) {
+		t.Fatalf(`the source under dir_root is rejected:%s`, repo[`source_url`])
+	}
+	sync := func(olds []msql.Params) repoSyncPlan {
+		dir, commit, err := pullRepoTree(repo)
+		if err != nil || len(commit) == 0 {
+			t.Fatalf(`pull:%v/%s`, err, commit)
+		}
+		files, err := walkRepoTree(dir, repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := planRepoSync(files, olds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return plan
+	}
+
+	//add
+	plan := sync(nil)
+	if rels := treeFileRels(plan.added); len(rels) != 3 || rels[0] != `a.md` || rels[1] != `b.md` || rels[2] != `docs/d.md` {
+		t.Fatalf(`added:%v`, rels)
+	}
+	olds := make([]msql.Params, 0)
+	for i, treeFile := range plan.added {
+		olds = append(olds, msql.Params{`id`: cast.ToString(i + 1), `doc_url`: treeFile.rel, `file_hash`: treeFile.hash})
+	}
+
+	//update,skip the unchanged hash,remove
+	writeRepoFiles(t, work, map[string]string{`a.md`: `# a changed`, `b.md`: ``, `docs/c.md`: `# c`}, `change`)
+	plan = sync(olds)
+	if rels := treeFileRels(plan.added); len(rels) != 1 || rels[0] != `docs/c.md` {
+		t.Fatalf(`added:%v`, rels)
+	}
+	if rels := treeFileRels(plan.updated); len(rels) != 1 || rels[0] != `a.md` || plan.updated[0].hash != tool.MD5(`# a changed`) {
+		t.Fatalf(`updated:%v`, rels)
+	}
+	if plan.unchanged != 1 {
+		t.Fatalf(`unchanged:%d`, plan.unchanged)
+	}
+	if len(plan.deleted) != 1 || plan.deleted[0][`doc_url`] != `b.md` {
+		t.Fatalf(`deleted:%v`, plan.deleted)
+	}
+
+	//the globs matching nothing keep the files of the library
+	repo[`include_globs`] = `*.pdf`
+	dir, _, err := pullRepoTree(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := walkRepoTree(dir, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = planRepoSync(files, olds); err == nil || len(plan.deleted) > 0 {
+		t.Fatalf(`an empty tree should not delete the files:%v/%v`, err, plan.deleted)
+	}
+}
+
+func TestRepoSyncPlanDeleteLimit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), `a.md`)
+	if err := os.WriteFile(file, []byte(`# a`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	olds := make([]msql.Params, 0)
+	for i := 0; i < define.RepoSyncDeleteLimit+50; i++ {
+		olds = append(olds, msql.Params{`id`: cast.ToString(i + 1), `doc_url`: cast.ToString(i) + `.md`})
+	}
+	plan, err := planRepoSync(map[string]string{`a.md`: file}, olds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.added) != 1 || len(plan.deleted) != define.RepoSyncDeleteLimit {
+		t.Fatalf(`added:%d,deleted:%d`, len(plan.added), len(plan.deleted))
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+	"github.com/zhimaAi/llm_adaptor/adaptor"
+)
+
+func GetLibraryRouteParams(robot msql.Params) define.LibraryRouteParams {
+	params := define.LibraryRouteParams{RouteType: define.LibraryRouteOff, TopN: 3, Threshold: 0.3}
+	if _, ok := robot[`library_route_type`]; !ok {
+		return params
+	}
+	params.RouteType = cast.ToInt(robot[`library_route_type`])
+	params.TopN = cast.ToInt(robot[`library_route_top_n`])
+	params.Threshold = cast.ToFloat64(robot[`library_route_threshold`])
+	return params
+}
+
+func CheckLibraryRouteParams(c *gin.Context, robot msql.Params) (define.LibraryRouteParams, error) {
+	params := GetLibraryRouteParams(robot)
+	params.RouteType = cast.ToInt(c.DefaultPostForm(`library_route_type`, cast.ToString(params.RouteType)))
+	params.TopN = cast.ToInt(c.DefaultPostForm(`library_route_top_n`, cast.ToString(params.TopN)))
+	params.Threshold = cast.ToFloat64(c.DefaultPostForm(`library_route_threshold`, cast.ToString(params.Threshold)))
+	if !tool.InArrayInt(params.RouteType, []int{define.LibraryRouteOff, define.LibraryRouteEmbedding, define.LibraryRouteLlm}) {
+		return params, errors.New(i18n.Show(GetLang(c), `param_invalid`, `library_route_type`))
+	}
+	if params.TopN < 1 || params.TopN > define.LibraryRouteTopNMax {
+		return params, errors.New(i18n.Show(GetLang(c), `param_invalid`, `library_route_top_n`))
+	}
+	if params.Threshold < 0 || params.Threshold > 1 {
+		return params, errors.New(i18n.Show(GetLang(c), `param_invalid`, `library_route_threshold`))
+	}
+	return params, nil
+}
+
+func getLibraryRouteIntro(library msql.Params) string {
+	return strings.TrimSpace(library[`library_name`] + "\n" + library[`library_intro`])
+}
+
+// routeLibraryByEmbedding the libraries are ranked by the similarity between the question and their intro
+func routeLibraryByEmbedding(params *define.ChatRequestParam, libraries []msql.Params, routeParams define.LibraryRouteParams) ([]string, []string) {
+	type scoreItem struct {
+		id    string
+		score float64
+	}
+	items := make([]scoreItem, 0)
+	selected, details := make([]string, 0), make([]string, 0)
+	for _, library := range libraries {
+		if len(strings.TrimSpace(library[`library_intro`])) == 0 {
+			selected = append(selected, library[`id`]) //no intro to route by,always searched
+			details = append(details, fmt.Sprintf(`%s(no intro)`, library[`library_name`]))
+			continue
+		}
+		modelConfigId, useModel := cast.ToInt(library[`model_config_id`]), library[`use_model`]
+		introEmbedding, err := GetVector2000(params.AdminUserId, params.Openid, params.Robot, library, msql.Params{}, modelConfigId, useModel, getLibraryRouteIntro(library))
+		if err != nil {
+			logs.Error(err.Error())
+			selected = append(selected, library[`id`])
+			continue
+		}
+		questionEmbedding, err := GetVector2000(params.AdminUserId, params.Openid, params.Robot, library, msql.Params{}, modelConfigId, useModel, params.Question)
+		if err != nil {
+			logs.Error(err.Error())
+			selected = append(selected, library[`id`])
+			continue
+		}
+		score := CosineSimilarity(ParseEmbedding(introEmbedding), ParseEmbedding(questionEmbedding))
+		details = append(details, fmt.Sprintf(`%s(%.4f)`, library[`library_name`], score))
+		if score >= routeParams.Threshold {
+			items = append(items, scoreItem{id: library[`id`], score: score})
+		}
+	}
+	if len(items) == 0 {
+		return nil, details //nothing matched by intro
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].score > items[j].score })
+	for i := 0; i < len(items) && i < routeParams.TopN; i++ {
+		selected = append(selected, items[i].id)
+	}
+	return selected, details
+}
+
+// routeLibraryByLlm the llm of the robot picks the libraries by their name and intro
+func routeLibraryByLlm(params *define.ChatRequestParam, libraries []msql.Params, routeParams define.LibraryRouteParams) ([]string, []string) {
+	lines := make([]string, 0, len(libraries))
+	for _, library := range libraries {
+		lines = append(lines, fmt.Sprintf(`%s: %s - %s`, library[`id`], library[`library_name`], strings.ReplaceAll(library[`library_intro`], "\n", ` `)))
+	}
+	prompt := strings.ReplaceAll(define.PromptDefaultLibraryRoute, `{{top_n}}`, cast.ToString(routeParams.TopN))
+	prompt = strings.ReplaceAll(prompt, `{{libraries}}`, strings.Join(lines, "\n"))
+	prompt = strings.ReplaceAll(prompt, `{{question}}`, params.Question)
+	chatResp, _, err := RequestChat(
+		params.AdminUserId,
+		params.Openid,
+		params.Robot,
+		params.AppType,
+		cast.ToInt(params.Robot[`model_config_id`]),
+		params.Robot[`use_model`],
+		[]adaptor.ZhimaChatCompletionMessage{{Role: `user`, Content: prompt}},
+		nil,
+		0.1,
+		100,
+	)
+	if err != nil {
+		logs.Error(err.Error())
+		return nil, []string{`llm error:` + err.Error()}
+	}
+	var ids []any
+	start, end := strings.Index(chatResp.Result, `[`), strings.LastIndex(chatResp.Result, `]`)
+	if start < 0 || end <= start || tool.JsonDecode(chatResp.Result[start:end+1], &ids) != nil {
+		return nil, []string{`llm result:` + chatResp.Result}
+	}
+	selected := make([]string, 0)
+	for _, id := range ids {
+		for _, library := range libraries {
+			if library[`id`] == cast.ToString(id) && !tool.InArrayString(library[`id`], selected) && len(selected) < routeParams.TopN {
+				selected = append(selected, library[`id`])
+			}
+		}
+	}
+	return selected, []string{`llm result:` + chatResp.Result}
+}
+
+// RouteLibraryIds pick the libraries relevant to the question,all of them are searched when none is picked.
+// the returned message is shown in the debug log
+func RouteLibraryIds(params *define.ChatRequestParam, libraryIds string) (string, string) {
+	routeParams := GetLibraryRouteParams(params.Robot)
+	ids := strings.Split(libraryIds, `,`)
+	if routeParams.RouteType == define.LibraryRouteOff || len(ids) <= 1 {
+		return libraryIds, ``
+	}
+	libraries := make([]msql.Params, 0, len(ids))
+	names := make(map[string]string)
+	for _, id := range ids {
+		library, err := GetLibraryInfo(cast.ToInt(id), 0)
+		if err != nil {
+			logs.Error(err.Error())
+			return libraryIds, `library route skipped:` + err.Error()
+		}
+		if len(library) > 0 {
+			libraries = append(libraries, library)
+			names[library[`id`]] = library[`library_name`]
+		}
+	}
+	var selected, details []string
+	routeType := `embedding`
+	if routeParams.RouteType == define.LibraryRouteLlm {
+		routeType = `llm`
+		selected, details = routeLibraryByLlm(params, libraries, routeParams)
+	} else {
+		selected, details = routeLibraryByEmbedding(params, libraries, routeParams)
+	}
+	selectedNames := make([]string, 0, len(selected))
+	for _, id := range selected {
+		selectedNames = append(selectedNames, names[id])
+	}
+	debug := fmt.Sprintf("route type:%s\ndetails:%s\n", routeType, strings.Join(details, `, `))
+	if len(selected) == 0 {
+		return libraryIds, debug + `selected:none, fallback to all libraries`
+	}
+	return strings.Join(selected, `,`), debug + `selected:` + strings.Join(selectedNames, `, `)
+}
@@ -27,22 +27,23 @@ type ModelCallHandler struct {
 type HandlerFunc func(config msql.Params, useModel string) (*ModelCallHandler, error)
 
 type ModelInfo struct {
-	ModelDefine               string        `json:"model_define"`
-	ModelName                 string        `json:"model_name"`
-	ModelIconUrl              string        `json:"model_icon_url"`
-	Introduce                 string        `json:"introduce"`
-	IsOffline                 bool          `json:"is_offline"`
-	SupportList               []string      `json:"support_list"`
-	SupportedType             []string      `json:"supported_type"`
-	SupportedFunctionCallList []string      `json:"supported_function_call_list"`
-	ConfigParams              []string      `json:"config_params"`
-	ConfigList                []msql.Params `json:"config_list"`
-	ApiVersions               []string      `json:"api_versions"`
-	LlmModelList              []string      `json:"llm_model_list"`
-	VectorModelList           []string      `json:"vector_model_list"`
-	RerankModelList           []string      `json:"rerank_model_list"`
-	HelpLinks                 string        `json:"help_links"`
-	CallHandlerFunc           HandlerFunc   `json:"-"`
+	ModelDefine               string         `json:"model_define"`
+	ModelName                 string         `json:"model_name"`
+	ModelIconUrl              string         `json:"model_icon_url"`
+	Introduce                 string         `json:"introduce"`
+	IsOffline                 bool           `json:"is_offline"`
+	SupportList               []string       `json:"support_list"`
+	SupportedType             []string       `json:"supported_type"`
+	SupportedFunctionCallList []string       `json:"supported_function_call_list"`
+	ConfigParams              []string       `json:"config_params"`
+	ConfigList                []msql.Params  `json:"config_list"`
+	ApiVersions               []string       `json:"api_versions"`
+	LlmModelList              []string       `json:"llm_model_list"`
+	VectorModelList           []string       `json:"vector_model_list"`
+	VectorModelMaxInput       map[string]int `json:"vector_model_max_input"`
+	RerankModelList           []string       `json:"rerank_model_list"`
+	HelpLinks                 string         `json:"help_links"`
+	CallHandlerFunc           HandlerFunc    `json:"-"`
 }
 
 const (
@@ -121,9 +122,10 @@ var ModelList = []ModelInfo{
 			`text-embedding-3-small`,
 			`text-embedding-ada-002`,
 		},
-		RerankModelList: []string{},
-		HelpLinks:       `https://openai.com/`,
-		CallHandlerFunc: GetOpenAIHandle,
+		VectorModelMaxInput: map[string]int{`text-embedding-3-large`: 8191, `text-embedding-3-small`: 8191, `text-embedding-ada-002`: 8191},
+		RerankModelList:     []string{},
+		HelpLinks:           `https://openai.com/`,
+		CallHandlerFunc:     GetOpenAIHandle,
 	},
 	{
 		ModelDefine:     ModelOpenAIAgent,
@@ -162,11 +164,12 @@ var ModelList = []ModelInfo{
 			`2024-05-01-preview`,
 			`2024-02-01`,
 		},
-		LlmModelList:    []string{`默认`},
-		VectorModelList: []string{`默认`},
-		RerankModelList: []string{},
-		HelpLinks:       `https://azure.microsoft.com/en-us/products/ai-services/openai-service`,
-		CallHandlerFunc: GetAzureHandler,
+		LlmModelList:        []string{`默认`},
+		VectorModelList:     []string{`默认`},
+		VectorModelMaxInput: map[string]int{`默认`: 8191},
+		RerankModelList:     []string{},
+		HelpLinks:           `https://azure.microsoft.com/en-us/products/ai-services/openai-service`,
+		CallHandlerFunc:     GetAzureHandler,
 	},
 	{
 		ModelDefine:   ModelAnthropicClaude,
@@ -185,10 +188,11 @@ var ModelList = []ModelInfo{
 			`claude-3-haiku-20240307`,
 			`claude-3-5-sonnet-20240620`,
 		},
-		VectorModelList: []string{`voyage-2`, `voyage-large-2`, `voyage-code-2`},
-		RerankModelList: []string{},
-		HelpLinks:       `https://claude.ai/`,
-		CallHandlerFunc: GetClaudeHandler,
+		VectorModelList:     []string{`voyage-2`, `voyage-large-2`, `voyage-code-2`},
+		VectorModelMaxInput: map[string]int{`voyage-2`: 4000, `voyage-large-2`: 16000, `voyage-code-2`: 16000},
+		RerankModelList:     []string{},
+		HelpLinks:           `https://claude.ai/`,
+		CallHandlerFunc:     GetClaudeHandler,
 	},
 	{
 		ModelDefine:   ModelGoogleGemini,
@@ -212,9 +216,10 @@ var ModelList = []ModelInfo{
 			`text-embedding-004`,
 			`embedding-001`,
 		},
-		RerankModelList: []string{},
-		HelpLinks:       `https://ai.google.dev/`,
-		CallHandlerFunc: GetGeminiHandler,
+		VectorModelMaxInput: map[string]int{`text-embedding-004`: 2048, `embedding-001`: 2048},
+		RerankModelList:     []string{},
+		HelpLinks:           `https://ai.google.dev/`,
+		CallHandlerFunc:     GetGeminiHandler,
 	},
 	{
 		ModelDefine:               ModelBaiduYiyan,
@@ -255,9 +260,10 @@ var ModelList = []ModelInfo{
 			`bge-large-en`,
 			`tao-8k`,
 		},
-		RerankModelList: []string{},
-		HelpLinks:       `https://cloud.baidu.com/`,
-		CallHandlerFunc: GetYiyanHandler,
+		VectorModelMaxInput: map[string]int{`embedding-v1`: 384, `bge-large-zh`: 512, `bge-large-en`: 512, `tao-8k`: 8192},
+		RerankModelList:     []string{},
+		HelpLinks:           `https://cloud.baidu.com/`,
+		CallHandlerFunc:     GetYiyanHandler,
 	},
 	{
 		ModelDefine:               ModelAliyunTongyi,
@@ -284,9 +290,10 @@ var ModelList = []ModelInfo{
 			`text-embedding-v1`,
 			`text-embedding-v2`,
 		},
-		RerankModelList: []string{},
-		HelpLinks:       `https://dashscope.aliyun.com/?spm=a2c4g.11186623.nav-dropdown-menu-0.142.6d1b46c1EeV28g&scm=20140722.X_data-37f0c4e3bf04683d35bc._.V_1`,
-		CallHandlerFunc: GetTongyiHandler,
+		VectorModelMaxInput: map[string]int{`text-embedding-v1`: 2048, `text-embedding-v2`: 2048},
+		RerankModelList:     []string{},
+		HelpLinks:           `https://dashscope.aliyun.com/?spm=a2c4g.11186623.nav-dropdown-menu-0.142.6d1b46c1EeV28g&scm=20140722.X_data-37f0c4e3bf04683d35bc._.V_1`,
+		CallHandlerFunc:     GetTongyiHandler,
 	},
 	{
 		ModelDefine:   ModelBaai,
@@ -303,6 +310,7 @@ var ModelList = []ModelInfo{
 		VectorModelList: []string{
 			"bge-m3",
 		},
+		VectorModelMaxInput: map[string]int{`bge-m3`: 8192},
 		RerankModelList: []string{
 			`bge-reranker-base-onnx-o4`,
 			"bge-m3",
@@ -338,6 +346,7 @@ var ModelList = []ModelInfo{
 			`embed-english-light-v2.0`,
 			`embed-multilingual-v2.0`,
 		},
+		VectorModelMaxInput: map[string]int{`embed-english-v3.0`: 512, `embed-english-light-v3.0`: 512, `embed-multilingual-v3.0`: 512, `embed-multilingual-light-v3.0`: 512, `embed-english-v2.0`: 512, `embed-english-light-v2.0`: 512, `embed-multilingual-v2.0`: 512},
 		RerankModelList: []string{
 			"rerank-english-v3.0",
 			"rerank-multilingual-v3.0",
@@ -421,6 +430,7 @@ var ModelList = []ModelInfo{
 			`jina-colbert-v1-en`,
 			`jina-embeddings-v2-base-code`,
 		},
+		VectorModelMaxInput: map[string]int{`jina-embeddings-v2-base-en`: 8192, `jina-embeddings-v2-base-zh`: 8192, `jina-embeddings-v2-base-de`: 8192, `jina-embeddings-v2-base-es`: 8192, `jina-colbert-v1-en`: 8192, `jina-embeddings-v2-base-code`: 8192},
 		RerankModelList: []string{
 			"jina-reranker-v1-base-en",
 			"jina-reranker-v1-turbo-en",
@@ -515,9 +525,10 @@ var ModelList = []ModelInfo{
 		VectorModelList: []string{
 			`默认`,
 		},
-		RerankModelList: []string{},
-		HelpLinks:       `https://cloud.tencent.com/product/hunyuan`,
-		CallHandlerFunc: GetHunyuanHandle,
+		VectorModelMaxInput: map[string]int{`默认`: 1024},
+		RerankModelList:     []string{},
+		HelpLinks:           `https://cloud.tencent.com/product/hunyuan`,
+		CallHandlerFunc:     GetHunyuanHandle,
 	},
 	{
 		ModelDefine:     ModelDoubao,
@@ -558,9 +569,10 @@ var ModelList = []ModelInfo{
 		VectorModelList: []string{
 			`Baichuan-Text-Embedding`,
 		},
-		RerankModelList: []string{},
-		HelpLinks:       `https://platform.baichuan-ai.com`,
-		CallHandlerFunc: GetBaichuanHandle,
+		VectorModelMaxInput: map[string]int{`Baichuan-Text-Embedding`: 512},
+		RerankModelList:     []string{},
+		HelpLinks:           `https://platform.baichuan-ai.com`,
+		CallHandlerFunc:     GetBaichuanHandle,
 	},
 	{
 		ModelDefine:               ModelZhipu,
@@ -584,9 +596,10 @@ var ModelList = []ModelInfo{
 		VectorModelList: []string{
 			`embedding-2`,
 		},
-		RerankModelList: []string{},
-		HelpLinks:       `https://open.bigmodel.cn/`,
-		CallHandlerFunc: GetZhipuHandle,
+		VectorModelMaxInput: map[string]int{`embedding-2`: 512},
+		RerankModelList:     []string{},
+		HelpLinks:           `https://open.bigmodel.cn/`,
+		CallHandlerFunc:     GetZhipuHandle,
 	},
 	{
 		ModelDefine:               ModelMinimax,
@@ -657,12 +670,16 @@ func GetModelCallHandler(modelConfigId int, useModel string) (*ModelCallHandler,
 }
 
 func GetVector2000(adminUserId int, openid string, robot msql.Params, library msql.Params, file msql.Params, modelConfigId int, useModel, input string) (string, error) {
-	handler, err := GetModelCallHandler(modelConfigId, useModel)
-	if err != nil {
-		return ``, err
-	}
-
-	return handler.GetVector2000(adminUserId, openid, robot, library, file, input)
+	return getVector2000WithCache(&EmbeddingCacheBuildHandler{
+		AdminUserId:   adminUserId,
+		Openid:        openid,
+		Robot:         robot,
+		Library:       library,
+		File:          file,
+		ModelConfigId: modelConfigId,
+		UseModel:      useModel,
+		Input:         input,
+	})
 }
 
 func RequestChatStream(adminUserId int, openid string, robot msql.Params, appType string, modelConfigId int, useModel string, messages []adaptor.ZhimaChatCompletionMessage, functionTools []adaptor.FunctionTool, chanStream chan sse.Event, temperature float32, maxToken int) (adaptor.ZhimaChatCompletionResponse, int64, error) {
@@ -14,6 +14,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/spf13/cast"
 	"github.com/zhimaAi/go_tools/logs"
@@ -216,18 +217,8 @@ func GetMatchLibraryParagraphByVectorSimilarity(robot msql.Params, openid, appTy
 					return
 				}
 				embeddingArr := strings.Split(embedding, ",")
-				subList, err := msql.Model(`chat_ai_library_file_data`, define.Postgres).
-					Alias("a").
-					Join(`chat_ai_library_file_data_index b`, `a.id=b.data_id`, `left`).
-					Where(`a.library_id`, `in`, libraryIds).
-					Where(`b.status`, cast.ToString(define.VectorStatusConverted)).
-					Where("vector_dims(b.embedding)", cast.ToString(len(embeddingArr))).
-					Field(`a.*`).
-					Field(fmt.Sprintf(`max(1-(b.embedding<=>'%s')) as similarity`, embedding)).
-					Order(`similarity desc`).
-					Group(`a.id`).
-					Limit(size).
-					Select()
+				query, args := buildVectorSimilarityQuery(embedding, libraryIds, len(embeddingArr), size)
+				subList, err := msql.RawValues(define.Postgres, query, nil, args...)
 				if err != nil {
 					logs.Error(err.Error())
 					return
@@ -252,35 +243,79 @@ func GetMatchLibraryParagraphByVectorSimilarity(robot msql.Params, openid, appTy
 	return result, nil
 }
 
+// buildVectorSimilarityQuery the embedding and the library ids are bound as parameters
+func buildVectorSimilarityQuery(embedding, libraryIds string, dims, size int) (string, []any) {
+	return `SELECT a.*,max(1-(b.embedding<=>$1::vector)) as similarity,` +
+		`(array_agg(b.id order by b.embedding<=>$1::vector))[1] as index_id ` +
+		`FROM "chat_ai_library_file_data" a LEFT JOIN "chat_ai_library_file_data_index" b ON a.id=b.data_id ` +
+		`WHERE a.library_id=ANY(string_to_array($2,',')::int[]) AND b.status=$3 AND vector_dims(b.embedding)=$4 ` +
+		`GROUP BY a.id ORDER BY similarity desc LIMIT $5`, []any{embedding, libraryIds, define.VectorStatusConverted, dims, size}
+}
+
+// buildFullTextMatchQuery the tsquery built from the question is bound as a parameter
+func buildFullTextMatchQuery(libraryIds, tsQuery string) (string, []any) {
+	return `SELECT id FROM "chat_ai_library_file_data_index" ` +
+		`WHERE library_id=ANY(string_to_array($1,',')::int[]) ` +
+		`AND to_tsvector('zhima_zh_parser',upper(content))@@to_tsquery('zhima_zh_parser',upper($2)) LIMIT 500`, []any{libraryIds, tsQuery}
+}
+
+func buildFullTextRankQuery(tsQuery, indexIds string, size int) (string, []any) {
+	return `SELECT b.*,a.id as index_id,` +
+		`ts_rank(to_tsvector('zhima_zh_parser',upper(a.content)),to_tsquery('zhima_zh_parser',upper($1))) as rank ` +
+		`FROM "chat_ai_library_file_data_index" a LEFT JOIN "chat_ai_library_file_data" b ON a.data_id=b.id ` +
+		`WHERE a.id=ANY(string_to_array($2,',')::bigint[]) AND b.id is not null ORDER BY rank DESC LIMIT $3`, []any{tsQuery, indexIds, size}
+}
+
+// BuildTsQuery join the tokens of the question with or,the tsquery operators in a token would break the query
+func BuildTsQuery(tokens []string) string {
+	list := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		token = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`'&|!():*<>\`, r) || unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, token)
+		if len(token) > 0 {
+			list = append(list, token)
+		}
+	}
+	return strings.Join(list, ` | `)
+}
+
 func GetMatchLibraryParagraphByFullTextSearch(question, libraryIds string, size int, similarity float64, searchType int) ([]msql.Params, error) {
 	list := make([]msql.Params, 0)
 	if !tool.InArrayInt(searchType, []int{define.SearchTypeMixed, define.SearchTypeFullText}) {
 		return list, nil
 	}
-	question = strings.ReplaceAll(question, `'`, ` `)
-	queryTokens, err := msql.Model(fmt.Sprintf(`ts_parse('zhparser', '%s')`, question), define.Postgres).ColumnArr(`token`)
+	rows, err := msql.RawValues(define.Postgres, `SELECT token FROM ts_parse('zhparser',$1)`, nil, question)
 	if err != nil {
 		return nil, err
 	}
+	queryTokens := make([]string, 0, len(rows))
+	for _, row := range rows {
+		queryTokens = append(queryTokens, row[`token`])
+	}
+	tsQuery := BuildTsQuery(queryTokens)
+	if len(tsQuery) == 0 {
+		return list, nil
+	}
 
-	ids, err := msql.Model(`chat_ai_library_file_data_index`, define.Postgres).Where(`library_id`, `in`, libraryIds).
-		Where(fmt.Sprintf(`to_tsvector('zhima_zh_parser',upper(content))@@to_tsquery('zhima_zh_parser',upper('%s'))`, strings.Join(queryTokens, " | "))).
-		Limit(500).ColumnArr(`id`)
+	query, args := buildFullTextMatchQuery(libraryIds, tsQuery)
+	rows, err = msql.RawValues(define.Postgres, query, nil, args...)
 	if err != nil {
 		return list, err
 	}
-	if len(ids) == 0 {
+	if len(rows) == 0 {
 		return list, nil
 	}
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row[`id`])
+	}
 
-	list, err = msql.Model(`chat_ai_library_file_data_index`, define.Postgres).
-		Alias("a").
-		Join("chat_ai_library_file_data b", "a.data_id=b.id", "left").
-		Where(`a.id`, `in`, strings.Join(ids, `,`)).
-		Where(`b.id is not null`).
-		Field(`b.*,a.id as index_id`).
-		Field(fmt.Sprintf(`ts_rank(to_tsvector('zhima_zh_parser',upper(a.content)),to_tsquery('zhima_zh_parser',upper('%s'))) as rank`, strings.Join(queryTokens, " | "))).
-		Order(`rank DESC`).Limit(size).Select()
+	query, args = buildFullTextRankQuery(tsQuery, strings.Join(ids, `,`), size)
+	list, err = msql.RawValues(define.Postgres, query, nil, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -372,7 +407,7 @@ func GetMatchLibraryParagraphByMergeRerank(question string, size int, vectorList
 	return RerankData(cast.ToInt(robot[`rerank_model_config_id`]), robot[`rerank_use_model`], rerankReq)
 }
 
-func GetMatchLibraryParagraphList(openid, appType, question string, optimizedQuestions []string, libraryIds string, size int, similarity float64, searchType int, robot msql.Params) ([]msql.Params, error) {
+func GetMatchLibraryParagraphList(openid, appType, question string, optimizedQuestions, hydeDrafts []string, libraryIds string, size int, similarity float64, searchType int, robot msql.Params) ([]msql.Params, error) {
 	result := make([]msql.Params, 0)
 	if len(libraryIds) == 0 {
 		return result, nil
@@ -382,30 +417,62 @@ func GetMatchLibraryParagraphList(openid, appType, question string, optimizedQue
 	}
 
 	fetchSize := 4 * size
-	var vectorList, searchList []msql.Params
+	var vectorLists, searchLists [][]msql.Params
 
 	for _, q := range append(optimizedQuestions, question) {
 		list, err := GetMatchLibraryParagraphByVectorSimilarity(robot, openid, appType, q, libraryIds, fetchSize, similarity, searchType)
 		if err != nil {
 			logs.Error(err.Error())
 		}
-		vectorList = append(vectorList, list...)
+		vectorLists = append(vectorLists, list)
 		list, err = GetMatchLibraryParagraphByFullTextSearch(q, libraryIds, fetchSize, similarity, searchType)
 		if err != nil {
 			logs.Error(err.Error())
 		}
-		searchList = append(searchList, list...)
+		searchLists = append(searchLists, list)
 	}
+	//the hypothetical answers are only compared by embedding
+	for _, draft := range hydeDrafts {
+		list, err := GetMatchLibraryParagraphByVectorSimilarity(robot, openid, appType, draft, libraryIds, fetchSize, similarity, searchType)
+		if err != nil {
+			logs.Error(err.Error())
+		}
+		vectorLists = append(vectorLists, list)
+	}
+	vectorList := MergeRankedLists(`id`, vectorLists...)
+	searchList := MergeRankedLists(`id`, searchLists...)
 
 	rerankList, err := GetMatchLibraryParagraphByMergeRerank(question, fetchSize, vectorList, searchList, robot)
 	if err != nil {
 		logs.Error(err.Error())
 	}
+	//knowledge graph expand
+	graphList, err := GetMatchLibraryParagraphByGraph(question, libraryIds, fetchSize, robot)
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	graphSummaries := make(map[string]string)
+	for _, one := range graphList {
+		graphSummaries[one[`id`]] = one[`graph_summary`]
+	}
 	//RRF sort
+	rankParams := GetRankParams(robot)
 	list := (&RRF{}).
-		Add(DataSource{List: vectorList, Key: `id`, Fixed: 60}).
-		Add(DataSource{List: searchList, Key: `id`, Fixed: 60}).
-		Add(DataSource{List: rerankList, Key: `id`, Fixed: 58}).Sort()
+		Add(DataSource{List: vectorList, Key: `id`, Fixed: rankParams.VectorK, Weight: rankParams.VectorWeight}).
+		Add(DataSource{List: searchList, Key: `id`, Fixed: rankParams.SearchK, Weight: rankParams.SearchWeight}).
+		Add(DataSource{List: rerankList, Key: `id`, Fixed: rankParams.RerankK, Weight: rankParams.RerankWeight}).
+		Add(DataSource{List: graphList, Key: `id`, Fixed: rankParams.GraphK, Weight: rankParams.GraphWeight}).Sort()
+	//min fused score
+	for i, one := range list {
+		if cast.ToFloat64(one[`fused_score`]) < rankParams.MinFusedScore {
+			list = list[:i]
+			break
+		}
+	}
+	//MMR diversity
+	if rankParams.MmrStatus == define.SwitchOn {
+		list = MmrSelect(list, size, rankParams.MmrLambda)
+	}
 
 	//return
 	for i, one := range list {
@@ -415,6 +482,9 @@ func GetMatchLibraryParagraphList(openid, appType, question string, optimizedQue
 		//replenish file info
 		fileInfo, _ := GetLibFileInfo(cast.ToInt(one[`file_id`]), 0)
 		one[`file_name`] = fileInfo[`file_name`]
+		if summary, ok := graphSummaries[one[`id`]]; ok {
+			one[`graph_summary`] = summary
+		}
 		result = append(result, one)
 	}
 	return result, nil
@@ -480,7 +550,7 @@ func SaveVector(adminUserID, libraryID, fileID, dataID int64, vectorType, conten
 	info, err := m.
 		Where(`data_id`, cast.ToString(dataID)).
 		Where(`type`, vectorType).
-		Field(`id,content`).
+		Field(`id,content,status`).
 		Find()
 	if err != nil {
 		logs.Error(err.Error())
@@ -504,20 +574,25 @@ func SaveVector(adminUserID, libraryID, fileID, dataID int64, vectorType, conten
 		}
 		return id, nil
 	} else {
-		if info[`content`] == content {
+		//the unchanged content is converted again only when it failed
+		if info[`content`] == content && cast.ToInt(info[`status`]) != define.VectorStatusException {
 			return 0, nil
 		} else {
 			_, err = m.
 				Where(`id`, info[`id`]).
 				Update(msql.Datas{
-					`status`:  define.VectorStatusInitial,
-					`errmsg`:  ``,
-					`content`: content,
+					`status`:        define.VectorStatusInitial,
+					`errmsg`:        ``,
+					`content`:       content,
+					`shadow_status`: define.VectorStatusInitial,
+					`retry_times`:   0,
+					`retry_time`:    0,
 				})
 			if err != nil {
 				logs.Error(err.Error())
 				return 0, err
 			}
+			DeleteDeadVector(info[`id`])
 			return cast.ToInt64(info[`id`]), nil
 		}
 	}
@@ -0,0 +1,52 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zhimaAi/go_tools/logs"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp(``, `common_test_logs`)
+	if err != nil {
+		panic(err)
+	}
+	logs.SetLogsDir(dir)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	_ = os.RemoveAll(`logs`) //written by the i18n init,the locale files are not found from the package directory
+	os.Exit(code)
+}
+
+func TestBuildTsQuery(t *testing.T) {
+	cases := []struct {
+		name   string
+		tokens []string
+		want   string
+	}{
+		{name: `empty`, tokens: nil, want: ``},
+		{name: `plain`, tokens: []string{`知识库`, `chatwiki`}, want: `知识库 | chatwiki`},
+		{name: `quote`, tokens: []string{`it's`, `'`}, want: `its`},
+		{name: `operators`, tokens: []string{`a&b|c!d`, `(x):*`, `<->`, `\`}, want: `abcd | x | -`},
+		{name: `whitespace`, tokens: []string{` a b `, "\t", "c\nd", "　"}, want: `ab | cd`},
+		{name: `only operators`, tokens: []string{`&|!():*<>\`, `''`}, want: ``},
+		{name: `sql`, tokens: []string{`1'); DROP TABLE x; --`}, want: `1;DROPTABLEx;--`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := BuildTsQuery(c.tokens)
+			if got != c.want {
+				t.Fatalf(`BuildTsQuery(%q)=%q,want %q`, c.tokens, got, c.want)
+			}
+			for _, token := range strings.Split(got, ` | `) {
+				if strings.ContainsAny(token, `'&|!():*<>\`) {
+					t.Fatalf(`operator left in token %q`, token)
+				}
+			}
+		})
+	}
+}
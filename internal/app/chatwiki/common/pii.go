@@ -0,0 +1,229 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+type PiiPattern struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+type PiiHit struct {
+	Number   int    `json:"number"`
+	Detector string `json:"detector"`
+	HitTotal int    `json:"hit_total"`
+}
+
+type piiDetector struct {
+	name  string
+	regex *regexp.Regexp
+	check func(string) bool
+}
+
+var piiBuiltinRegex = map[string]*regexp.Regexp{
+	`email`:        regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	`cn_id_card`:   regexp.MustCompile(`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`),
+	`cn_mobile`:    regexp.MustCompile(`(?:\+86[\- ]?)?\b1[3-9]\d{9}\b`),
+	`cn_bank_card`: regexp.MustCompile(`\b62\d{14,17}\b`),
+	`eu_iban`:      regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`),
+	`eu_phone`:     regexp.MustCompile(`\+(?:3\d|4\d)(?:[ \-]?\d){6,12}\b`),
+	`us_ssn`:       regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	`us_phone`:     regexp.MustCompile(`(?:\+1[ .\-]?)?(?:\(\d{3}\) ?|\b\d{3}[ .\-])\d{3}[ .\-]\d{4}\b`),
+	`credit_card`:  regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`),
+}
+
+// piiBuiltinCheck the checksum of the matched text,to reduce the false positives of the long numbers
+var piiBuiltinCheck = map[string]func(string) bool{
+	`cn_id_card`:   checkCnIdCard,
+	`cn_bank_card`: checkLuhn,
+	`eu_iban`:      checkIban,
+	`credit_card`:  checkLuhn,
+}
+
+func IsPiiBuiltinDetector(name string) bool {
+	_, ok := piiBuiltinRegex[name]
+	return ok
+}
+
+func checkLuhn(s string) bool {
+	sum, double, count := 0, false, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		n := int(s[i] - '0')
+		if double {
+			if n *= 2; n > 9 {
+				n -= 9
+			}
+		}
+		sum, double, count = sum+n, !double, count+1
+	}
+	return count >= 13 && sum%10 == 0
+}
+
+func checkCnIdCard(s string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(s[i]-'0') * w
+	}
+	return strings.ToUpper(s[17:]) == string("10X98765432"[sum%11])
+}
+
+func checkIban(s string) bool {
+	s = strings.ReplaceAll(s, ` `, ``)
+	s = s[4:] + s[:4]
+	remainder := 0
+	for _, r := range s {
+		n := int(r - '0')
+		if r >= 'A' && r <= 'Z' {
+			n = int(r-'A') + 10
+			remainder = remainder * 10 % 97
+		}
+		remainder = (remainder*10 + n) % 97
+	}
+	return remainder == 1
+}
+
+// ParsePiiPatterns the custom patterns of the library,saved as json
+func ParsePiiPatterns(str string) ([]PiiPattern, error) {
+	patterns := make([]PiiPattern, 0)
+	if len(strings.TrimSpace(str)) == 0 {
+		return patterns, nil
+	}
+	if err := tool.JsonDecode(str, &patterns); err != nil {
+		return nil, err
+	}
+	if len(patterns) > define.PiiCustomPatternMax {
+		return nil, errors.New(`too many custom patterns`)
+	}
+	names := make(map[string]bool)
+	for i := range patterns {
+		patterns[i].Name = strings.TrimSpace(patterns[i].Name)
+		if len(patterns[i].Name) == 0 || utf8.RuneCountInString(patterns[i].Name) > define.PiiCustomNameMaxLen ||
+			IsPiiBuiltinDetector(patterns[i].Name) || names[patterns[i].Name] {
+			return nil, errors.New(`invalid custom pattern name:` + patterns[i].Name)
+		}
+		names[patterns[i].Name] = true
+		if len(patterns[i].Pattern) == 0 || len(patterns[i].Pattern) > define.PiiCustomPatternMaxLen {
+			return nil, errors.New(`invalid custom pattern:` + patterns[i].Name)
+		}
+		if _, err := regexp.Compile(patterns[i].Pattern); err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
+
+func getPiiDetectors(library msql.Params) ([]piiDetector, error) {
+	enabled := strings.Split(library[`pii_detectors`], `,`)
+	detectors := make([]piiDetector, 0)
+	for _, item := range define.PiiDetectorList {
+		name := cast.ToString(item[`name`])
+		if tool.InArrayString(name, enabled) {
+			detectors = append(detectors, piiDetector{name: name, regex: piiBuiltinRegex[name], check: piiBuiltinCheck[name]})
+		}
+	}
+	patterns, err := ParsePiiPatterns(library[`pii_patterns`])
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range patterns {
+		detectors = append(detectors, piiDetector{name: pattern.Name, regex: regexp.MustCompile(pattern.Pattern)})
+	}
+	return detectors, nil
+}
+
+// redactPiiText the hits of each detector,the matched text is replaced when mask is true
+func redactPiiText(detectors []piiDetector, text string, mask bool, hits map[string]int) string {
+	for _, detector := range detectors {
+		text = detector.regex.ReplaceAllStringFunc(text, func(match string) string {
+			if len(match) == 0 || (detector.check != nil && !detector.check(match)) {
+				return match
+			}
+			hits[detector.name]++
+			if !mask {
+				return match
+			}
+			return strings.Repeat(`*`, utf8.RuneCountInString(match))
+		})
+	}
+	return text
+}
+
+// RedactPii the redaction stage between the split and the save,
+// the paragraphs are masked,dropped or flagged by the detectors of the library
+func RedactPii(library msql.Params, isQaDoc int, list []define.DocSplitItem) ([]define.DocSplitItem, []PiiHit, error) {
+	hits := make([]PiiHit, 0)
+	if cast.ToInt(library[`pii_status`]) != define.SwitchOn {
+		return list, hits, nil
+	}
+	detectors, err := getPiiDetectors(library)
+	if err != nil || len(detectors) == 0 {
+		return list, hits, err
+	}
+	action := cast.ToInt(library[`pii_action`])
+	result := make([]define.DocSplitItem, 0, len(list))
+	for _, item := range list {
+		counts := make(map[string]int)
+		//the breadcrumbs of the structure mode are embedded with the content
+		item.Title = redactPiiText(detectors, item.Title, action == define.PiiActionMask, counts)
+		if isQaDoc == define.DocTypeQa {
+			item.Question = redactPiiText(detectors, item.Question, action == define.PiiActionMask, counts)
+			item.Answer = redactPiiText(detectors, item.Answer, action == define.PiiActionMask, counts)
+		} else {
+			item.Content = redactPiiText(detectors, item.Content, action == define.PiiActionMask, counts)
+		}
+		for _, detector := range detectors {
+			if counts[detector.name] > 0 {
+				hits = append(hits, PiiHit{Number: item.Number, Detector: detector.name, HitTotal: counts[detector.name]})
+			}
+		}
+		if action == define.PiiActionDrop && len(counts) > 0 {
+			continue
+		}
+		result = append(result, item)
+	}
+	for i := range result {
+		result[i].Number = i + 1 //serial number after the dropped paragraphs
+	}
+	return result, hits, nil
+}
+
+// SavePiiReport replace the redaction report of the file with the hits of this learning
+func SavePiiReport(info, library msql.Params, hits []PiiHit) {
+	m := msql.Model(`chat_ai_library_file_pii`, define.Postgres)
+	if _, err := m.Where(`file_id`, info[`id`]).Delete(); err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	for _, hit := range hits {
+		_, err := m.Insert(msql.Datas{
+			`admin_user_id`: info[`admin_user_id`],
+			`library_id`:    info[`library_id`],
+			`file_id`:       info[`id`],
+			`number`:        hit.Number,
+			`detector`:      hit.Detector,
+			`hit_total`:     hit.HitTotal,
+			`action`:        cast.ToInt(library[`pii_action`]),
+			`create_time`:   tool.Time2Int(),
+		})
+		if err != nil {
+			logs.Error(err.Error())
+			return
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/app/chatwiki/i18n"
+	"chatwiki/internal/pkg/lib_redis"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+	"github.com/zhimaAi/llm_adaptor/adaptor"
+)
+
+type QaPair struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+func parseQaPairs(result string, num int) ([]QaPair, error) {
+	start, end := strings.Index(result, `[`), strings.LastIndex(result, `]`)
+	if start < 0 || end <= start {
+		return nil, errors.New(`qa generate result is not a json array:` + result)
+	}
+	var pairs []QaPair
+	if err := json.Unmarshal([]byte(result[start:end+1]), &pairs); err != nil {
+		return nil, err
+	}
+	list := make([]QaPair, 0, len(pairs))
+	for _, pair := range pairs {
+		pair.Question, pair.Answer = strings.TrimSpace(pair.Question), strings.TrimSpace(pair.Answer)
+		if len(pair.Question) == 0 || len(pair.Answer) == 0 ||
+			utf8.RuneCountInString(pair.Question) > MaxContent || utf8.RuneCountInString(pair.Answer) > MaxContent {
+			continue
+		}
+		list = append(list, pair)
+		if len(list) >= num {
+			break
+		}
+	}
+	return list, nil
+}
+
+func GenerateQaPairs(job, paragraph msql.Params) ([]QaPair, error) {
+	num := cast.ToInt(job[`pair_num`])
+	prompt := strings.ReplaceAll(define.PromptDefaultQaGenerate, `{{num}}`, cast.ToString(num))
+	prompt = strings.ReplaceAll(prompt, `{{content}}`, paragraph[`content`])
+	messages := []adaptor.ZhimaChatCompletionMessage{{Role: `user`, Content: prompt}}
+	chatResp, _, err := RequestChat(
+		cast.ToInt(job[`admin_user_id`]),
+		``,
+		msql.Params{},
+		``,
+		cast.ToInt(job[`model_config_id`]),
+		job[`use_model`],
+		messages,
+		nil,
+		0.3,
+		1000*num,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return parseQaPairs(chatResp.Result, num)
+}
+
+// RunQaGenerate generate the candidates of the normal paragraphs of the file,
+// the paragraphs that already have candidates are skipped when the job is resumed
+func RunQaGenerate(job msql.Params) error {
+	paragraphs, err := msql.Model(`chat_ai_library_file_data`, define.Postgres).
+		Where(`file_id`, job[`file_id`]).
+		Where(`type`, cast.ToString(define.ParagraphTypeNormal)).
+		Field(`id,number,page_num,title,content,images`).Order(`number,id`).Select()
+	if err != nil {
+		return err
+	}
+	m := msql.Model(`chat_ai_library_qa_candidate`, define.Postgres)
+	done, err := m.Where(`generate_id`, job[`id`]).ColumnArr(`data_id`)
+	if err != nil {
+		return err
+	}
+	jm := msql.Model(`chat_ai_library_qa_generate`, define.Postgres)
+	if _, err = jm.Where(`id`, job[`id`]).Update(msql.Datas{`paragraph_total`: len(paragraphs), `update_time`: tool.Time2Int()}); err != nil {
+		return err
+	}
+	var lastErr error
+	processed, failed := 0, 0
+	for _, paragraph := range paragraphs {
+		processed++
+		if tool.InArrayString(paragraph[`id`], done) {
+			continue
+		}
+		pairs, err := GenerateQaPairs(job, paragraph)
+		if err != nil {
+			logs.Error(`qa generate:%s/%s`, paragraph[`id`], err.Error())
+			lastErr, failed = err, failed+1
+		}
+		for _, pair := range pairs {
+			_, err = m.Insert(msql.Datas{
+				`admin_user_id`: job[`admin_user_id`],
+				`library_id`:    job[`library_id`],
+				`generate_id`:   job[`id`],
+				`file_id`:       job[`file_id`],
+				`data_id`:       paragraph[`id`],
+				`number`:        cast.ToInt(paragraph[`number`]),
+				`page_num`:      cast.ToInt(paragraph[`page_num`]),
+				`title`:         paragraph[`title`],
+				`question`:      pair.Question,
+				`answer`:        pair.Answer,
+				`images`:        paragraph[`images`],
+				`status`:        define.QaCandidateStatusPending,
+				`create_time`:   tool.Time2Int(),
+				`update_time`:   tool.Time2Int(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		pairTotal, err := m.Where(`generate_id`, job[`id`]).Count(`1`)
+		if err != nil {
+			return err
+		}
+		_, err = jm.Where(`id`, job[`id`]).Update(msql.Datas{
+			`processed_total`: processed,
+			`failed_total`:    failed,
+			`pair_total`:      pairTotal,
+			`update_time`:     tool.Time2Int(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if lastErr != nil && failed == len(paragraphs)-len(done) {
+		return lastErr //the llm failed for all the paragraphs
+	}
+	return nil
+}
+
+// SaveQaCandidates save the accepted candidates as the qa paragraphs of a custom qa file,
+// the file of the job is learned again with all the accepted candidates when it is saved again
+func SaveQaCandidates(userId, libraryId int, job msql.Params, lang string) (int, error) {
+	candidates, err := msql.Model(`chat_ai_library_qa_candidate`, define.Postgres).
+		Where(`generate_id`, job[`id`]).
+		Where(`status`, `in`, cast.ToString(define.QaCandidateStatusAccepted)+`,`+cast.ToString(define.QaCandidateStatusSaved)).
+		Order(`number,id`).Select()
+	if err != nil {
+		logs.Error(err.Error())
+		return 0, errors.New(i18n.Show(lang, `sys_err`))
+	}
+	if len(candidates) == 0 {
+		return 0, errors.New(i18n.Show(lang, `no_data`))
+	}
+	list, wordTotal := make([]define.DocSplitItem, 0, len(candidates)), 0
+	for _, candidate := range candidates {
+		item := define.DocSplitItem{
+			PageNum:  cast.ToInt(candidate[`page_num`]),
+			Title:    candidate[`title`],
+			Question: candidate[`question`],
+			Answer:   candidate[`answer`],
+		}
+		_ = tool.JsonDecode(candidate[`images`], &item.Images)
+		wordTotal += utf8.RuneCountInString(item.Question + item.Answer)
+		list = append(list, item)
+	}
+	qaFileId := cast.ToInt(job[`qa_file_id`])
+	if qaFileId > 0 {
+		if info, err := GetLibFileInfo(qaFileId, userId); err != nil {
+			logs.Error(err.Error())
+			return 0, errors.New(i18n.Show(lang, `sys_err`))
+		} else if len(info) == 0 || cast.ToInt(info[`library_id`]) != libraryId {
+			qaFileId = 0 //deleted or saved to another library
+		} else if cast.ToInt(info[`status`]) != define.FileStatusLearning {
+			//wait split:the file is saved even if the word total is the same as the current one
+			_, err = msql.Model(`chat_ai_library_file`, define.Postgres).Where(`id`, cast.ToString(qaFileId)).
+				Update(msql.Datas{`status`: define.FileStatusWaitSplit, `update_time`: tool.Time2Int()})
+			if err != nil {
+				logs.Error(err.Error())
+				return 0, errors.New(i18n.Show(lang, `sys_err`))
+			}
+			//clear cached data
+			lib_redis.DelCacheData(define.Redis, &LibFileCacheBuildHandler{FileId: qaFileId})
+		}
+	}
+	if qaFileId == 0 {
+		source, err := GetLibFileInfo(cast.ToInt(job[`file_id`]), userId)
+		if err != nil {
+			logs.Error(err.Error())
+			return 0, errors.New(i18n.Show(lang, `sys_err`))
+		}
+		uploadInfo := &define.UploadInfo{
+			Name: MbSubstr(strings.TrimSuffix(source[`file_name`], `.`+source[`file_ext`])+` QA`, 0, 100), Size: 0, Ext: `-`, Custom: true,
+			Link: define.LocalUploadPrefix + `default/empty_document.pdf`,
+		}
+		fileId, err := InsertLibraryFile(userId, libraryId, uploadInfo, msql.Datas{
+			`status`:        define.FileStatusLearned,
+			`html_url`:      uploadInfo.Link,
+			`is_qa_doc`:     define.DocTypeQa,
+			`qa_index_type`: define.QAIndexTypeQuestionAndAnswer,
+		})
+		if err != nil {
+			logs.Error(err.Error())
+			return 0, errors.New(i18n.Show(lang, `sys_err`))
+		}
+		qaFileId = int(fileId)
+	}
+	splitParams := define.SplitParams{IsQaDoc: define.DocTypeQa}
+	if err = SaveLibFileSplit(userId, qaFileId, wordTotal, define.QAIndexTypeQuestionAndAnswer, splitParams, list, lang); err != nil {
+		return 0, err
+	}
+	_, err = msql.Model(`chat_ai_library_qa_candidate`, define.Postgres).
+		Where(`generate_id`, job[`id`]).
+		Where(`status`, cast.ToString(define.QaCandidateStatusAccepted)).
+		Update(msql.Datas{`status`: define.QaCandidateStatusSaved, `update_time`: tool.Time2Int()})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	_, err = msql.Model(`chat_ai_library_qa_generate`, define.Postgres).Where(`id`, job[`id`]).
+		Update(msql.Datas{`qa_file_id`: qaFileId, `update_time`: tool.Time2Int()})
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	return qaFileId, nil
+}
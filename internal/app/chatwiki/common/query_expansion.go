@@ -0,0 +1,78 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/llm_adaptor/adaptor"
+)
+
+// GetQueryExpansionType the robots saved before the selector keep the question optimize switch
+func GetQueryExpansionType(robot msql.Params) int {
+	if expansionType, ok := robot[`query_expansion_type`]; ok {
+		return cast.ToInt(expansionType)
+	}
+	if cast.ToBool(robot[`enable_question_optimize`]) {
+		return define.QueryExpansionMulti
+	}
+	return define.QueryExpansionNone
+}
+
+// GetHydeDrafts draft a hypothetical answer to be embedded instead of the terse question,
+// generated by the hyde model or the robot model when it is not set
+func GetHydeDrafts(param *define.ChatRequestParam, contextList []map[string]string) ([]string, error) {
+	histories := ""
+	for _, context := range contextList {
+		histories += "Q: " + context[`question`] + "\n"
+		histories += "A: " + context[`answer`] + "\n"
+	}
+	prompt := strings.ReplaceAll(define.PromptDefaultHyde, `{{query}}`, param.Question)
+	prompt = strings.ReplaceAll(prompt, `{{histories}}`, histories)
+
+	modelConfigId, useModel := cast.ToInt(param.Robot[`hyde_model_config_id`]), param.Robot[`hyde_use_model`]
+	if modelConfigId == 0 {
+		modelConfigId, useModel = cast.ToInt(param.Robot[`model_config_id`]), param.Robot[`use_model`]
+	}
+	chatResp, _, err := RequestChat(
+		param.AdminUserId,
+		param.Openid,
+		param.Robot,
+		param.AppType,
+		modelConfigId,
+		useModel,
+		[]adaptor.ZhimaChatCompletionMessage{{Role: `user`, Content: prompt}},
+		nil,
+		0.3,
+		400,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if draft := strings.TrimSpace(chatResp.Result); len(draft) > 0 {
+		return []string{draft}, nil
+	}
+	return nil, nil
+}
+
+// ExpandQuery the optimized questions are used by all retrievals,the hyde drafts only by the vector retrieval
+func ExpandQuery(param *define.ChatRequestParam, contextList []map[string]string) ([]string, []string) {
+	var optimizedQuestions, hydeDrafts []string
+	var err error
+	expansionType := GetQueryExpansionType(param.Robot)
+	if expansionType == define.QueryExpansionMulti || expansionType == define.QueryExpansionBoth {
+		if optimizedQuestions, err = GetOptimizedQuestions(param, contextList); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	if expansionType == define.QueryExpansionHyde || expansionType == define.QueryExpansionBoth {
+		if hydeDrafts, err = GetHydeDrafts(param, contextList); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	return optimizedQuestions, hydeDrafts
+}
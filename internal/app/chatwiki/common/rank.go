@@ -0,0 +1,127 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"math"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+)
+
+func DefaultRankParams() define.RankParams {
+	return define.RankParams{
+		VectorWeight: 1, VectorK: 60,
+		SearchWeight: 1, SearchK: 60,
+		RerankWeight: 1, RerankK: 58,
+		MmrStatus: define.SwitchOff, MmrLambda: 0.7,
+		GraphStatus: define.SwitchOff, GraphWeight: 1, GraphK: 60,
+	}
+}
+
+// GetRankParams robot info without the rank fields(e.g. recall test) uses the default value
+func GetRankParams(robot msql.Params) define.RankParams {
+	params := DefaultRankParams()
+	if _, ok := robot[`rrf_vector_k`]; !ok {
+		return params
+	}
+	params.VectorWeight = cast.ToFloat64(robot[`rrf_vector_weight`])
+	params.VectorK = cast.ToInt(robot[`rrf_vector_k`])
+	params.SearchWeight = cast.ToFloat64(robot[`rrf_search_weight`])
+	params.SearchK = cast.ToInt(robot[`rrf_search_k`])
+	params.RerankWeight = cast.ToFloat64(robot[`rrf_rerank_weight`])
+	params.RerankK = cast.ToInt(robot[`rrf_rerank_k`])
+	params.MmrStatus = cast.ToInt(robot[`mmr_status`])
+	params.MmrLambda = cast.ToFloat64(robot[`mmr_lambda`])
+	params.MinFusedScore = cast.ToFloat64(robot[`min_fused_score`])
+	if _, ok := robot[`rrf_graph_k`]; ok {
+		params.GraphStatus = cast.ToInt(robot[`graph_status`])
+		params.GraphWeight = cast.ToFloat64(robot[`rrf_graph_weight`])
+		params.GraphK = cast.ToInt(robot[`rrf_graph_k`])
+	}
+	return params
+}
+
+func ParseEmbedding(embedding string) []float64 {
+	embedding = strings.Trim(strings.TrimSpace(embedding), `[]`)
+	if len(embedding) == 0 {
+		return nil
+	}
+	items := strings.Split(embedding, `,`)
+	vector := make([]float64, len(items))
+	for i, item := range items {
+		vector[i] = cast.ToFloat64(strings.TrimSpace(item))
+	}
+	return vector
+}
+
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// MmrSelect maximal marginal relevance re-selection,
+// relevance is the fused_score, redundancy is computed by the stored embeddings of the matched index
+func MmrSelect(list []msql.Params, size int, lambda float64) []msql.Params {
+	if len(list) <= 1 || size <= 0 {
+		return list
+	}
+	indexIds := make([]string, 0)
+	for _, one := range list {
+		if cast.ToInt(one[`index_id`]) > 0 {
+			indexIds = append(indexIds, one[`index_id`])
+		}
+	}
+	vectors := make(map[string][]float64)
+	if len(indexIds) > 0 {
+		embeddings, err := msql.Model(`chat_ai_library_file_data_index`, define.Postgres).
+			Where(`id`, `in`, strings.Join(indexIds, `,`)).
+			Where(`status`, cast.ToString(define.VectorStatusConverted)).
+			ColumnMap(`embedding::text as embedding`, `id`)
+		if err != nil {
+			logs.Error(err.Error())
+		}
+		for id, one := range embeddings {
+			vectors[id] = ParseEmbedding(one[`embedding`])
+		}
+	}
+	candidates := make([]int, len(list))
+	for i := range list {
+		candidates[i] = i
+	}
+	selected := make([]int, 0, size)
+	for len(selected) < size && len(candidates) > 0 {
+		best, bestScore := 0, math.Inf(-1)
+		for ci, i := range candidates {
+			var redundancy float64
+			for _, j := range selected {
+				redundancy = max(redundancy, CosineSimilarity(vectors[list[i][`index_id`]], vectors[list[j][`index_id`]]))
+			}
+			score := lambda*cast.ToFloat64(list[i][`fused_score`]) - (1-lambda)*redundancy
+			if score > bestScore {
+				best, bestScore = ci, score
+			}
+		}
+		selected = append(selected, candidates[best])
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+	result := make([]msql.Params, 0, len(selected))
+	for _, i := range selected {
+		result = append(result, list[i])
+	}
+	return result
+}
@@ -0,0 +1,129 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/pkg/lib_redis"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+func GetRunningReindex(libraryId int) (msql.Params, error) {
+	return msql.Model(`chat_ai_library_reindex`, define.Postgres).
+		Where(`library_id`, cast.ToString(libraryId)).
+		Where(`status`, `in`, fmt.Sprintf(`%d,%d`, define.ReindexStatusRunning, define.ReindexStatusSwitched)).
+		Order(`id desc`).Find()
+}
+
+func UpdateReindexProgress(reindex msql.Params) (msql.Datas, error) {
+	stats, err := msql.Model(`chat_ai_library_file_data_index`, define.Postgres).
+		Where(`library_id`, reindex[`library_id`]).
+		Field(`count(1) as total`).
+		Field(fmt.Sprintf(`count(1) filter (where shadow_status=%d) as converted_total`, define.VectorStatusConverted)).
+		Field(fmt.Sprintf(`count(1) filter (where shadow_status=%d) as error_total`, define.VectorStatusException)).
+		Find()
+	if err != nil {
+		return nil, err
+	}
+	data := msql.Datas{
+		`total`:           cast.ToInt(stats[`total`]),
+		`converted_total`: cast.ToInt(stats[`converted_total`]),
+		`error_total`:     cast.ToInt(stats[`error_total`]),
+		`update_time`:     tool.Time2Int(),
+	}
+	_, err = msql.Model(`chat_ai_library_reindex`, define.Postgres).Where(`id`, reindex[`id`]).Update(data)
+	return data, err
+}
+
+// swapReindexVectors swap embedding and shadow_embedding and set the library model in one transaction,
+// the vectors not in use are kept in shadow_embedding for rollback
+func swapReindexVectors(reindex msql.Params, modelConfigId, useModel string, status int) error {
+	m := msql.Model(`chat_ai_library_file_data_index`, define.Postgres)
+	if err := m.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = m.Rollback()
+	}()
+	_, err := m.Where(`library_id`, reindex[`library_id`]).
+		Where(`shadow_status`, cast.ToString(define.VectorStatusConverted)).
+		Update2(`embedding=shadow_embedding,shadow_embedding=embedding`)
+	if err != nil {
+		return err
+	}
+	_, err = m.Table(`chat_ai_library`).Where(`id`, reindex[`library_id`]).Update(msql.Datas{
+		`model_config_id`: modelConfigId,
+		`use_model`:       useModel,
+		`update_time`:     tool.Time2Int(),
+	})
+	if err != nil {
+		return err
+	}
+	data := msql.Datas{`status`: status, `update_time`: tool.Time2Int()}
+	if status == define.ReindexStatusSwitched {
+		data[`switch_time`] = tool.Time2Int()
+	}
+	_, err = m.Table(`chat_ai_library_reindex`).Where(`id`, reindex[`id`]).Update(data)
+	if err != nil {
+		return err
+	}
+	if err = m.Commit(); err != nil {
+		return err
+	}
+	//clear cached data
+	lib_redis.DelCacheData(define.Redis, &LibraryCacheBuildHandler{LibraryId: cast.ToInt(reindex[`library_id`])})
+	return nil
+}
+
+func SwitchReindex(reindex msql.Params) error {
+	if cast.ToInt(reindex[`status`]) != define.ReindexStatusRunning {
+		return errors.New(`reindex status is not running`)
+	}
+	return swapReindexVectors(reindex, reindex[`new_model_config_id`], reindex[`new_use_model`], define.ReindexStatusSwitched)
+}
+
+func RollbackReindex(reindex msql.Params) error {
+	if cast.ToInt(reindex[`status`]) != define.ReindexStatusSwitched {
+		return errors.New(`reindex status is not switched`)
+	}
+	if err := swapReindexVectors(reindex, reindex[`old_model_config_id`], reindex[`old_use_model`], define.ReindexStatusRolledBack); err != nil {
+		return err
+	}
+	//the index added or modified after switching has no original vector,convert again
+	m := msql.Model(`chat_ai_library_file_data_index`, define.Postgres)
+	list, err := m.Where(`library_id`, reindex[`library_id`]).
+		Where(`shadow_status`, `<>`, cast.ToString(define.VectorStatusConverted)).
+		Field(`id,file_id`).Select()
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	for _, one := range list {
+		_, err = m.Where(`id`, one[`id`]).Update(msql.Datas{`status`: define.VectorStatusInitial, `errmsg`: ``})
+		if err != nil {
+			logs.Error(err.Error())
+			continue
+		}
+		if message, err := tool.JsonEncode(map[string]any{`id`: one[`id`], `file_id`: one[`file_id`]}); err != nil {
+			logs.Error(err.Error())
+		} else if err := AddJobs(define.ConvertVectorTopic, message); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	return ClearReindexShadow(cast.ToInt(reindex[`library_id`]))
+}
+
+func ClearReindexShadow(libraryId int) error {
+	_, err := msql.Model(`chat_ai_library_file_data_index`, define.Postgres).
+		Where(`library_id`, cast.ToString(libraryId)).
+		Update2(fmt.Sprintf(`shadow_embedding=null,shadow_status=%d`, define.VectorStatusInitial))
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	return err
+}
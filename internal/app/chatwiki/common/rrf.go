@@ -5,13 +5,15 @@ package common
 import (
 	"sort"
 
+	"github.com/spf13/cast"
 	"github.com/zhimaAi/go_tools/msql"
 )
 
 type DataSource struct {
-	List  []msql.Params
-	Key   string
-	Fixed int
+	List   []msql.Params
+	Key    string
+	Fixed  int
+	Weight float64
 }
 
 type RRF struct {
@@ -19,7 +21,7 @@ type RRF struct {
 }
 
 func (r *RRF) Add(ds DataSource) *RRF {
-	if len(ds.List) == 0 {
+	if len(ds.List) == 0 || ds.Weight <= 0 {
 		return r
 	}
 	if r.dataSources == nil {
@@ -46,13 +48,44 @@ func (r RrfScoreList) Swap(i, j int) {
 	r[i], r[j] = r[j], r[i]
 }
 
+// MergeRankedLists merge the result lists of the expanded queries into one data source,
+// every data takes its best rank among the lists
+func MergeRankedLists(key string, lists ...[]msql.Params) []msql.Params {
+	bestRank := make(map[string]int)
+	order := make([]msql.Params, 0)
+	for _, list := range lists {
+		for j, one := range list {
+			if rank, ok := bestRank[one[key]]; !ok {
+				bestRank[one[key]] = j
+				order = append(order, one)
+			} else if j < rank {
+				bestRank[one[key]] = j
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return bestRank[order[i][key]] < bestRank[order[j][key]]
+	})
+	return order
+}
+
+// Sort the fused score is normalized into fused_score,
+// 1 means the data ranks first in every data source
 func (r *RRF) Sort() []msql.Params {
-	//sum score
+	//sum score,a data is only counted once by its best rank in each data source
 	rrfMap := make(map[string]float64)
+	var maxScore float64
 	for i := range r.dataSources {
+		maxScore += r.dataSources[i].Weight / float64(1+r.dataSources[i].Fixed)
+		seen := make(map[string]struct{})
 		for j := range r.dataSources[i].List {
-			score := 1 / float64(j+1+r.dataSources[i].Fixed)
-			rrfMap[r.dataSources[i].List[j][r.dataSources[i].Key]] += score
+			key := r.dataSources[i].List[j][r.dataSources[i].Key]
+			if _, ok := seen[key]; ok {
+				continue //duplication
+			}
+			score := r.dataSources[i].Weight / float64(len(seen)+1+r.dataSources[i].Fixed)
+			seen[key] = struct{}{}
+			rrfMap[key] += score
 		}
 	}
 	//sort by score
@@ -75,6 +108,7 @@ func (r *RRF) Sort() []msql.Params {
 	result := make([]msql.Params, 0)
 	for i := range itemList {
 		if one, ok := alllistMap[itemList[i].Key]; ok {
+			one[`fused_score`] = cast.ToString(itemList[i].Score / maxScore)
 			result = append(result, one)
 		}
 	}
@@ -0,0 +1,31 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"testing"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/msql"
+)
+
+func TestRRFSortFusedScoreRange(t *testing.T) {
+	//the lists of two expanded queries returning the same data
+	q1 := []msql.Params{{`id`: `1`}, {`id`: `2`}}
+	q2 := []msql.Params{{`id`: `1`}, {`id`: `3`}}
+	vectorList := MergeRankedLists(`id`, q1, q2)
+	if len(vectorList) != 3 || vectorList[0][`id`] != `1` {
+		t.Fatalf(`merged list:%v`, vectorList)
+	}
+	list := (&RRF{}).
+		Add(DataSource{List: vectorList, Key: `id`, Fixed: 60, Weight: 1}).
+		Add(DataSource{List: append(q1, q2...), Key: `id`, Fixed: 60, Weight: 1}).Sort()
+	for _, one := range list {
+		if score := cast.ToFloat64(one[`fused_score`]); score <= 0 || score > 1 {
+			t.Fatalf(`fused_score of %s out of range:%v`, one[`id`], score)
+		}
+	}
+	if list[0][`id`] != `1` || cast.ToFloat64(list[0][`fused_score`]) != 1 {
+		t.Fatalf(`the data ranking first in every source should score 1:%v`, list[0])
+	}
+}
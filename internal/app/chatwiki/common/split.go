@@ -23,13 +23,15 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/extrame/xls"
 	strip "github.com/grokify/html-strip-tags-go"
 	"github.com/xuri/excelize/v2"
 	"github.com/zhimaAi/go_tools/logs"
 	"github.com/zhimaAi/go_tools/tool"
 )
 
-func GetLibFileSplit(userId, fileId int, splitParams define.SplitParams, lang string) (list []define.DocSplitItem, wordTotal int, err error) {
+// GetLibFileSplit the paragraphs of the file split by the params,the tokenizer of the library counts their tokens
+func GetLibFileSplit(userId, fileId int, splitParams define.SplitParams, lang string) (list []define.DocSplitItem, wordTotal int, tokenizer *EmbeddingTokenizer, err error) {
 	info, err := GetLibFileInfo(fileId, userId)
 	if err != nil {
 		err = errors.New(i18n.Show(lang, `sys_err`))
@@ -39,12 +41,23 @@ func GetLibFileSplit(userId, fileId int, splitParams define.SplitParams, lang st
 		err = errors.New(i18n.Show(lang, `no_data`))
 		return
 	}
-	if !tool.InArrayInt(cast.ToInt(info[`status`]), []int{define.FileStatusWaitSplit, define.FileStatusLearned}) {
+	if !tool.InArrayInt(cast.ToInt(info[`status`]), []int{define.FileStatusWaitSplit, define.FileStatusLearned, define.FileStatusLearnedWithErrors}) {
 		err = errors.New(i18n.Show(lang, `status_exception`))
 		return
 	}
+	library, err := GetLibraryInfo(cast.ToInt(info[`library_id`]), userId)
+	if err != nil {
+		logs.Error(err.Error())
+		err = errors.New(i18n.Show(lang, `sys_err`))
+		return
+	}
+	tokenizer = GetEmbeddingTokenizer(library)
+	if len(splitParams.SeparatorRules) == 0 { //the default rules of the library
+		_ = tool.JsonDecode(library[`separator_rules`], &splitParams.SeparatorRules)
+	}
 	splitParams.IsTableFile = cast.ToInt(info[`is_table_file`])
-	splitParams, err = CheckSplitParams(splitParams, lang)
+	splitParams.FileExt = info[`file_ext`]
+	splitParams, err = CheckSplitParams(splitParams, tokenizer, lang)
 	if err != nil {
 		return
 	}
@@ -53,11 +66,21 @@ func GetLibFileSplit(userId, fileId int, splitParams define.SplitParams, lang st
 		list, wordTotal, err = ReadQaTab(info[`file_url`], info[`file_ext`], splitParams)
 	} else if cast.ToInt(info[`is_table_file`]) == define.FileIsTable && splitParams.IsQaDoc != define.DocTypeQa {
 		list, wordTotal, err = ReadTab(info[`file_url`], info[`file_ext`])
+	} else if define.IsNativeFile(info[`file_ext`]) {
+		list, wordTotal, err = ReadNativeFile(info[`file_url`], info[`file_ext`], splitParams)
+	} else if splitParams.SplitMode == define.SplitModeStructure {
+		htmlUrl := info[`html_url`]
+		if len(htmlUrl) == 0 { //compatible with old data
+			if htmlUrl, err = ConvertAndSaveHtml(cast.ToInt(info[`id`]), info[`file_url`], userId); err != nil {
+				return
+			}
+		}
+		list, wordTotal, err = ReadHtmlStructure(htmlUrl, userId, splitParams.TableFormat)
 	} else {
 		if len(info[`html_url`]) == 0 { //compatible with old data
-			list, wordTotal, err = ConvertAndReadHtmlContent(cast.ToInt(info[`id`]), info[`file_url`], userId)
+			list, wordTotal, err = ConvertAndReadHtmlContent(cast.ToInt(info[`id`]), info[`file_url`], userId, splitParams.TableFormat)
 		} else {
-			list, wordTotal, err = ReadHtmlContent(info[`html_url`], userId)
+			list, wordTotal, err = ReadHtmlContent(info[`html_url`], userId, splitParams.TableFormat)
 		}
 	}
 
@@ -74,21 +97,37 @@ func GetLibFileSplit(userId, fileId int, splitParams define.SplitParams, lang st
 	split.Separators = append(splitParams.Separators)
 	split.ChunkSize = splitParams.ChunkSize
 	split.ChunkOverlap = splitParams.ChunkOverlap
+	split.LenFunc = tokenizer.SplitLenFunc(splitParams)
 	// split by document type
 	if splitParams.IsQaDoc == define.DocTypeQa {
-		if cast.ToInt(info[`is_table_file`]) != define.FileIsTable {
+		if cast.ToInt(info[`is_table_file`]) != define.FileIsTable && !define.IsJsonFile(info[`file_ext`]) {
 			list = QaDocSplit(splitParams, list)
 		}
 	} else {
-		list = MultDocSplit(split, list)
+		list = MultDocSplit(split, splitParams.SeparatorRules, list)
+	}
+
+	//page numbers of the pdf and docx,the converted html has no page boundaries
+	if cast.ToInt(info[`is_table_file`]) != define.FileIsTable {
+		if pages, err := ReadFilePages(info[`file_url`], info[`file_ext`]); err != nil {
+			logs.Error(err.Error())
+		} else if len(pages) > 1 {
+			AssignPageNum(list, pages)
+		}
 	}
 
 	for i := range list {
 		list[i].Number = i + 1 //serial number
 		if splitParams.IsQaDoc == define.DocTypeQa {
 			list[i].WordTotal = utf8.RuneCountInString(list[i].Question) + utf8.RuneCountInString(list[i].Answer)
+			list[i].TokenTotal = tokenizer.Count(list[i].Question) + tokenizer.Count(list[i].Answer)
 		} else {
 			list[i].WordTotal = utf8.RuneCountInString(list[i].Content)
+			embedTitle := ``
+			if splitParams.SplitMode == define.SplitModeStructure {
+				embedTitle = list[i].Title
+			}
+			list[i].TokenTotal = tokenizer.Count(GetEmbedText(embedTitle, list[i].Content))
 		}
 	}
 
@@ -104,7 +143,7 @@ func SaveLibFileSplit(userId, fileId, wordTotal, qaIndexType int, splitParams de
 	if len(info) == 0 {
 		return errors.New(i18n.Show(lang, `no_data`))
 	}
-	if !tool.InArrayInt(cast.ToInt(info[`status`]), []int{define.FileStatusWaitSplit, define.FileStatusLearned}) {
+	if !tool.InArrayInt(cast.ToInt(info[`status`]), []int{define.FileStatusWaitSplit, define.FileStatusLearned, define.FileStatusLearnedWithErrors}) {
 		return errors.New(i18n.Show(lang, `status_exception`))
 	}
 
@@ -136,19 +175,65 @@ func SaveLibFileSplit(userId, fileId, wordTotal, qaIndexType int, splitParams de
 		}
 	}
 
-	// no update
-	if cast.ToInt(info[`status`]) == define.FileStatusLearned &&
+	library, err := GetLibraryInfo(cast.ToInt(info[`library_id`]), userId)
+	if err != nil {
+		logs.Error(err.Error())
+		return errors.New(i18n.Show(lang, `sys_err`))
+	}
+	enableParentChild, childChunkSize := 0, 0
+	if splitParams.IsQaDoc != define.DocTypeQa && IsParentChildLibrary(library) {
+		enableParentChild, childChunkSize = define.SwitchOn, cast.ToInt(library[`child_chunk_size`])
+	}
+	//the edited paragraphs are kept within the input of the embedding model
+	if splitParams.ChunkUnit == define.ChunkUnitToken && splitParams.IsQaDoc != define.DocTypeQa {
+		tokenizer := GetEmbeddingTokenizer(library)
+		for i := range list {
+			embedTitle := `` //only the structure mode embeds the title with the content
+			if splitParams.SplitMode == define.SplitModeStructure {
+				embedTitle = list[i].Title
+			}
+			if tokenizer.Count(GetEmbedText(embedTitle, list[i].Content)) > tokenizer.InputLimit() {
+				return errors.New(i18n.Show(lang, `chunk_token_err`, i+1, tokenizer.InputLimit()))
+			}
+		}
+	}
+	list, piiHits, err := RedactPii(library, splitParams.IsQaDoc, list)
+	if err != nil {
+		logs.Error(err.Error())
+		return errors.New(i18n.Show(lang, `sys_err`))
+	}
+
+	separatorRules := `[]`
+	if len(splitParams.SeparatorRules) > 0 {
+		if separatorRules, err = tool.JsonEncode(splitParams.SeparatorRules); err != nil {
+			logs.Error(err.Error())
+			return errors.New(i18n.Show(lang, `sys_err`))
+		}
+	}
+
+	// no update:the masked paragraphs keep the word total,so they are saved when redacted now or before
+	if cast.ToInt(info[`status`]) == define.FileStatusLearned && len(piiHits) == 0 && cast.ToInt(info[`pii_total`]) == 0 &&
 		cast.ToInt(info[`word_total`]) == wordTotal &&
 		cast.ToBool(info[`enable_extract_image`]) == splitParams.EnableExtractImage &&
 		cast.ToInt(info[`is_qa_doc`]) == splitParams.IsQaDoc &&
 		cast.ToInt(info[`is_diy_split`]) == splitParams.IsDiySplit &&
 		info[`separators_no`] == splitParams.SeparatorsNo &&
+		info[`separator_rules`] == separatorRules &&
 		cast.ToInt(info[`chunk_size`]) == splitParams.ChunkSize &&
 		cast.ToInt(info[`chunk_overlap`]) == splitParams.ChunkOverlap &&
+		cast.ToInt(info[`split_mode`]) == splitParams.SplitMode &&
+		cast.ToInt(info[`chunk_unit`]) == splitParams.ChunkUnit &&
+		cast.ToInt(info[`table_format`]) == splitParams.TableFormat &&
 		info[`questionLable`] == splitParams.QuestionLable &&
 		info[`answer_lable`] == splitParams.AnswerLable &&
 		info[`question_column`] == splitParams.QuestionColumn &&
-		info[`answer_column`] == splitParams.AnswerColumn {
+		info[`answer_column`] == splitParams.AnswerColumn &&
+		info[`json_record_path`] == splitParams.JsonRecordPath &&
+		info[`json_content_field`] == splitParams.JsonContentField &&
+		info[`json_question_field`] == splitParams.JsonQuestionField &&
+		info[`json_answer_field`] == splitParams.JsonAnswerField &&
+		cast.ToInt(info[`enable_parent_child`]) == enableParentChild &&
+		cast.ToInt(info[`child_chunk_size`]) == childChunkSize {
 		return nil
 	}
 
@@ -180,13 +265,24 @@ func SaveLibFileSplit(userId, fileId, wordTotal, qaIndexType int, splitParams de
 		`is_qa_doc`:            splitParams.IsQaDoc,
 		`is_diy_split`:         splitParams.IsDiySplit,
 		`separators_no`:        splitParams.SeparatorsNo,
+		`separator_rules`:      separatorRules,
 		`chunk_size`:           splitParams.ChunkSize,
 		`chunk_overlap`:        splitParams.ChunkOverlap,
+		`split_mode`:           splitParams.SplitMode,
+		`chunk_unit`:           splitParams.ChunkUnit,
+		`table_format`:         splitParams.TableFormat,
 		`question_lable`:       splitParams.QuestionLable,
 		`answer_lable`:         splitParams.AnswerLable,
 		`question_column`:      splitParams.QuestionColumn,
 		`answer_column`:        splitParams.AnswerColumn,
+		`json_record_path`:     splitParams.JsonRecordPath,
+		`json_content_field`:   splitParams.JsonContentField,
+		`json_question_field`:  splitParams.JsonQuestionField,
+		`json_answer_field`:    splitParams.JsonAnswerField,
 		`enable_extract_image`: splitParams.EnableExtractImage,
+		`enable_parent_child`:  enableParentChild,
+		`child_chunk_size`:     childChunkSize,
+		`pii_total`:            len(piiHits),
 		`update_time`:          tool.Time2Int(),
 	}
 	if qaIndexType != 0 {
@@ -201,20 +297,22 @@ func SaveLibFileSplit(userId, fileId, wordTotal, qaIndexType int, splitParams de
 	//clear cached data
 	lib_redis.DelCacheData(define.Redis, &LibFileCacheBuildHandler{FileId: fileId})
 
-	//database dispose
-	vm := msql.Model("chat_ai_library_file_data", define.Postgres)
-	_, err = vm.Where(`admin_user_id`, cast.ToString(userId)).Where(`file_id`, cast.ToString(fileId)).Delete()
+	//incremental:the paragraphs are matched by the content hash,the unchanged ones keep their ids and vectors
+	vm := msql.Model(`chat_ai_library_file_data`, define.Postgres)
+	olds, err := vm.Where(`admin_user_id`, cast.ToString(userId)).Where(`file_id`, cast.ToString(fileId)).
+		Field(`id,type,number,page_num,title,content,question,answer,word_total,images`).Order(`number,id`).Select()
 	if err != nil {
 		logs.Error(err.Error())
 		return errors.New(i18n.Show(lang, `sys_err`))
 	}
-	_, err = msql.Model(`chat_ai_library_file_data_index`, define.Postgres).Where(`admin_user_id`, cast.ToString(userId)).Where(`file_id`, cast.ToString(fileId)).Delete()
-	if err != nil {
-		logs.Error(err.Error())
-		return errors.New(i18n.Show(lang, `sys_err`))
+	oldPool := make(map[string][]msql.Params)
+	for _, old := range olds {
+		hash := GetParagraphHash(cast.ToInt(old[`type`]), old[`content`], old[`question`], old[`answer`])
+		oldPool[hash] = append(oldPool[hash], old)
 	}
 
-	var indexIds []int64
+	var indexIds, dataIds, normalIds []int64
+	change := msql.Datas{`unchanged_total`: 0, `moved_total`: 0, `added_total`: 0, `deleted_total`: 0}
 	for i, item := range list {
 		if utf8.RuneCountInString(item.Content) > MaxContent || utf8.RuneCountInString(item.Question) > MaxContent || utf8.RuneCountInString(item.Answer) > MaxContent {
 			return errors.New(i18n.Show(lang, `length_err`, i+1))
@@ -228,7 +326,6 @@ func SaveLibFileSplit(userId, fileId, wordTotal, qaIndexType int, splitParams de
 			`page_num`:      item.PageNum,
 			`title`:         item.Title,
 			`word_total`:    item.WordTotal,
-			`create_time`:   tool.Time2Int(),
 			`update_time`:   tool.Time2Int(),
 		}
 		if splitParams.IsQaDoc == define.DocTypeQa {
@@ -239,21 +336,52 @@ func SaveLibFileSplit(userId, fileId, wordTotal, qaIndexType int, splitParams de
 			}
 			data[`question`] = strings.TrimSpace(item.Question)
 			data[`answer`] = strings.TrimSpace(item.Answer)
-			if len(item.Images) > 0 {
-				jsonImages, err := CheckLibraryImage(item.Images)
-				if err != nil {
-					_ = m.Rollback()
-					return errors.New(i18n.Show(lang, `param_invalid`, `images`))
-				}
-				data[`images`] = jsonImages
+		} else {
+			data[`type`] = define.ParagraphTypeNormal
+			data[`content`] = strings.TrimSpace(item.Content)
+		}
+		if len(item.Images) > 0 {
+			jsonImages, err := CheckLibraryImage(item.Images)
+			if err != nil {
+				return errors.New(i18n.Show(lang, `param_invalid`, `images`))
+			}
+			data[`images`] = jsonImages
+		} else {
+			data[`images`] = `[]`
+		}
+
+		var id int64
+		hash := GetParagraphHash(cast.ToInt(data[`type`]), cast.ToString(data[`content`]), cast.ToString(data[`question`]), cast.ToString(data[`answer`]))
+		if matches := oldPool[hash]; len(matches) > 0 {
+			old := matches[0]
+			oldPool[hash] = matches[1:]
+			id = cast.ToInt64(old[`id`])
+			if cast.ToInt(old[`number`]) == item.Number && cast.ToInt(old[`page_num`]) == item.PageNum &&
+				old[`title`] == item.Title && cast.ToInt(old[`word_total`]) == item.WordTotal && old[`images`] == data[`images`] {
+				change[`unchanged_total`] = cast.ToInt(change[`unchanged_total`]) + 1
 			} else {
-				data[`images`] = `[]`
+				if _, err = vm.Where(`id`, cast.ToString(id)).Update(data); err != nil {
+					logs.Error(err.Error())
+					return errors.New(i18n.Show(lang, `sys_err`))
+				}
+				change[`moved_total`] = cast.ToInt(change[`moved_total`]) + 1
 			}
-			id, err := vm.Insert(data, `id`)
-			if err != nil {
+		} else {
+			data[`create_time`] = tool.Time2Int()
+			if id, err = vm.Insert(data, `id`); err != nil {
 				logs.Error(err.Error())
 				return errors.New(i18n.Show(lang, `sys_err`))
 			}
+			change[`added_total`] = cast.ToInt(change[`added_total`]) + 1
+			dataIds = append(dataIds, id)
+			if splitParams.IsQaDoc != define.DocTypeQa {
+				normalIds = append(normalIds, id)
+			}
+		}
+
+		//the vectors whose content is not changed are not converted again
+		var vectorIds []int64
+		if splitParams.IsQaDoc == define.DocTypeQa {
 			vectorID, err := SaveVector(
 				cast.ToInt64(info[`admin_user_id`]),
 				cast.ToInt64(info[`library_id`]),
@@ -266,7 +394,7 @@ func SaveLibFileSplit(userId, fileId, wordTotal, qaIndexType int, splitParams de
 				logs.Error(err.Error())
 				return errors.New(i18n.Show(lang, `sys_err`))
 			}
-			indexIds = append(indexIds, vectorID)
+			vectorIds = append(vectorIds, vectorID)
 			if qaIndexType == define.QAIndexTypeQuestionAndAnswer {
 				vectorID, err = SaveVector(
 					cast.ToInt64(info[`admin_user_id`]),
@@ -280,38 +408,71 @@ func SaveLibFileSplit(userId, fileId, wordTotal, qaIndexType int, splitParams de
 					logs.Error(err.Error())
 					return errors.New(i18n.Show(lang, `sys_err`))
 				}
-				indexIds = append(indexIds, vectorID)
-			}
-		} else {
-			data[`type`] = define.ParagraphTypeNormal
-			data[`content`] = strings.TrimSpace(item.Content)
-			if len(item.Images) > 0 {
-				jsonImages, err := CheckLibraryImage(item.Images)
+				vectorIds = append(vectorIds, vectorID)
+			} else {
+				_, err = msql.Model(`chat_ai_library_file_data_index`, define.Postgres).Where(`data_id`, cast.ToString(id)).
+					Where(`type`, cast.ToString(define.VectorTypeAnswer)).Delete()
 				if err != nil {
-					return errors.New(i18n.Show(lang, `param_invalid`, `images`))
+					logs.Error(err.Error())
+					return errors.New(i18n.Show(lang, `sys_err`))
 				}
-				data[`images`] = jsonImages
-			} else {
-				data[`images`] = `[]`
 			}
-			id, err := vm.Insert(data, `id`)
-			if err != nil {
-				logs.Error(err.Error())
-				return errors.New(i18n.Show(lang, `sys_err`))
+		} else {
+			embedTitle := ``
+			if splitParams.SplitMode == define.SplitModeStructure {
+				embedTitle = item.Title
 			}
-			vectorID, err := SaveVector(
+			//parent child mode:the paragraph is the parent section,the child chunks are vectorized
+			vectorIds, err = SaveParagraphVector(
+				library,
 				cast.ToInt64(info[`admin_user_id`]),
 				cast.ToInt64(info[`library_id`]),
 				cast.ToInt64(fileId),
 				id,
-				cast.ToString(define.VectorTypeParagraph),
+				embedTitle,
 				strings.TrimSpace(item.Content),
 			)
 			if err != nil {
 				logs.Error(err.Error())
 				return errors.New(i18n.Show(lang, `sys_err`))
 			}
-			indexIds = append(indexIds, vectorID)
+		}
+		for _, vectorID := range vectorIds {
+			if vectorID > 0 {
+				indexIds = append(indexIds, vectorID)
+			}
+		}
+	}
+
+	//the paragraphs not in the new split
+	deleteIds := make([]string, 0)
+	for _, matches := range oldPool {
+		for _, old := range matches {
+			deleteIds = append(deleteIds, old[`id`])
+		}
+	}
+	if len(deleteIds) > 0 {
+		_, err = vm.Where(`id`, `in`, strings.Join(deleteIds, `,`)).Delete()
+		if err != nil {
+			logs.Error(err.Error())
+			return errors.New(i18n.Show(lang, `sys_err`))
+		}
+		_, err = msql.Model(`chat_ai_library_file_data_index`, define.Postgres).Where(`data_id`, `in`, strings.Join(deleteIds, `,`)).Delete()
+		if err != nil {
+			logs.Error(err.Error())
+			return errors.New(i18n.Show(lang, `sys_err`))
+		}
+		if err = DeleteParagraphGraph(`data_id`, strings.Join(deleteIds, `,`)); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	change[`deleted_total`] = len(deleteIds)
+
+	if len(indexIds) == 0 { //nothing to convert
+		_, err = m.Where(`id`, cast.ToString(fileId)).Update(msql.Datas{`status`: define.FileStatusLearned, `update_time`: tool.Time2Int()})
+		if err != nil {
+			logs.Error(err.Error())
+			return errors.New(i18n.Show(lang, `sys_err`))
 		}
 	}
 	err = m.Commit()
@@ -319,6 +480,21 @@ func SaveLibFileSplit(userId, fileId, wordTotal, qaIndexType int, splitParams de
 		logs.Error(err.Error())
 		return errors.New(i18n.Show(lang, `sys_err`))
 	}
+	//clear cached data
+	lib_redis.DelCacheData(define.Redis, &LibFileCacheBuildHandler{FileId: fileId})
+	SetIngestEmbed(fileId, len(list), len(indexIds))
+	SaveLibFileVersion(fileId, qaIndexType, splitParams)
+	SavePiiReport(info, library, piiHits)
+
+	//the change summary of this learning
+	change[`admin_user_id`] = info[`admin_user_id`]
+	change[`library_id`] = info[`library_id`]
+	change[`file_id`] = fileId
+	change[`embed_total`] = len(indexIds)
+	change[`create_time`] = tool.Time2Int()
+	if _, err = msql.Model(`chat_ai_library_file_change`, define.Postgres).Insert(change); err != nil {
+		logs.Error(err.Error())
+	}
 
 	//async task:convert vector
 	for _, id := range indexIds {
@@ -328,14 +504,95 @@ func SaveLibFileSplit(userId, fileId, wordTotal, qaIndexType int, splitParams de
 			logs.Error(err.Error())
 		}
 	}
+	//async task:synthetic question
+	AddSyntheticQuestionJobs(library, normalIds, false)
+	//async task:graph extract
+	AddGraphExtractJobs(library, dataIds, false)
 
 	return nil
 }
 
-func MultDocSplit(split textsplitter.TextSplitter, items []define.DocSplitItem) []define.DocSplitItem {
+// GetSavedSplitParams the split params saved on the file by the upload or the last learning,
+// ok is false when the file has no saved params
+func GetSavedSplitParams(info msql.Params) (splitParams define.SplitParams, qaIndexType int, ok bool) {
+	if cast.ToInt(info[`chunk_size`]) <= 0 {
+		return
+	}
+	splitParams = define.SplitParams{
+		IsDiySplit:         cast.ToInt(info[`is_diy_split`]),
+		SeparatorsNo:       info[`separators_no`],
+		ChunkSize:          cast.ToInt(info[`chunk_size`]),
+		ChunkOverlap:       cast.ToInt(info[`chunk_overlap`]),
+		IsQaDoc:            cast.ToInt(info[`is_qa_doc`]),
+		QuestionLable:      info[`question_lable`],
+		AnswerLable:        info[`answer_lable`],
+		QuestionColumn:     info[`question_column`],
+		AnswerColumn:       info[`answer_column`],
+		EnableExtractImage: cast.ToBool(info[`enable_extract_image`]),
+		SplitMode:          cast.ToInt(info[`split_mode`]),
+		ChunkUnit:          cast.ToInt(info[`chunk_unit`]),
+		TableFormat:        cast.ToInt(info[`table_format`]),
+		JsonRecordPath:     info[`json_record_path`],
+		JsonContentField:   info[`json_content_field`],
+		JsonQuestionField:  info[`json_question_field`],
+		JsonAnswerField:    info[`json_answer_field`],
+	}
+	_ = tool.JsonDecode(info[`separator_rules`], &splitParams.SeparatorRules)
+	return splitParams, cast.ToInt(info[`qa_index_type`]), true
+}
+
+// GetParagraphHash the paragraphs of a file are matched by it when the file is learned again
+func GetParagraphHash(paragraphType int, content, question, answer string) string {
+	return tool.MD5(strings.Join([]string{cast.ToString(paragraphType), content, question, answer}, "\x00"))
+}
+
+// SeparatorRuleSplit the matches of the custom separators are the hard boundaries of the paragraphs,
+// the pieces longer than the chunk size are split again by the separators of separators_no
+func SeparatorRuleSplit(rules []define.SeparatorRule, text string) []string {
+	pieces := []string{text}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			logs.Error(err.Error())
+			continue
+		}
+		list := make([]string, 0, len(pieces))
+		for _, piece := range pieces {
+			start := 0
+			for _, loc := range re.FindAllStringIndex(piece, -1) {
+				if content := strings.TrimSpace(piece[start:loc[0]]); len(content) > 0 {
+					list = append(list, content)
+				}
+				if rule.KeepDelimiter {
+					start = loc[0]
+				} else {
+					start = loc[1]
+				}
+			}
+			if content := strings.TrimSpace(piece[start:]); len(content) > 0 {
+				list = append(list, content)
+			}
+		}
+		pieces = list
+	}
+	return pieces
+}
+
+// MultDocSplit the tables are split by rows,the custom separators only apply to the text outside the tables
+func MultDocSplit(split textsplitter.RecursiveCharacter, rules []define.SeparatorRule, items []define.DocSplitItem) []define.DocSplitItem {
 	list := make([]define.DocSplitItem, 0)
 	for _, item := range items {
-		contents, _ := split.SplitText(item.Content)
+		contents := make([]string, 0)
+		for _, segment := range splitDocSegments(item.Content) {
+			if segment.isTable {
+				contents = append(contents, SplitTableRows(split, segment)...)
+				continue
+			}
+			for _, piece := range SeparatorRuleSplit(rules, segment.text) {
+				texts, _ := split.SplitText(piece)
+				contents = append(contents, texts...)
+			}
+		}
 		for _, content := range contents {
 			if len(content) == 0 {
 				continue
@@ -344,17 +601,25 @@ func MultDocSplit(split textsplitter.TextSplitter, items []define.DocSplitItem)
 			if len(content) == 0 {
 				continue
 			}
-			list = append(list, define.DocSplitItem{PageNum: item.PageNum, Content: content, Images: images})
+			list = append(list, define.DocSplitItem{PageNum: item.PageNum, Title: item.Title, Content: content, Images: images})
 		}
 	}
 	return list
 }
 
-func ConvertAndReadHtmlContent(fileId int, fileUrl string, userId int) ([]define.DocSplitItem, int, error) {
-	htmlUrl, err := ConvertHtml(fileUrl, userId)
+func ConvertAndReadHtmlContent(fileId int, fileUrl string, userId, tableFormat int) ([]define.DocSplitItem, int, error) {
+	htmlUrl, err := ConvertAndSaveHtml(fileId, fileUrl, userId)
 	if err != nil {
 		return nil, 0, err
 	}
+	return ReadHtmlContent(htmlUrl, userId, tableFormat)
+}
+
+func ConvertAndSaveHtml(fileId int, fileUrl string, userId int) (string, error) {
+	htmlUrl, err := ConvertHtml(fileUrl, userId)
+	if err != nil {
+		return ``, err
+	}
 
 	_, err = msql.Model(`chat_ai_library_file`, define.Postgres).Where(`id`, cast.ToString(fileId)).Update(msql.Datas{
 		`html_url`:    htmlUrl,
@@ -362,10 +627,9 @@ func ConvertAndReadHtmlContent(fileId int, fileUrl string, userId int) ([]define
 		`update_time`: tool.Time2Int(),
 	})
 	if err != nil {
-		return nil, 0, err
+		return ``, err
 	}
-
-	return ReadHtmlContent(htmlUrl, userId)
+	return htmlUrl, nil
 }
 
 func ConvertHtml(link string, userId int) (string, error) {
@@ -394,16 +658,40 @@ func ConvertHtml(link string, userId int) (string, error) {
 	return url, nil
 }
 
-func ReadHtmlContent(htmlUrl string, userId int) ([]define.DocSplitItem, int, error) {
+func ReadHtmlContent(htmlUrl string, userId, tableFormat int) ([]define.DocSplitItem, int, error) {
 	content, err := tool.ReadFile(GetFileByLink(htmlUrl))
 	if err != nil {
 		return nil, 0, err
 	}
 
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	doc, err := ParseHtmlDocument(content, userId)
 	if err != nil {
 		return nil, 0, err
 	}
+	for _, node := range doc.Nodes {
+		ReplaceHtmlTables(node, tableFormat)
+	}
+
+	content, err = doc.Html()
+	if err != nil {
+		logs.Error(err.Error())
+		return nil, 0, err
+	}
+
+	if !utf8.ValidString(content) {
+		content = tool.Convert(content, `gbk`, `utf-8`)
+	}
+	content = strip.StripTags(content)
+	list := []define.DocSplitItem{{Content: content}}
+	return list, utf8.RuneCountInString(content), nil
+}
+
+// ParseHtmlDocument the base64 images are saved as files and replaced by the image placeholders
+func ParseHtmlDocument(content string, userId int) (*goquery.Document, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
 
 	doc.Find("img").Each(func(index int, item *goquery.Selection) {
 		src, exists := item.Attr("src")
@@ -434,19 +722,7 @@ func ReadHtmlContent(htmlUrl string, userId int) ([]define.DocSplitItem, int, er
 			item.ReplaceWithHtml(newTag)
 		}
 	})
-
-	content, err = doc.Html()
-	if err != nil {
-		logs.Error(err.Error())
-		return nil, 0, err
-	}
-
-	if !utf8.ValidString(content) {
-		content = tool.Convert(content, `gbk`, `utf-8`)
-	}
-	content = strip.StripTags(content)
-	list := []define.DocSplitItem{{Content: content}}
-	return list, utf8.RuneCountInString(content), nil
+	return doc, nil
 }
 
 func ParseTabFile(fileUrl, fileExt string) ([][]string, error) {
@@ -466,6 +742,8 @@ func ParseTabFile(fileUrl, fileExt string) ([][]string, error) {
 		for _, val := range strings.Fields(content) {
 			rows = append(rows, strings.Split(val, `,`))
 		}
+	} else if fileExt == `xls` {
+		return readXlsRows(GetFileByLink(fileUrl))
 	} else {
 		f, err := excelize.OpenFile(GetFileByLink(fileUrl))
 		if err != nil {
@@ -510,6 +788,70 @@ func ReadTab(fileUrl, fileExt string) ([]define.DocSplitItem, int, error) {
 	return list, wordTotal, nil
 }
 
+// readXlsRows the first sheet of the excel 97-2003 workbook
+func readXlsRows(filePath string) (rows [][]string, err error) {
+	defer func() {
+		if r := recover(); r != nil { //the xls parser panics on some malformed files
+			rows, err = nil, fmt.Errorf(`read xls panic:%v`, r)
+		}
+	}()
+	workbook, err := xls.Open(filePath, `utf-8`)
+	if err != nil {
+		return nil, err
+	}
+	sheet := workbook.GetSheet(0)
+	if sheet == nil {
+		return nil, errors.New(`xls has no sheet`)
+	}
+	rows = make([][]string, 0, int(sheet.MaxRow)+1)
+	for i := 0; i <= int(sheet.MaxRow); i++ {
+		rows = append(rows, readXlsRow(sheet, i))
+	}
+	return rows, nil
+}
+
+func readXlsRow(sheet *xls.WorkSheet, i int) (cells []string) {
+	defer func() {
+		if r := recover(); r != nil { //the blank rows are not stored in the sheet
+			cells = nil
+		}
+	}()
+	row := sheet.Row(i)
+	cells = make([]string, 0, row.LastCol())
+	for j := 0; j < row.LastCol(); j++ {
+		cells = append(cells, strings.TrimSpace(row.Col(j)))
+	}
+	return cells
+}
+
+// ReadNativeFile the pptx,epub,eml,mbox and json files are read by the native extractors
+func ReadNativeFile(fileUrl, fileExt string, splitParams define.SplitParams) ([]define.DocSplitItem, int, error) {
+	var list []define.DocSplitItem
+	var err error
+	switch strings.ToLower(fileExt) {
+	case `pptx`:
+		list, err = ReadPptx(GetFileByLink(fileUrl))
+	case `epub`:
+		list, err = ReadEpub(GetFileByLink(fileUrl), splitParams.TableFormat)
+	case `eml`:
+		list, err = ReadEml(GetFileByLink(fileUrl))
+	case `mbox`:
+		list, err = ReadMbox(GetFileByLink(fileUrl))
+	case `json`, `jsonl`:
+		list, err = ReadJson(GetFileByLink(fileUrl), fileExt, splitParams)
+	default:
+		err = errors.New(`unsupported file ext:` + fileExt)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	wordTotal := 0
+	for _, item := range list {
+		wordTotal += utf8.RuneCountInString(item.Content + item.Question + item.Answer)
+	}
+	return list, wordTotal, nil
+}
+
 func ColumnIndexFromIdentifier(identifier string) (int, error) {
 	if identifier == "" {
 		return -1, errors.New("identifier cannot be empty")
@@ -588,7 +930,7 @@ func ReadQaTab(fileUrl, fileExt string, splitParams define.SplitParams) ([]defin
 func QaDocSplit(splitParams define.SplitParams, items []define.DocSplitItem) []define.DocSplitItem {
 	list := make([]define.DocSplitItem, 0)
 	for i, item := range items {
-		for _, section := range strings.Split(item.Content, splitParams.QuestionLable) {
+		for _, section := range strings.Split(StripTableMarks(item.Content), splitParams.QuestionLable) {
 			if len(strings.TrimSpace(section)) == 0 {
 				continue
 			}
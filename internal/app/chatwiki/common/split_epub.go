@@ -0,0 +1,208 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"archive/zip"
+	"bytes"
+	"chatwiki/internal/app/chatwiki/define"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+type epubPackage struct {
+	Manifest []struct {
+		Id         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		ItemRefs []struct {
+			IdRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+// resolveEpubHref the hrefs are url encoded and relative to the file that refers to them
+func resolveEpubHref(baseDir, href string) string {
+	href, _, _ = strings.Cut(href, `#`)
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return path.Join(baseDir, href)
+}
+
+// getEpubNavTitles the chapter titles of the epub3 navigation document
+func getEpubNavTitles(content []byte, baseDir string, titles map[string]string) error {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.DataAtom == atom.A {
+			for _, attr := range node.Attr {
+				if attr.Key != `href` {
+					continue
+				}
+				file := resolveEpubHref(baseDir, attr.Val)
+				if _, ok := titles[file]; !ok {
+					titles[file] = collapseHtmlSpace(htmlNodeText(node))
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return nil
+}
+
+// getEpubNcxTitles the chapter titles of the epub2 ncx,the label of a nav point precedes its content
+func getEpubNcxTitles(content []byte, baseDir string, titles map[string]string) error {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	label, inText := strings.Builder{}, false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case `navLabel`:
+				label.Reset()
+			case `text`:
+				inText = true
+			case `content`:
+				for _, attr := range element.Attr {
+					if attr.Name.Local != `src` {
+						continue
+					}
+					file := resolveEpubHref(baseDir, attr.Value)
+					if _, ok := titles[file]; !ok {
+						titles[file] = collapseHtmlSpace(label.String())
+					}
+				}
+			}
+		case xml.EndElement:
+			if element.Name.Local == `text` {
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				label.Write(element)
+			}
+		}
+	}
+	return nil
+}
+
+// readEpubChapter the sections of a chapter,the chapter title leads the breadcrumb of the headings
+func readEpubChapter(content []byte, chapterTitle string, tableFormat int) ([]define.DocSplitItem, error) {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	walker := &htmlSectionWalker{tableFormat: tableFormat}
+	walker.walkChildren(doc)
+	walker.flush()
+	for i := range walker.items {
+		title := walker.items[i].Title
+		switch {
+		case len(chapterTitle) == 0 || strings.HasPrefix(title, chapterTitle):
+		case len(title) == 0:
+			title = chapterTitle
+		default:
+			title = chapterTitle + ` > ` + title
+		}
+		walker.items[i].Title = MbSubstr(title, 0, define.ParagraphTitleMaxLen)
+	}
+	return walker.items, nil
+}
+
+// ReadEpub the chapters in the reading order of the spine,titled by the table of contents
+func ReadEpub(filePath string, tableFormat int) ([]define.DocSplitItem, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	content, err := readZipEntry(&reader.Reader, `META-INF/container.xml`)
+	if err != nil {
+		return nil, err
+	}
+	container := struct {
+		RootFiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}{}
+	if err = xml.Unmarshal(content, &container); err != nil {
+		return nil, err
+	}
+	if len(container.RootFiles) == 0 {
+		return nil, errors.New(`epub has no rootfile`)
+	}
+	opfPath := container.RootFiles[0].FullPath
+	if content, err = readZipEntry(&reader.Reader, opfPath); err != nil {
+		return nil, err
+	}
+	pkg := epubPackage{}
+	if err = xml.Unmarshal(content, &pkg); err != nil {
+		return nil, err
+	}
+
+	opfDir, files, titles := path.Dir(opfPath), make(map[string]string), make(map[string]string)
+	for _, item := range pkg.Manifest {
+		file := resolveEpubHref(opfDir, item.Href)
+		files[item.Id] = file
+		if !strings.Contains(item.Properties, `nav`) && item.Id != pkg.Spine.Toc {
+			continue
+		}
+		toc, err := readZipEntry(&reader.Reader, file)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(item.Properties, `nav`) {
+			err = getEpubNavTitles(toc, path.Dir(file), titles)
+		} else {
+			err = getEpubNcxTitles(toc, path.Dir(file), titles)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list := make([]define.DocSplitItem, 0)
+	for _, itemRef := range pkg.Spine.ItemRefs {
+		file, ok := files[itemRef.IdRef]
+		if !ok {
+			continue
+		}
+		chapter, err := readZipEntry(&reader.Reader, file)
+		if err != nil {
+			return nil, err
+		}
+		items, err := readEpubChapter(chapter, titles[file], tableFormat)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, items...)
+	}
+	return list, nil
+}
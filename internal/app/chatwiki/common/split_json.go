@@ -0,0 +1,167 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"chatwiki/internal/app/chatwiki/define"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// lookupJsonPath the path is separated by dots,the array elements are taken by index, e.g. data.items.0.title
+func lookupJsonPath(node any, path string) (any, bool) {
+	if len(path) == 0 {
+		return node, true
+	}
+	for _, key := range strings.Split(path, `.`) {
+		switch value := node.(type) {
+		case map[string]any:
+			var ok bool
+			if node, ok = value[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			node = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// formatJsonValue the objects are flattened as key:value pairs like the rows of the table files
+func formatJsonValue(node any, prefix string) []string {
+	switch value := node.(type) {
+	case nil:
+		return nil
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if len(prefix) > 0 {
+				pairs = append(pairs, formatJsonValue(value[key], prefix+`.`+key)...)
+			} else {
+				pairs = append(pairs, formatJsonValue(value[key], key)...)
+			}
+		}
+		return pairs
+	case []any:
+		pairs := make([]string, 0, len(value))
+		for i, item := range value {
+			if len(prefix) > 0 {
+				pairs = append(pairs, formatJsonValue(item, prefix+`.`+cast.ToString(i))...)
+			} else {
+				pairs = append(pairs, formatJsonValue(item, cast.ToString(i))...)
+			}
+		}
+		return pairs
+	default:
+		text := strings.TrimSpace(cast.ToString(value))
+		if len(text) == 0 {
+			return nil
+		}
+		if len(prefix) > 0 {
+			return []string{prefix + `:` + text}
+		}
+		return []string{text}
+	}
+}
+
+func getJsonFieldText(record any, field string) string {
+	node, ok := lookupJsonPath(record, field)
+	if !ok {
+		return ``
+	}
+	if text, ok := node.(string); ok {
+		return strings.TrimSpace(text)
+	}
+	if _, ok := node.(map[string]any); ok {
+		return strings.Join(formatJsonValue(node, ``), `;`)
+	}
+	return strings.Join(formatJsonValue(node, ``), "\n")
+}
+
+func readJsonRecords(filePath, fileExt, recordPath string) ([]any, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	if strings.ToLower(fileExt) == `jsonl` {
+		records, scanner, number := make([]any, 0), bufio.NewScanner(bytes.NewReader(content)), 0
+		scanner.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+		for scanner.Scan() {
+			number++
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var record any
+			decoder := json.NewDecoder(bytes.NewReader(line))
+			decoder.UseNumber()
+			if err = decoder.Decode(&record); err != nil {
+				return nil, fmt.Errorf(`jsonl line %d:%s`, number, err.Error())
+			}
+			records = append(records, record)
+		}
+		return records, scanner.Err()
+	}
+	var root any
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err = decoder.Decode(&root); err != nil {
+		return nil, err
+	}
+	node, ok := lookupJsonPath(root, recordPath)
+	if !ok {
+		return nil, errors.New(`json record path not found:` + recordPath)
+	}
+	if records, ok := node.([]any); ok {
+		return records, nil
+	}
+	return []any{node}, nil
+}
+
+// ReadJson an item per record of the json array or the jsonl lines,the record number is taken as the page.
+// The content is the whole record when the content field is empty
+func ReadJson(filePath, fileExt string, splitParams define.SplitParams) ([]define.DocSplitItem, error) {
+	records, err := readJsonRecords(filePath, fileExt, splitParams.JsonRecordPath)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]define.DocSplitItem, 0, len(records))
+	for i, record := range records {
+		if splitParams.IsQaDoc == define.DocTypeQa {
+			question := getJsonFieldText(record, splitParams.JsonQuestionField)
+			answer, images := ExtractTextImages(getJsonFieldText(record, splitParams.JsonAnswerField))
+			if len(question) == 0 || len(answer) == 0 {
+				continue
+			}
+			list = append(list, define.DocSplitItem{PageNum: i + 1, Question: question, Answer: answer, Images: images})
+			continue
+		}
+		content := getJsonFieldText(record, splitParams.JsonContentField)
+		if len(content) == 0 {
+			continue
+		}
+		list = append(list, define.DocSplitItem{PageNum: i + 1, Content: content})
+	}
+	return list, nil
+}
@@ -0,0 +1,240 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"chatwiki/internal/app/chatwiki/define"
+	"encoding/base64"
+	"fmt"
+	stdhtml "html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	strip "github.com/grokify/html-strip-tags-go"
+	"github.com/zhimaAi/go_tools/logs"
+	"golang.org/x/net/html/charset"
+)
+
+var mailHeaderDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+var mailHeaderKeys = []string{`From`, `To`, `Cc`, `Date`, `Subject`}
+
+func decodeMailHeader(value string) string {
+	if decoded, err := mailHeaderDecoder.DecodeHeader(value); err == nil {
+		value = decoded
+	}
+	return collapseHtmlSpace(value)
+}
+
+type mailText struct {
+	plain       []string
+	html        []string
+	attachments []string
+}
+
+// decodeMailPart decode the transfer encoding and the charset of a leaf part
+func decodeMailPart(header textproto.MIMEHeader, params map[string]string, body io.Reader) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(header.Get(`Content-Transfer-Encoding`))) {
+	case `base64`:
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case `quoted-printable`:
+		body = quotedprintable.NewReader(body)
+	}
+	if label := params[`charset`]; len(label) > 0 {
+		if reader, err := charset.NewReaderLabel(label, body); err == nil {
+			body = reader
+		}
+	}
+	content, err := io.ReadAll(body)
+	return string(content), err
+}
+
+// readMailAttachment the text of the attachments that can be read,only the name of the others
+func readMailAttachment(name string, content string) string {
+	text := ``
+	switch strings.ToLower(strings.TrimLeft(filepath.Ext(name), `.`)) {
+	case `txt`, `md`, `csv`, `json`, `jsonl`:
+		text = content
+	case `html`, `htm`:
+		text = stdhtml.UnescapeString(strip.StripTags(content))
+	case `eml`:
+		if _, body, err := readMailMessage(strings.NewReader(content)); err == nil {
+			text = body
+		}
+	case `pdf`, `docx`:
+		file, err := os.CreateTemp(``, `mail_attachment_*`+filepath.Ext(name))
+		if err != nil {
+			logs.Error(err.Error())
+			break
+		}
+		defer func() {
+			_ = os.Remove(file.Name())
+		}()
+		_, err = file.WriteString(content)
+		_ = file.Close()
+		if err != nil {
+			logs.Error(err.Error())
+			break
+		}
+		var pages []string
+		if strings.EqualFold(filepath.Ext(name), `.pdf`) {
+			pages, err = readPdfPages(file.Name())
+		} else {
+			pages, err = readDocxPages(file.Name())
+		}
+		if err != nil {
+			logs.Error(err.Error())
+		}
+		text = strings.Join(pages, "\n")
+	}
+	return fmt.Sprintf("Attachment: %s\n%s", name, strings.TrimSpace(text))
+}
+
+func walkMailPart(header textproto.MIMEHeader, body io.Reader, text *mailText) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get(`Content-Type`))
+	if err != nil {
+		mediaType, params = `text/plain`, map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, `multipart/`) {
+		reader := multipart.NewReader(body, params[`boundary`])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err = walkMailPart(part.Header, part, text); err != nil {
+				return err
+			}
+		}
+	}
+	content, err := decodeMailPart(header, params, body)
+	if err != nil {
+		return err
+	}
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get(`Content-Disposition`))
+	name := dispositionParams[`filename`]
+	if len(name) == 0 {
+		name = params[`name`]
+	}
+	switch {
+	case len(name) > 0 || disposition == `attachment`:
+		if len(name) == 0 {
+			name = `unnamed`
+		}
+		text.attachments = append(text.attachments, readMailAttachment(decodeMailHeader(name), content))
+	case mediaType == `text/plain`:
+		text.plain = append(text.plain, content)
+	case mediaType == `text/html`:
+		text.html = append(text.html, stdhtml.UnescapeString(strip.StripTags(content)))
+	case mediaType == `message/rfc822`:
+		if _, body, err := readMailMessage(strings.NewReader(content)); err == nil {
+			text.attachments = append(text.attachments, body)
+		}
+	}
+	return nil
+}
+
+// readMailMessage the headers,the body and the attachments,the plain body is preferred to the html one
+func readMailMessage(reader io.Reader) (string, string, error) {
+	message, err := mail.ReadMessage(reader)
+	if err != nil {
+		return ``, ``, err
+	}
+	lines := make([]string, 0)
+	for _, key := range mailHeaderKeys {
+		if value := decodeMailHeader(message.Header.Get(key)); len(value) > 0 {
+			lines = append(lines, key+`: `+value)
+		}
+	}
+	text := &mailText{}
+	if err = walkMailPart(textproto.MIMEHeader(message.Header), message.Body, text); err != nil {
+		return ``, ``, err
+	}
+	body := text.plain
+	if len(body) == 0 {
+		body = text.html
+	}
+	for _, part := range append(body, text.attachments...) {
+		if part = strings.TrimSpace(part); len(part) > 0 {
+			lines = append(lines, ``, part)
+		}
+	}
+	subject := MbSubstr(decodeMailHeader(message.Header.Get(`Subject`)), 0, define.ParagraphTitleMaxLen)
+	return subject, strings.Join(lines, "\n"), nil
+}
+
+func ReadEml(filePath string) ([]define.DocSplitItem, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	title, content, err := readMailMessage(file)
+	if err != nil {
+		return nil, err
+	}
+	return []define.DocSplitItem{{Title: title, Content: content}}, nil
+}
+
+// ReadMbox an item per message,the message number is taken as the page.
+// A message starts with a From line,the escaped >From lines of the body are restored
+func ReadMbox(filePath string) ([]define.DocSplitItem, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	list, message, number := make([]define.DocSplitItem, 0), bytes.Buffer{}, 0
+	addMessage := func() {
+		if message.Len() == 0 {
+			return
+		}
+		number++
+		title, content, err := readMailMessage(&message)
+		if err != nil {
+			logs.Error(fmt.Sprintf(`read mbox message %d:%s`, number, err.Error()))
+		} else {
+			list = append(list, define.DocSplitItem{PageNum: number, Title: title, Content: content})
+		}
+		message.Reset()
+	}
+	reader, blank := bufio.NewReader(file), true
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if blank && strings.HasPrefix(line, `From `) {
+				addMessage()
+			} else {
+				if unquoted := strings.TrimLeft(line, `>`); strings.HasPrefix(unquoted, `From `) && unquoted != line {
+					line = line[1:]
+				}
+				message.WriteString(line)
+			}
+			blank = len(strings.TrimSpace(line)) == 0
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	addMessage()
+	return list, nil
+}
@@ -0,0 +1,174 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"archive/zip"
+	"chatwiki/internal/app/chatwiki/define"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ReadFilePages the plain text of each page,only pdf and the docx with page breaks have pages
+func ReadFilePages(fileUrl, fileExt string) ([]string, error) {
+	switch strings.ToLower(fileExt) {
+	case `pdf`:
+		return readPdfPages(GetFileByLink(fileUrl))
+	case `docx`:
+		return readDocxPages(GetFileByLink(fileUrl))
+	}
+	return nil, nil
+}
+
+func readPdfPages(filePath string) (pages []string, err error) {
+	defer func() {
+		if r := recover(); r != nil { //the pdf parser panics on some malformed files
+			pages, err = nil, fmt.Errorf(`read pdf pages panic:%v`, r)
+		}
+	}()
+	file, reader, err := pdf.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	fonts := make(map[string]*pdf.Font)
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			pages = append(pages, ``)
+			continue
+		}
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				font := page.Font(name)
+				fonts[name] = &font
+			}
+		}
+		text, err := page.GetPlainText(fonts)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, text)
+	}
+	return pages, nil
+}
+
+// readDocxPages the explicit page breaks and the page breaks rendered by word when saving
+func readDocxPages(filePath string) ([]string, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	var document io.ReadCloser
+	for _, file := range reader.File {
+		if file.Name == `word/document.xml` {
+			if document, err = file.Open(); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if document == nil {
+		return nil, errors.New(`word/document.xml not found`)
+	}
+	defer func() {
+		_ = document.Close()
+	}()
+	pages, page := make([]string, 0), strings.Builder{}
+	newPage := func() {
+		if len(strings.TrimSpace(page.String())) > 0 {
+			pages = append(pages, page.String())
+			page.Reset()
+		}
+	}
+	decoder, inText := xml.NewDecoder(document), false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case `t`:
+				inText = true
+			case `tab`:
+				page.WriteString("\t")
+			case `lastRenderedPageBreak`:
+				newPage()
+			case `br`:
+				for _, attr := range element.Attr {
+					if attr.Name.Local == `type` && attr.Value == `page` {
+						newPage()
+					}
+				}
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case `t`:
+				inText = false
+			case `p`:
+				page.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				page.Write(element)
+			}
+		}
+	}
+	newPage()
+	return pages, nil
+}
+
+var pageImagePlaceholder = regexp.MustCompile(`\{\{!!.+?!!}}`)
+
+func normalizePageText(text string) string {
+	text = pageImagePlaceholder.ReplaceAllString(text, ``)
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, text)
+}
+
+// AssignPageNum locate each chunk in the page texts in document order and take the page it starts on.
+// A chunk that can not be located keeps the page of the previous chunk
+func AssignPageNum(list []define.DocSplitItem, pages []string) {
+	text, starts := strings.Builder{}, make([]int, 0, len(pages))
+	for _, page := range pages {
+		starts = append(starts, text.Len())
+		text.WriteString(normalizePageText(page))
+	}
+	fullText, cursor, pageNum := text.String(), 0, 1
+	for i := range list {
+		key := []rune(normalizePageText(list[i].Content + list[i].Question))
+		for _, length := range []int{32, 12} {
+			if len(key) < 4 {
+				break
+			}
+			if pos := strings.Index(fullText[cursor:], string(key[:min(length, len(key))])); pos >= 0 {
+				cursor += pos
+				pageNum = sort.Search(len(starts), func(j int) bool { return starts[j] > cursor })
+				break
+			}
+		}
+		list[i].PageNum = pageNum
+	}
+}
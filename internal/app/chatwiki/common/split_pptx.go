@@ -0,0 +1,188 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"archive/zip"
+	"bytes"
+	"chatwiki/internal/app/chatwiki/define"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+func readZipEntry(reader *zip.Reader, name string) ([]byte, error) {
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
+		}
+		entry, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = entry.Close()
+		}()
+		return io.ReadAll(entry)
+	}
+	return nil, errors.New(name + ` not found`)
+}
+
+// readZipRels the targets of the relationships by id,relative to the dir of the part
+func readZipRels(reader *zip.Reader, partName string) (map[string]string, error) {
+	dir, file := path.Split(partName)
+	content, err := readZipEntry(reader, dir+`_rels/`+file+`.rels`)
+	if err != nil {
+		return nil, err
+	}
+	rels := struct {
+		Items []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}{}
+	if err = xml.Unmarshal(content, &rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string, len(rels.Items))
+	for _, item := range rels.Items {
+		if strings.HasPrefix(item.Target, `/`) {
+			targets[item.Id] = strings.TrimPrefix(item.Target, `/`)
+		} else {
+			targets[item.Id] = path.Join(dir, item.Target)
+		}
+	}
+	return targets, nil
+}
+
+// getPptxSlides the slide parts in the order of the presentation
+func getPptxSlides(reader *zip.Reader) ([]string, error) {
+	content, err := readZipEntry(reader, `ppt/presentation.xml`)
+	if err != nil {
+		return nil, err
+	}
+	presentation := struct {
+		SlideIds []struct {
+			Attrs []xml.Attr `xml:",any,attr"`
+		} `xml:"sldIdLst>sldId"`
+	}{}
+	if err = xml.Unmarshal(content, &presentation); err != nil {
+		return nil, err
+	}
+	targets, err := readZipRels(reader, `ppt/presentation.xml`)
+	if err != nil {
+		return nil, err
+	}
+	slides := make([]string, 0, len(presentation.SlideIds))
+	for _, slideId := range presentation.SlideIds {
+		for _, attr := range slideId.Attrs {
+			if attr.Name.Local == `id` && len(attr.Name.Space) > 0 && len(targets[attr.Value]) > 0 {
+				slides = append(slides, targets[attr.Value])
+			}
+		}
+	}
+	return slides, nil
+}
+
+// readPptxSlide the text of the shapes in document order,the table cells are joined by rows
+func readPptxSlide(content []byte) (title string, lines []string, err error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	paragraph, cells := strings.Builder{}, make([]string, 0)
+	isTitle, inText, inCell := false, false, false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ``, nil, err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case `sp`:
+				isTitle = false
+			case `ph`:
+				for _, attr := range element.Attr {
+					if attr.Name.Local == `type` && (attr.Value == `title` || attr.Value == `ctrTitle`) {
+						isTitle = true
+					}
+				}
+			case `t`:
+				inText = true
+			case `br`:
+				paragraph.WriteString(` `)
+			case `tc`:
+				inCell = true
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case `t`:
+				inText = false
+			case `p`:
+				text := collapseHtmlSpace(paragraph.String())
+				paragraph.Reset()
+				if len(text) == 0 {
+					continue
+				}
+				if inCell {
+					cells = append(cells, text)
+					continue
+				}
+				if isTitle && len(title) == 0 {
+					title = text
+				}
+				lines = append(lines, text)
+			case `tc`:
+				inCell = false
+			case `tr`:
+				if len(cells) > 0 {
+					lines = append(lines, strings.Join(cells, ` | `))
+				}
+				cells = cells[:0]
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(element)
+			}
+		}
+	}
+	return title, lines, nil
+}
+
+// ReadPptx an item per slide,the slide number is taken as the page
+func ReadPptx(filePath string) ([]define.DocSplitItem, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	slides, err := getPptxSlides(&reader.Reader)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]define.DocSplitItem, 0, len(slides))
+	for i, slide := range slides {
+		content, err := readZipEntry(&reader.Reader, slide)
+		if err != nil {
+			return nil, err
+		}
+		title, lines, err := readPptxSlide(content)
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		list = append(list, define.DocSplitItem{
+			PageNum: i + 1,
+			Title:   MbSubstr(title, 0, define.ParagraphTitleMaxLen),
+			Content: strings.Join(lines, "\n"),
+		})
+	}
+	return list, nil
+}
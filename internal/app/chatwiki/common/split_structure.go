@@ -0,0 +1,176 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/tool"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var htmlHeadingLevels = map[atom.Atom]int{atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6}
+
+var htmlSkipTags = []atom.Atom{atom.Head, atom.Script, atom.Style, atom.Noscript, atom.Template}
+
+var htmlBlockTags = []atom.Atom{atom.Html, atom.Body, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header,
+	atom.Footer, atom.Nav, atom.Aside, atom.P, atom.Blockquote, atom.Figure, atom.Figcaption, atom.Center, atom.Form,
+	atom.Details, atom.Summary, atom.Dl, atom.Dt, atom.Dd, atom.Address, atom.Hr, atom.Caption}
+
+// htmlSectionWalker walk the html dom in document order,a heading closes the current section
+type htmlSectionWalker struct {
+	tableFormat int
+	headings    [6]string
+	inline      strings.Builder
+	marker      string
+	listDepth   int
+	lines       []string
+	items       []define.DocSplitItem
+}
+
+func collapseHtmlSpace(s string) string {
+	return strings.Join(strings.Fields(s), ` `)
+}
+
+func htmlNodeText(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	text := ``
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		text += htmlNodeText(child)
+	}
+	return text
+}
+
+func (w *htmlSectionWalker) breadcrumb() string {
+	path := make([]string, 0, len(w.headings))
+	for _, heading := range w.headings {
+		if len(heading) > 0 {
+			path = append(path, heading)
+		}
+	}
+	return MbSubstr(strings.Join(path, ` > `), 0, define.ParagraphTitleMaxLen)
+}
+
+func (w *htmlSectionWalker) endLine() {
+	line := collapseHtmlSpace(w.inline.String())
+	w.inline.Reset()
+	if len(line) == 0 {
+		return
+	}
+	w.lines = append(w.lines, w.marker+line)
+	w.marker = ``
+}
+
+func (w *htmlSectionWalker) flush() {
+	w.endLine()
+	content := strings.TrimSpace(strings.Join(w.lines, "\n"))
+	w.lines = w.lines[:0]
+	if len(content) > 0 {
+		w.items = append(w.items, define.DocSplitItem{Title: w.breadcrumb(), Content: content})
+	}
+}
+
+func (w *htmlSectionWalker) walkChildren(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		switch child.Type {
+		case html.TextNode:
+			w.inline.WriteString(child.Data)
+		case html.ElementNode:
+			w.walkElement(child)
+		case html.DocumentNode:
+			w.walkChildren(child)
+		}
+	}
+}
+
+func (w *htmlSectionWalker) walkElement(node *html.Node) {
+	if level, ok := htmlHeadingLevels[node.DataAtom]; ok {
+		w.flush()
+		w.headings[level-1] = collapseHtmlSpace(htmlNodeText(node))
+		for i := level; i < len(w.headings); i++ {
+			w.headings[i] = ``
+		}
+		return
+	}
+	switch {
+	case slices.Contains(htmlSkipTags, node.DataAtom):
+	case node.DataAtom == atom.Br:
+		w.endLine()
+	case node.DataAtom == atom.Pre: //keep the line breaks of the code blocks
+		w.endLine()
+		if code := strings.Trim(htmlNodeText(node), "\r\n"); len(strings.TrimSpace(code)) > 0 {
+			w.lines = append(w.lines, code)
+		}
+	case node.DataAtom == atom.Table:
+		w.endLine()
+		if table := FormatHtmlTable(node, w.tableFormat); len(table) > 0 {
+			w.lines = append(w.lines, table)
+		}
+	case node.DataAtom == atom.Ul || node.DataAtom == atom.Ol:
+		w.endLine()
+		w.walkList(node)
+	case slices.Contains(htmlBlockTags, node.DataAtom):
+		w.endLine()
+		w.walkChildren(node)
+		w.endLine()
+	default: //inline elements
+		w.walkChildren(node)
+	}
+}
+
+func (w *htmlSectionWalker) walkList(node *html.Node) {
+	w.listDepth++
+	number := 0
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+		if child.DataAtom != atom.Li {
+			w.walkElement(child)
+			continue
+		}
+		number++
+		w.endLine()
+		w.marker = strings.Repeat(`  `, w.listDepth-1) + `- `
+		if node.DataAtom == atom.Ol {
+			w.marker = strings.Repeat(`  `, w.listDepth-1) + cast.ToString(number) + `. `
+		}
+		w.walkChildren(child)
+		w.endLine()
+	}
+	w.marker = ``
+	w.listDepth--
+}
+
+// ReadHtmlStructure split the converted html into sections by the h1-h6 headings,
+// the title of a section is the breadcrumb of its headings, e.g. Install > Linux > Proxy
+func ReadHtmlStructure(htmlUrl string, userId, tableFormat int) ([]define.DocSplitItem, int, error) {
+	content, err := tool.ReadFile(GetFileByLink(htmlUrl))
+	if err != nil {
+		return nil, 0, err
+	}
+	if !utf8.ValidString(content) {
+		content = tool.Convert(content, `gbk`, `utf-8`)
+	}
+	doc, err := ParseHtmlDocument(content, userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	walker := &htmlSectionWalker{tableFormat: tableFormat}
+	for _, node := range doc.Nodes {
+		walker.walkChildren(node)
+	}
+	walker.flush()
+	wordTotal := 0
+	for _, item := range walker.items {
+		wordTotal += utf8.RuneCountInString(item.Content)
+	}
+	return walker.items, wordTotal, nil
+}
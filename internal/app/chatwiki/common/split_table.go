@@ -0,0 +1,177 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/textsplitter"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// the converted tables are wrapped by these marks until splitting,so that they are split by rows
+const (
+	tableMarkStart  = "\uE000"
+	tableMarkHeader = "\uE001"
+	tableMarkEnd    = "\uE002"
+)
+
+type docSegment struct {
+	text    string
+	isTable bool
+	header  string
+	rows    []string
+}
+
+// getHtmlTableRows the rows of the nested tables belong to their cells
+func getHtmlTableRows(node *html.Node) [][]string {
+	rows := make([][]string, 0)
+	var walkRows func(node *html.Node)
+	walkRows = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode || child.DataAtom == atom.Table {
+				continue
+			}
+			if child.DataAtom != atom.Tr {
+				walkRows(child)
+				continue
+			}
+			cells := make([]string, 0)
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+					cells = append(cells, collapseHtmlSpace(htmlNodeText(cell)))
+				}
+			}
+			if len(collapseHtmlSpace(strings.Join(cells, ``))) > 0 {
+				rows = append(rows, cells)
+			}
+		}
+	}
+	walkRows(node)
+	return rows
+}
+
+func formatMarkdownRow(cells []string) string {
+	for i := range cells {
+		cells[i] = strings.ReplaceAll(cells[i], `|`, `\|`)
+	}
+	return `| ` + strings.Join(cells, ` | `) + ` |`
+}
+
+// FormatHtmlTable the first row is taken as the header,
+// it is repeated in each chunk in markdown and merged into each row as column:value otherwise
+func FormatHtmlTable(node *html.Node, tableFormat int) string {
+	rows := getHtmlTableRows(node)
+	if len(rows) == 0 {
+		return ``
+	}
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	for i := range rows {
+		for len(rows[i]) < columns {
+			rows[i] = append(rows[i], ``)
+		}
+	}
+	header, lines := ``, make([]string, 0, len(rows))
+	if tableFormat == define.TableFormatRow {
+		if len(rows) == 1 {
+			lines = append(lines, strings.Join(rows[0], `;`))
+		}
+		for _, row := range rows[1:] {
+			pairs := make([]string, 0, columns)
+			for j, value := range row {
+				if len(value) > 0 {
+					pairs = append(pairs, fmt.Sprintf(`%s:%s`, rows[0][j], value))
+				}
+			}
+			lines = append(lines, strings.Join(pairs, `;`))
+		}
+	} else {
+		header = formatMarkdownRow(rows[0]) + "\n|" + strings.Repeat(` --- |`, columns)
+		for _, row := range rows[1:] {
+			lines = append(lines, formatMarkdownRow(row))
+		}
+	}
+	return tableMarkStart + header + tableMarkHeader + strings.Join(lines, "\n") + tableMarkEnd
+}
+
+// ReplaceHtmlTables replace the outermost tables with their text before the tags are stripped
+func ReplaceHtmlTables(node *html.Node, tableFormat int) {
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode && child.DataAtom == atom.Table {
+			text := &html.Node{Type: html.TextNode, Data: "\n" + FormatHtmlTable(child, tableFormat) + "\n"}
+			node.InsertBefore(text, child)
+			node.RemoveChild(child)
+		} else {
+			ReplaceHtmlTables(child, tableFormat)
+		}
+		child = next
+	}
+}
+
+func splitDocSegments(content string) []docSegment {
+	segments := make([]docSegment, 0)
+	for len(content) > 0 {
+		start := strings.Index(content, tableMarkStart)
+		end := strings.Index(content, tableMarkEnd)
+		if start < 0 || end < start {
+			segments = append(segments, docSegment{text: content})
+			break
+		}
+		if start > 0 {
+			segments = append(segments, docSegment{text: content[:start]})
+		}
+		table := content[start+len(tableMarkStart) : end]
+		header, body, _ := strings.Cut(table, tableMarkHeader)
+		segment := docSegment{isTable: true, header: header}
+		for _, row := range strings.Split(body, "\n") {
+			if len(strings.TrimSpace(row)) > 0 {
+				segment.rows = append(segment.rows, row)
+			}
+		}
+		segments = append(segments, segment)
+		content = content[end+len(tableMarkEnd):]
+	}
+	return segments
+}
+
+// StripTableMarks the table text is kept as it is,e.g. in the answers of the qa documents
+func StripTableMarks(content string) string {
+	return strings.NewReplacer(tableMarkStart, "\n", tableMarkHeader, "\n", tableMarkEnd, "\n").Replace(content)
+}
+
+func joinTableChunk(header string, rows []string) string {
+	if len(header) == 0 {
+		return strings.Join(rows, "\n")
+	}
+	return header + "\n" + strings.Join(rows, "\n")
+}
+
+// SplitTableRows a table is never split inside a row,the header is repeated in each chunk.
+// Only a row longer than MaxContent is split by the splitter
+func SplitTableRows(split textsplitter.RecursiveCharacter, segment docSegment) []string {
+	chunks, rows := make([]string, 0), make([]string, 0)
+	for _, row := range segment.rows {
+		if len(rows) > 0 && split.LenFunc(joinTableChunk(segment.header, append(rows[:len(rows):len(rows)], row))) > split.ChunkSize {
+			chunks = append(chunks, joinTableChunk(segment.header, rows))
+			rows = make([]string, 0)
+		}
+		if utf8.RuneCountInString(joinTableChunk(segment.header, []string{row})) > MaxContent {
+			parts, _ := split.SplitText(row)
+			chunks = append(chunks, parts...)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) > 0 || len(chunks) == 0 {
+		chunks = append(chunks, joinTableChunk(segment.header, rows))
+	}
+	return chunks
+}
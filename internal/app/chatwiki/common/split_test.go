@@ -0,0 +1,83 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/textsplitter"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestMultDocSplitSeparatorRulesSkipTables(t *testing.T) {
+	rows := make([]string, 0)
+	for i := 1; i <= 20; i++ {
+		rows = append(rows, fmt.Sprintf(`<tr><td>第%d条</td><td>条款内容%d</td></tr>`, i, i))
+	}
+	doc, err := html.Parse(strings.NewReader(`<table><tr><th>编号</th><th>内容</th></tr>` + strings.Join(rows, ``) + `</table>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var table *html.Node
+	var find func(node *html.Node)
+	find = func(node *html.Node) {
+		for child := node.FirstChild; child != nil && table == nil; child = child.NextSibling {
+			if child.DataAtom == atom.Table {
+				table = child
+				return
+			}
+			find(child)
+		}
+	}
+	find(doc)
+	content := "第1条 总则的内容\n" + FormatHtmlTable(table, define.TableFormatMarkdown) + "\n第2条 附则的内容"
+
+	split := textsplitter.NewRecursiveCharacter()
+	split.Separators = []string{"\n", ``}
+	split.ChunkSize = 100
+	split.ChunkOverlap = 0
+	split.LenFunc = utf8.RuneCountInString
+	rules := []define.SeparatorRule{{Pattern: `第\d+条`, KeepDelimiter: true}}
+	list := MultDocSplit(split, rules, []define.DocSplitItem{{Content: content}})
+
+	header := "| 编号 | 内容 |\n| --- | --- |"
+	texts, tables := make([]string, 0), 0
+	for _, item := range list {
+		if strings.ContainsAny(item.Content, tableMarkStart+tableMarkHeader+tableMarkEnd) {
+			t.Fatalf(`table marks left in the paragraph:%q`, item.Content)
+		}
+		if !strings.Contains(item.Content, `|`) {
+			texts = append(texts, item.Content)
+			continue
+		}
+		tables++
+		if !strings.HasPrefix(item.Content, header) {
+			t.Fatalf(`the header is not repeated:%q`, item.Content)
+		}
+		for _, line := range strings.Split(item.Content, "\n") {
+			if !strings.HasPrefix(line, `|`) || !strings.HasSuffix(line, `|`) {
+				t.Fatalf(`a row is cut:%q`, line)
+			}
+		}
+	}
+	if tables < 2 {
+		t.Fatalf(`the table should be split into several chunks:%d`, tables)
+	}
+	if len(texts) != 2 || texts[0] != `第1条 总则的内容` || texts[1] != `第2条 附则的内容` {
+		t.Fatalf(`the text outside the table:%q`, texts)
+	}
+}
+
+func TestSeparatorRuleSplit(t *testing.T) {
+	rules := []define.SeparatorRule{{Pattern: `第\d+条`, KeepDelimiter: true}, {Pattern: `-{3,}`}}
+	pieces := SeparatorRuleSplit(rules, "前言\n第1条 甲\n---\n乙\n第2条 丙")
+	expected := []string{`前言`, `第1条 甲`, `乙`, `第2条 丙`}
+	if strings.Join(pieces, `,`) != strings.Join(expected, `,`) {
+		t.Fatalf(`pieces:%q`, pieces)
+	}
+}
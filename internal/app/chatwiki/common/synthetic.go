@@ -0,0 +1,155 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+	"github.com/zhimaAi/llm_adaptor/adaptor"
+)
+
+// IsSyntheticQuestionLibrary generate likely user questions for the normal paragraphs,
+// they are stored as custom index rows pointing to the paragraph
+func IsSyntheticQuestionLibrary(library msql.Params) bool {
+	return cast.ToInt(library[`synthetic_question_status`]) == define.SwitchOn &&
+		cast.ToInt(library[`synthetic_question_num`]) > 0 && cast.ToInt(library[`synthetic_model_config_id`]) > 0
+}
+
+func GetSyntheticHash(content string) string {
+	return tool.MD5(strings.TrimSpace(content))
+}
+
+// AddSyntheticQuestionJobs the task skips the paragraphs whose content has not changed since the last generation
+func AddSyntheticQuestionJobs(library msql.Params, dataIds []int64, force bool) {
+	if !IsSyntheticQuestionLibrary(library) {
+		return
+	}
+	for _, dataId := range dataIds {
+		if message, err := tool.JsonEncode(map[string]any{`data_id`: dataId, `force`: force}); err != nil {
+			logs.Error(err.Error())
+		} else if err := AddJobs(define.SyntheticQuestionTopic, message); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+}
+
+// CheckSyntheticQuestions trim, dedupe and limit the questions
+func CheckSyntheticQuestions(questions []string, num int) []string {
+	list := make([]string, 0, len(questions))
+	for _, question := range questions {
+		question = strings.TrimSpace(question)
+		if len(question) == 0 || utf8.RuneCountInString(question) > define.SyntheticQuestionMaxLen || tool.InArrayString(question, list) {
+			continue
+		}
+		list = append(list, question)
+		if len(list) >= num {
+			break
+		}
+	}
+	return list
+}
+
+func parseSyntheticQuestions(result string) ([]string, error) {
+	start, end := strings.Index(result, `[`), strings.LastIndex(result, `]`)
+	if start < 0 || end <= start {
+		return nil, errors.New(`synthetic question result is not a json array:` + result)
+	}
+	var questions []string
+	if err := json.Unmarshal([]byte(result[start:end+1]), &questions); err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
+
+func GenerateSyntheticQuestions(library, paragraph msql.Params) ([]string, error) {
+	num := cast.ToInt(library[`synthetic_question_num`])
+	prompt := strings.ReplaceAll(define.PromptDefaultSyntheticQuestion, `{{num}}`, cast.ToString(num))
+	prompt = strings.ReplaceAll(prompt, `{{content}}`, paragraph[`content`])
+	messages := []adaptor.ZhimaChatCompletionMessage{{Role: `user`, Content: prompt}}
+	chatResp, _, err := RequestChat(
+		cast.ToInt(paragraph[`admin_user_id`]),
+		``,
+		msql.Params{},
+		``,
+		cast.ToInt(library[`synthetic_model_config_id`]),
+		library[`synthetic_use_model`],
+		messages,
+		nil,
+		0.5,
+		100*num,
+	)
+	if err != nil {
+		return nil, err
+	}
+	questions, err := parseSyntheticQuestions(chatResp.Result)
+	if err != nil {
+		return nil, err
+	}
+	return CheckSyntheticQuestions(questions, num), nil
+}
+
+// SaveSyntheticQuestions replace the custom index rows of the paragraph and convert them to vectors
+func SaveSyntheticQuestions(paragraph msql.Params, questions []string, hash string) error {
+	m := msql.Model(`chat_ai_library_file_data_index`, define.Postgres)
+	olds, err := m.Where(`data_id`, paragraph[`id`]).Where(`type`, cast.ToString(define.VectorTypeCustom)).
+		Order(`id`).ColumnArr(`content`)
+	if err != nil {
+		return err
+	}
+	if strings.Join(olds, "\x00") == strings.Join(questions, "\x00") {
+		_, err = m.Table(`chat_ai_library_file_data`).Where(`id`, paragraph[`id`]).Update(msql.Datas{`synthetic_hash`: hash})
+		return err //no change
+	}
+	if err = m.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = m.Rollback()
+	}()
+	_, err = m.Where(`data_id`, paragraph[`id`]).Where(`type`, cast.ToString(define.VectorTypeCustom)).Delete()
+	if err != nil {
+		return err
+	}
+	vectorIds := make([]int64, 0, len(questions))
+	for _, question := range questions {
+		id, err := m.Insert(msql.Datas{
+			`admin_user_id`: paragraph[`admin_user_id`],
+			`library_id`:    paragraph[`library_id`],
+			`file_id`:       paragraph[`file_id`],
+			`data_id`:       paragraph[`id`],
+			`type`:          define.VectorTypeCustom,
+			`content`:       question,
+			`status`:        define.VectorStatusInitial,
+			`create_time`:   tool.Time2Int(),
+			`update_time`:   tool.Time2Int(),
+		}, `id`)
+		if err != nil {
+			return err
+		}
+		vectorIds = append(vectorIds, id)
+	}
+	_, err = m.Table(`chat_ai_library_file_data`).Where(`id`, paragraph[`id`]).Update(msql.Datas{`synthetic_hash`: hash})
+	if err != nil {
+		return err
+	}
+	if err = m.Commit(); err != nil {
+		return err
+	}
+	//async task:convert vector
+	for _, id := range vectorIds {
+		if message, err := tool.JsonEncode(map[string]any{`id`: id, `file_id`: paragraph[`file_id`]}); err != nil {
+			logs.Error(err.Error())
+		} else if err := AddJobs(define.ConvertVectorTopic, message); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+	return nil
+}
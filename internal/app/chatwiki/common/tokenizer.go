@@ -0,0 +1,108 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+)
+
+var (
+	cl100kOnce     sync.Once
+	cl100kEncoding *tiktoken.Tiktoken
+)
+
+// getCl100kEncoding the bpe file is downloaded on first use,nil is returned when it can not be loaded
+func getCl100kEncoding() *tiktoken.Tiktoken {
+	cl100kOnce.Do(func() {
+		var err error
+		if cl100kEncoding, err = tiktoken.GetEncoding(`cl100k_base`); err != nil {
+			logs.Error(`load cl100k_base encoding failed,fallback to estimate:` + err.Error())
+		}
+	})
+	return cl100kEncoding
+}
+
+// EstimateTokens a cjk character is about one token for the bert like embedding models,
+// a run of latin letters or digits is about one token per four characters
+func EstimateTokens(text string) int {
+	total, word := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			word++
+			continue
+		}
+		total += (word + 3) / 4
+		word = 0
+		if !unicode.IsSpace(r) {
+			total++
+		}
+	}
+	return total + (word+3)/4
+}
+
+type EmbeddingTokenizer struct {
+	ModelDefine string
+	UseModel    string
+	MaxInput    int //the max input tokens of the embedding model,0 unknown
+	encoding    *tiktoken.Tiktoken
+}
+
+// GetEmbeddingTokenizer the openai embedding models use cl100k_base,the others are estimated
+func GetEmbeddingTokenizer(library msql.Params) *EmbeddingTokenizer {
+	tokenizer := &EmbeddingTokenizer{UseModel: library[`use_model`]}
+	config, err := GetModelConfigInfo(cast.ToInt(library[`model_config_id`]), 0)
+	if err != nil {
+		logs.Error(err.Error())
+	}
+	tokenizer.ModelDefine = config[`model_define`]
+	if modelInfo, ok := GetModelInfoByDefine(tokenizer.ModelDefine); ok {
+		tokenizer.MaxInput = modelInfo.VectorModelMaxInput[tokenizer.UseModel]
+	}
+	if tokenizer.MaxInput == 0 {
+		tokenizer.MaxInput = define.DefaultVectorMaxInput
+	}
+	if tokenizer.ModelDefine == ModelOpenAI || tokenizer.ModelDefine == ModelAzureOpenAI || tokenizer.ModelDefine == ModelOpenAIAgent {
+		tokenizer.encoding = getCl100kEncoding()
+	}
+	return tokenizer
+}
+
+// Estimated only the openai models are counted by their real tokenizer,
+// the tokens of the other providers are estimated by EstimateTokens
+func (t *EmbeddingTokenizer) Estimated() bool {
+	return t.encoding == nil
+}
+
+// InputLimit the max tokens of a chunk,a margin is kept below the model input when the tokens are estimated
+func (t *EmbeddingTokenizer) InputLimit() int {
+	if t.Estimated() {
+		return t.MaxInput * define.TokenEstimateMargin / 100
+	}
+	return t.MaxInput
+}
+
+func (t *EmbeddingTokenizer) Count(text string) int {
+	if t.encoding != nil {
+		return len(t.encoding.EncodeOrdinary(text))
+	}
+	return EstimateTokens(text)
+}
+
+// SplitLenFunc the length of a chunk for the splitter. In token unit the chunk is also kept
+// within MaxContent characters,the paragraph columns are limited to it
+func (t *EmbeddingTokenizer) SplitLenFunc(splitParams define.SplitParams) func(string) int {
+	if splitParams.ChunkUnit != define.ChunkUnitToken {
+		return utf8.RuneCountInString
+	}
+	return func(text string) int {
+		return max(t.Count(text), utf8.RuneCountInString(text)*splitParams.ChunkSize/MaxContent)
+	}
+}
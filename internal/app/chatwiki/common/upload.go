@@ -24,9 +24,11 @@ import (
 )
 
 type CrawlerPage struct {
-	RawHtml    string `json:"html"`
-	MainHtml   string `json:"main_html"`
-	Screenshot string `json:"screenshot"`
+	RawHtml    string   `json:"html"`
+	MainHtml   string   `json:"main_html"`
+	Screenshot string   `json:"screenshot"`
+	Links      []string `json:"links"`
+	Canonical  string   `json:"canonical"`
 }
 
 func SaveUploadedFile(fileHeader *multipart.FileHeader, limitSize, userId int, saveDir string, allowExt []string) (*define.UploadInfo, error) {
@@ -58,7 +60,7 @@ func SaveUploadedFile(fileHeader *multipart.FileHeader, limitSize, userId int, s
 	if err != nil {
 		return nil, err
 	}
-	return &define.UploadInfo{Name: fileHeader.Filename, Size: fileHeader.Size, Ext: ext, Link: link}, nil
+	return &define.UploadInfo{Name: fileHeader.Filename, Size: fileHeader.Size, Ext: ext, Link: link, Hash: md5Hash}, nil
 }
 
 func SaveUploadedFileMulti(c *gin.Context, name string, limitSize, userId int, saveDir string, allowExt []string) ([]*define.UploadInfo, []string) {
@@ -79,7 +81,15 @@ func SaveUploadedFileMulti(c *gin.Context, name string, limitSize, userId int, s
 }
 
 func SaveUrlPage(userId int, url, saveDir string) (*define.UploadInfo, error) {
+	crawlerPage, err := RequestCrawlerPage(url)
+	if err != nil {
+		return nil, err
+	}
+	return SaveCrawlerPage(userId, url, saveDir, crawlerPage)
+}
 
+// RequestCrawlerPage the rendered page with its links from the crawler
+func RequestCrawlerPage(url string) (*CrawlerPage, error) {
 	// check url
 	parsedURL, err := netURL.Parse(url)
 	if err != nil || parsedURL == nil {
@@ -118,6 +128,15 @@ func SaveUrlPage(userId int, url, saveDir string) (*define.UploadInfo, error) {
 	if len(crawlerPage.MainHtml) == 0 {
 		return nil, errors.New("fetch url " + url + " failed")
 	}
+	return &crawlerPage, nil
+}
+
+// SaveCrawlerPage save the readability article of the page
+func SaveCrawlerPage(userId int, url, saveDir string, crawlerPage *CrawlerPage) (*define.UploadInfo, error) {
+	parsedURL, err := netURL.Parse(url)
+	if err != nil || parsedURL == nil {
+		return nil, errors.New("invalid URL")
+	}
 
 	// parse readability article
 	blockTags := "</(div|p|h[1-6]|article|section|header|footer|blockquote|ul|ol|li|nav|aside)>"
@@ -145,5 +164,5 @@ func SaveUrlPage(userId int, url, saveDir string) (*define.UploadInfo, error) {
 		return nil, err
 	}
 
-	return &define.UploadInfo{Name: MbSubstr(article.Title, 0, 100), Size: fileInfo.Size(), Ext: "html", Link: link, Online: true, DocUrl: url}, nil
+	return &define.UploadInfo{Name: MbSubstr(article.Title, 0, 100), Size: fileInfo.Size(), Ext: "html", Link: link, Online: true, DocUrl: url, Hash: md5Hash}, nil
 }
@@ -0,0 +1,113 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package common
+
+import (
+	"chatwiki/internal/app/chatwiki/define"
+	"chatwiki/internal/pkg/lib_redis"
+
+	"github.com/spf13/cast"
+	"github.com/zhimaAi/go_tools/logs"
+	"github.com/zhimaAi/go_tools/msql"
+	"github.com/zhimaAi/go_tools/tool"
+)
+
+// SaveDeadVector a dead letter per index row,the one of a row that fails again is reused
+func SaveDeadVector(row msql.Params, errmsg string) {
+	m := msql.Model(`chat_ai_library_vector_dead`, define.Postgres)
+	id, err := m.Where(`index_id`, row[`id`]).Value(`id`)
+	if err != nil {
+		logs.Error(err.Error())
+		return
+	}
+	data := msql.Datas{
+		`status`:      define.DeadVectorStatusWaiting,
+		`errmsg`:      MbSubstr(errmsg, 0, 1000),
+		`retry_times`: cast.ToInt(row[`retry_times`]),
+		`update_time`: tool.Time2Int(),
+	}
+	if cast.ToInt(id) > 0 {
+		_, err = m.Where(`id`, id).Update(data)
+	} else {
+		data[`admin_user_id`] = row[`admin_user_id`]
+		data[`library_id`] = row[`library_id`]
+		data[`file_id`] = row[`file_id`]
+		data[`data_id`] = row[`data_id`]
+		data[`index_id`] = row[`id`]
+		data[`type`] = row[`type`]
+		data[`create_time`] = tool.Time2Int()
+		_, err = m.Insert(data)
+	}
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
+
+func DeleteDeadVector(indexId string) {
+	_, err := msql.Model(`chat_ai_library_vector_dead`, define.Postgres).Where(`index_id`, indexId).Delete()
+	if err != nil {
+		logs.Error(err.Error())
+	}
+}
+
+// RetryDeadVectors convert the dead vectors again with the full retries,the files are learning until they finish.
+// The dead letters whose rows are deleted or converted are removed
+func RetryDeadVectors(list []msql.Params) (int, error) {
+	indexIds := make(map[int][]string)
+	for _, dead := range list {
+		affected, err := msql.Model(`chat_ai_library_file_data_index`, define.Postgres).
+			Where(`id`, dead[`index_id`]).
+			Where(`status`, cast.ToString(define.VectorStatusException)).
+			Update(msql.Datas{
+				`status`:      define.VectorStatusInitial,
+				`errmsg`:      ``,
+				`retry_times`: 0,
+				`retry_time`:  0,
+				`update_time`: tool.Time2Int(),
+			})
+		if err != nil {
+			return 0, err
+		}
+		m := msql.Model(`chat_ai_library_vector_dead`, define.Postgres).Where(`id`, dead[`id`])
+		if affected == 0 {
+			_, err = m.Delete()
+		} else {
+			_, err = m.Update(msql.Datas{`status`: define.DeadVectorStatusRetrying, `update_time`: tool.Time2Int()})
+		}
+		if err != nil {
+			return 0, err
+		}
+		if affected > 0 {
+			fileId := cast.ToInt(dead[`file_id`])
+			indexIds[fileId] = append(indexIds[fileId], dead[`index_id`])
+		}
+	}
+	total := 0
+	for fileId, ids := range indexIds {
+		_, err := msql.Model(`chat_ai_library_file`, define.Postgres).
+			Where(`id`, cast.ToString(fileId)).
+			Where(`status`, `in`, cast.ToString(define.FileStatusLearned)+`,`+cast.ToString(define.FileStatusLearnedWithErrors)).
+			Update(msql.Datas{`status`: define.FileStatusLearning, `update_time`: tool.Time2Int()})
+		if err != nil {
+			return total, err
+		}
+		//clear cached data
+		lib_redis.DelCacheData(define.Redis, &LibFileCacheBuildHandler{FileId: fileId})
+		info, err := GetLibFileInfo(fileId, 0)
+		if err != nil {
+			logs.Error(err.Error())
+		}
+		StartIngestJob(fileId, define.IngestStageEmbed)
+		SetIngestEmbed(fileId, cast.ToInt(info[`split_total`]), len(ids))
+		//async task:convert vector
+		for _, id := range ids {
+			if message, err := tool.JsonEncode(map[string]any{`id`: id, `file_id`: fileId}); err != nil {
+				logs.Error(err.Error())
+			} else if err := AddJobs(define.ConvertVectorTopic, message); err != nil {
+				logs.Error(err.Error())
+			}
+		}
+		total += len(ids)
+	}
+	return total, nil
+}
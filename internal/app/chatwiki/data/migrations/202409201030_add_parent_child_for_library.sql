@@ -0,0 +1,18 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library"
+    ADD COLUMN "enable_parent_child" int2 NOT NULL DEFAULT 0,
+    ADD COLUMN "child_chunk_size"    int4 NOT NULL DEFAULT 200;
+
+COMMENT ON COLUMN "chat_ai_library"."enable_parent_child" IS '父子分段:0关闭,1开启';
+COMMENT ON COLUMN "chat_ai_library"."child_chunk_size" IS '子分段最大字符数';
+
+ALTER TABLE "chat_ai_library_file"
+    ADD COLUMN "enable_parent_child" int2 NOT NULL DEFAULT 0,
+    ADD COLUMN "child_chunk_size"    int4 NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "chat_ai_library_file"."enable_parent_child" IS '学习时是否使用父子分段';
+COMMENT ON COLUMN "chat_ai_library_file"."child_chunk_size" IS '学习时的子分段最大字符数';
+
+ALTER TABLE "chat_ai_answer_source" ADD COLUMN "index_id" int4 NOT NULL DEFAULT 0;
+COMMENT ON COLUMN "chat_ai_answer_source"."index_id" IS '命中的索引ID(父子分段时为子分段)';
@@ -0,0 +1,22 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_robot"
+    ADD COLUMN "rrf_vector_weight" float4 NOT NULL DEFAULT 1,
+    ADD COLUMN "rrf_vector_k"      int4   NOT NULL DEFAULT 60,
+    ADD COLUMN "rrf_search_weight" float4 NOT NULL DEFAULT 1,
+    ADD COLUMN "rrf_search_k"      int4   NOT NULL DEFAULT 60,
+    ADD COLUMN "rrf_rerank_weight" float4 NOT NULL DEFAULT 1,
+    ADD COLUMN "rrf_rerank_k"      int4   NOT NULL DEFAULT 58,
+    ADD COLUMN "mmr_status"        int2   NOT NULL DEFAULT 0,
+    ADD COLUMN "mmr_lambda"        float4 NOT NULL DEFAULT 0.7,
+    ADD COLUMN "min_fused_score"   float4 NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "chat_ai_robot"."rrf_vector_weight" IS 'RRF融合:向量检索权重';
+COMMENT ON COLUMN "chat_ai_robot"."rrf_vector_k" IS 'RRF融合:向量检索k值';
+COMMENT ON COLUMN "chat_ai_robot"."rrf_search_weight" IS 'RRF融合:全文检索权重';
+COMMENT ON COLUMN "chat_ai_robot"."rrf_search_k" IS 'RRF融合:全文检索k值';
+COMMENT ON COLUMN "chat_ai_robot"."rrf_rerank_weight" IS 'RRF融合:Rerank权重';
+COMMENT ON COLUMN "chat_ai_robot"."rrf_rerank_k" IS 'RRF融合:Rerank k值';
+COMMENT ON COLUMN "chat_ai_robot"."mmr_status" IS 'MMR多样性重排开关:0关1开';
+COMMENT ON COLUMN "chat_ai_robot"."mmr_lambda" IS 'MMR相关性与多样性的平衡系数(0~1,越大越偏重相关性)';
+COMMENT ON COLUMN "chat_ai_robot"."min_fused_score" IS '融合后的最低得分(0~1)';
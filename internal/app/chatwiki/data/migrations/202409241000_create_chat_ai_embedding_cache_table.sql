@@ -0,0 +1,25 @@
+-- +goose Up
+
+CREATE TABLE "chat_ai_embedding_cache"
+(
+    "id"              serial       NOT NULL primary key,
+    "hash"            char(32)     NOT NULL DEFAULT '',
+    "model_config_id" int4         NOT NULL DEFAULT 0,
+    "use_model"       varchar(100) NOT NULL DEFAULT '',
+    "embedding"       vector,
+    "create_time"     int4         NOT NULL DEFAULT 0,
+    "update_time"     int4         NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX ON "chat_ai_embedding_cache" ("hash");
+CREATE INDEX ON "chat_ai_embedding_cache" ("model_config_id");
+
+COMMENT ON TABLE "chat_ai_embedding_cache" IS '文档问答机器人-向量缓存';
+
+COMMENT ON COLUMN "chat_ai_embedding_cache"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_embedding_cache"."hash" IS '模型配置ID、模型和文本内容的MD5';
+COMMENT ON COLUMN "chat_ai_embedding_cache"."model_config_id" IS '嵌入模型配置ID';
+COMMENT ON COLUMN "chat_ai_embedding_cache"."use_model" IS '嵌入模型(枚举值)';
+COMMENT ON COLUMN "chat_ai_embedding_cache"."embedding" IS '向量';
+COMMENT ON COLUMN "chat_ai_embedding_cache"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_embedding_cache"."update_time" IS '更新时间';
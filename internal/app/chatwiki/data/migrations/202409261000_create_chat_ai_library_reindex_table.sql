@@ -0,0 +1,48 @@
+-- +goose Up
+
+CREATE TABLE "chat_ai_library_reindex"
+(
+    "id"                  serial        NOT NULL primary key,
+    "admin_user_id"       int4          NOT NULL DEFAULT 0,
+    "library_id"          int4          NOT NULL DEFAULT 0,
+    "old_model_config_id" int4          NOT NULL DEFAULT 0,
+    "old_use_model"       varchar(100)  NOT NULL DEFAULT '',
+    "new_model_config_id" int4          NOT NULL DEFAULT 0,
+    "new_use_model"       varchar(100)  NOT NULL DEFAULT '',
+    "status"              int2          NOT NULL DEFAULT 1,
+    "total"               int4          NOT NULL DEFAULT 0,
+    "converted_total"     int4          NOT NULL DEFAULT 0,
+    "error_total"         int4          NOT NULL DEFAULT 0,
+    "errmsg"              varchar(1000) NOT NULL DEFAULT '',
+    "switch_time"         int4          NOT NULL DEFAULT 0,
+    "create_time"         int4          NOT NULL DEFAULT 0,
+    "update_time"         int4          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_reindex" ("library_id");
+CREATE INDEX ON "chat_ai_library_reindex" ("status");
+
+COMMENT ON TABLE "chat_ai_library_reindex" IS '文档问答机器人-知识库更换嵌入模型的重建索引任务';
+
+COMMENT ON COLUMN "chat_ai_library_reindex"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_reindex"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_reindex"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_reindex"."old_model_config_id" IS '原嵌入模型配置ID';
+COMMENT ON COLUMN "chat_ai_library_reindex"."old_use_model" IS '原嵌入模型';
+COMMENT ON COLUMN "chat_ai_library_reindex"."new_model_config_id" IS '新嵌入模型配置ID';
+COMMENT ON COLUMN "chat_ai_library_reindex"."new_use_model" IS '新嵌入模型';
+COMMENT ON COLUMN "chat_ai_library_reindex"."status" IS '状态:1重建中,2已切换(可回滚),3已完成,4已取消,5失败,6已回滚';
+COMMENT ON COLUMN "chat_ai_library_reindex"."total" IS '索引总数';
+COMMENT ON COLUMN "chat_ai_library_reindex"."converted_total" IS '已转换数';
+COMMENT ON COLUMN "chat_ai_library_reindex"."error_total" IS '转换失败数';
+COMMENT ON COLUMN "chat_ai_library_reindex"."errmsg" IS '错误信息';
+COMMENT ON COLUMN "chat_ai_library_reindex"."switch_time" IS '切换时间';
+COMMENT ON COLUMN "chat_ai_library_reindex"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_reindex"."update_time" IS '更新时间';
+
+ALTER TABLE "chat_ai_library_file_data_index"
+    ADD COLUMN "shadow_embedding" vector,
+    ADD COLUMN "shadow_status"    int2 NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "chat_ai_library_file_data_index"."shadow_embedding" IS '影子向量:重建索引时存放新模型向量,切换后存放原模型向量用于回滚';
+COMMENT ON COLUMN "chat_ai_library_file_data_index"."shadow_status" IS '影子向量状态:0待转换,1已转换,2转换异常';
@@ -0,0 +1,77 @@
+-- +goose Up
+
+CREATE TABLE "chat_ai_library_eval_dataset"
+(
+    "id"            serial       NOT NULL primary key,
+    "admin_user_id" int4         NOT NULL DEFAULT 0,
+    "library_id"    int4         NOT NULL DEFAULT 0,
+    "name"          varchar(100) NOT NULL DEFAULT '',
+    "create_time"   int4         NOT NULL DEFAULT 0,
+    "update_time"   int4         NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_eval_dataset" ("admin_user_id");
+CREATE INDEX ON "chat_ai_library_eval_dataset" ("library_id");
+
+COMMENT ON TABLE "chat_ai_library_eval_dataset" IS '文档问答机器人-知识库召回评测集';
+
+COMMENT ON COLUMN "chat_ai_library_eval_dataset"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_eval_dataset"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_eval_dataset"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_eval_dataset"."name" IS '评测集名称';
+COMMENT ON COLUMN "chat_ai_library_eval_dataset"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_eval_dataset"."update_time" IS '更新时间';
+
+CREATE TABLE "chat_ai_library_eval_question"
+(
+    "id"                     serial        NOT NULL primary key,
+    "admin_user_id"          int4          NOT NULL DEFAULT 0,
+    "dataset_id"             int4          NOT NULL DEFAULT 0,
+    "question"               varchar(1000) NOT NULL DEFAULT '',
+    "expected_paragraph_ids" varchar(1000) NOT NULL DEFAULT '',
+    "expected_answer"        varchar(5000) NOT NULL DEFAULT '',
+    "create_time"            int4          NOT NULL DEFAULT 0,
+    "update_time"            int4          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_eval_question" ("dataset_id");
+
+COMMENT ON TABLE "chat_ai_library_eval_question" IS '文档问答机器人-知识库召回评测问题';
+
+COMMENT ON COLUMN "chat_ai_library_eval_question"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_eval_question"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_eval_question"."dataset_id" IS '评测集ID';
+COMMENT ON COLUMN "chat_ai_library_eval_question"."question" IS '问题';
+COMMENT ON COLUMN "chat_ai_library_eval_question"."expected_paragraph_ids" IS '期望召回的分段ID,多个使用英文逗号隔开';
+COMMENT ON COLUMN "chat_ai_library_eval_question"."expected_answer" IS '期望答案文本(未指定分段ID时使用)';
+COMMENT ON COLUMN "chat_ai_library_eval_question"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_eval_question"."update_time" IS '更新时间';
+
+CREATE TABLE "chat_ai_library_eval_run"
+(
+    "id"            serial        NOT NULL primary key,
+    "admin_user_id" int4          NOT NULL DEFAULT 0,
+    "library_id"    int4          NOT NULL DEFAULT 0,
+    "dataset_id"    int4          NOT NULL DEFAULT 0,
+    "configs"       json          NOT NULL DEFAULT '[]',
+    "results"       json          NOT NULL DEFAULT '[]',
+    "status"        int2          NOT NULL DEFAULT 1,
+    "errmsg"        varchar(1000) NOT NULL DEFAULT '',
+    "create_time"   int4          NOT NULL DEFAULT 0,
+    "update_time"   int4          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_eval_run" ("dataset_id");
+
+COMMENT ON TABLE "chat_ai_library_eval_run" IS '文档问答机器人-知识库召回评测记录';
+
+COMMENT ON COLUMN "chat_ai_library_eval_run"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_eval_run"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_eval_run"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_eval_run"."dataset_id" IS '评测集ID';
+COMMENT ON COLUMN "chat_ai_library_eval_run"."configs" IS '参与对比的检索配置';
+COMMENT ON COLUMN "chat_ai_library_eval_run"."results" IS '各检索配置的评测结果(recall@k,MRR,nDCG)';
+COMMENT ON COLUMN "chat_ai_library_eval_run"."status" IS '状态:1评测中,2已完成,3失败';
+COMMENT ON COLUMN "chat_ai_library_eval_run"."errmsg" IS '错误信息';
+COMMENT ON COLUMN "chat_ai_library_eval_run"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_eval_run"."update_time" IS '更新时间';
@@ -0,0 +1,15 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library"
+    ADD COLUMN "synthetic_question_status" int2         NOT NULL DEFAULT 0,
+    ADD COLUMN "synthetic_question_num"    int2         NOT NULL DEFAULT 3,
+    ADD COLUMN "synthetic_model_config_id" int4         NOT NULL DEFAULT 0,
+    ADD COLUMN "synthetic_use_model"       varchar(100) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN "chat_ai_library"."synthetic_question_status" IS '普通分段生成模拟问题:0关闭,1开启';
+COMMENT ON COLUMN "chat_ai_library"."synthetic_question_num" IS '每个分段生成的问题数量';
+COMMENT ON COLUMN "chat_ai_library"."synthetic_model_config_id" IS '生成问题使用的模型配置ID';
+COMMENT ON COLUMN "chat_ai_library"."synthetic_use_model" IS '生成问题使用的模型';
+
+ALTER TABLE "chat_ai_library_file_data" ADD COLUMN "synthetic_hash" varchar(32) NOT NULL DEFAULT '';
+COMMENT ON COLUMN "chat_ai_library_file_data"."synthetic_hash" IS '生成模拟问题时的分段内容hash,内容变更后重新生成';
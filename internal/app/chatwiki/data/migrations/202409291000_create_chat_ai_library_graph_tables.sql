@@ -0,0 +1,137 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library"
+    ADD COLUMN "graph_status"          int2         NOT NULL DEFAULT 0,
+    ADD COLUMN "graph_model_config_id" int4         NOT NULL DEFAULT 0,
+    ADD COLUMN "graph_use_model"       varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN "graph_dirty"           int2         NOT NULL DEFAULT 0,
+    ADD COLUMN "graph_community_time"  int4         NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "chat_ai_library"."graph_status" IS '知识图谱抽取:0关闭,1开启';
+COMMENT ON COLUMN "chat_ai_library"."graph_model_config_id" IS '抽取实体关系使用的模型配置ID';
+COMMENT ON COLUMN "chat_ai_library"."graph_use_model" IS '抽取实体关系使用的模型';
+COMMENT ON COLUMN "chat_ai_library"."graph_dirty" IS '图谱有变更,需要重新生成社区摘要';
+COMMENT ON COLUMN "chat_ai_library"."graph_community_time" IS '社区摘要生成时间';
+
+ALTER TABLE "chat_ai_library_file_data" ADD COLUMN "graph_hash" varchar(32) NOT NULL DEFAULT '';
+COMMENT ON COLUMN "chat_ai_library_file_data"."graph_hash" IS '抽取实体关系时的分段内容hash,内容变更后重新抽取';
+
+ALTER TABLE "chat_ai_robot"
+    ADD COLUMN "graph_status"     int2   NOT NULL DEFAULT 0,
+    ADD COLUMN "rrf_graph_weight" float4 NOT NULL DEFAULT 1,
+    ADD COLUMN "rrf_graph_k"      int4   NOT NULL DEFAULT 60;
+
+COMMENT ON COLUMN "chat_ai_robot"."graph_status" IS '知识图谱检索:0关闭,1开启';
+COMMENT ON COLUMN "chat_ai_robot"."rrf_graph_weight" IS 'RRF融合:图谱检索权重';
+COMMENT ON COLUMN "chat_ai_robot"."rrf_graph_k" IS 'RRF融合:图谱检索k值';
+
+CREATE TABLE "chat_ai_library_graph_entity"
+(
+    "id"            serial        NOT NULL primary key,
+    "admin_user_id" int4          NOT NULL DEFAULT 0,
+    "library_id"    int4          NOT NULL DEFAULT 0,
+    "name"          varchar(200)  NOT NULL DEFAULT '',
+    "type"          varchar(50)   NOT NULL DEFAULT '',
+    "description"   varchar(1000) NOT NULL DEFAULT '',
+    "community_id"  int4          NOT NULL DEFAULT 0,
+    "create_time"   int4          NOT NULL DEFAULT 0,
+    "update_time"   int4          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_graph_entity" ("library_id");
+
+COMMENT ON TABLE "chat_ai_library_graph_entity" IS '文档问答机器人-知识图谱实体';
+
+COMMENT ON COLUMN "chat_ai_library_graph_entity"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_graph_entity"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_graph_entity"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_graph_entity"."name" IS '实体名称';
+COMMENT ON COLUMN "chat_ai_library_graph_entity"."type" IS '实体类型';
+COMMENT ON COLUMN "chat_ai_library_graph_entity"."description" IS '实体描述';
+COMMENT ON COLUMN "chat_ai_library_graph_entity"."community_id" IS '所属社区ID';
+COMMENT ON COLUMN "chat_ai_library_graph_entity"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_graph_entity"."update_time" IS '更新时间';
+
+CREATE TABLE "chat_ai_library_graph_alias"
+(
+    "id"         serial       NOT NULL primary key,
+    "library_id" int4         NOT NULL DEFAULT 0,
+    "entity_id"  int4         NOT NULL DEFAULT 0,
+    "alias"      varchar(200) NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX ON "chat_ai_library_graph_alias" ("library_id", "alias");
+CREATE INDEX ON "chat_ai_library_graph_alias" ("entity_id");
+
+COMMENT ON TABLE "chat_ai_library_graph_alias" IS '文档问答机器人-知识图谱实体别名(用于实体消歧合并)';
+
+COMMENT ON COLUMN "chat_ai_library_graph_alias"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_graph_alias"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_graph_alias"."entity_id" IS '实体ID';
+COMMENT ON COLUMN "chat_ai_library_graph_alias"."alias" IS '归一化后的实体名称或别名';
+
+CREATE TABLE "chat_ai_library_graph_mention"
+(
+    "id"         serial NOT NULL primary key,
+    "library_id" int4   NOT NULL DEFAULT 0,
+    "file_id"    int4   NOT NULL DEFAULT 0,
+    "data_id"    int4   NOT NULL DEFAULT 0,
+    "entity_id"  int4   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_graph_mention" ("entity_id");
+CREATE INDEX ON "chat_ai_library_graph_mention" ("data_id");
+
+COMMENT ON TABLE "chat_ai_library_graph_mention" IS '文档问答机器人-知识图谱实体出现的分段';
+
+COMMENT ON COLUMN "chat_ai_library_graph_mention"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_graph_mention"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_graph_mention"."file_id" IS '文件ID';
+COMMENT ON COLUMN "chat_ai_library_graph_mention"."data_id" IS '分段ID';
+COMMENT ON COLUMN "chat_ai_library_graph_mention"."entity_id" IS '实体ID';
+
+CREATE TABLE "chat_ai_library_graph_relation"
+(
+    "id"         serial       NOT NULL primary key,
+    "library_id" int4         NOT NULL DEFAULT 0,
+    "file_id"    int4         NOT NULL DEFAULT 0,
+    "data_id"    int4         NOT NULL DEFAULT 0,
+    "source_id"  int4         NOT NULL DEFAULT 0,
+    "target_id"  int4         NOT NULL DEFAULT 0,
+    "relation"   varchar(200) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX ON "chat_ai_library_graph_relation" ("source_id");
+CREATE INDEX ON "chat_ai_library_graph_relation" ("target_id");
+CREATE INDEX ON "chat_ai_library_graph_relation" ("data_id");
+
+COMMENT ON TABLE "chat_ai_library_graph_relation" IS '文档问答机器人-知识图谱实体关系';
+
+COMMENT ON COLUMN "chat_ai_library_graph_relation"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_graph_relation"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_graph_relation"."file_id" IS '文件ID';
+COMMENT ON COLUMN "chat_ai_library_graph_relation"."data_id" IS '抽取出该关系的分段ID';
+COMMENT ON COLUMN "chat_ai_library_graph_relation"."source_id" IS '源实体ID';
+COMMENT ON COLUMN "chat_ai_library_graph_relation"."target_id" IS '目标实体ID';
+COMMENT ON COLUMN "chat_ai_library_graph_relation"."relation" IS '关系描述';
+
+CREATE TABLE "chat_ai_library_graph_community"
+(
+    "id"           serial NOT NULL primary key,
+    "library_id"   int4   NOT NULL DEFAULT 0,
+    "entity_total" int4   NOT NULL DEFAULT 0,
+    "summary"      text   NOT NULL DEFAULT '',
+    "create_time"  int4   NOT NULL DEFAULT 0,
+    "update_time"  int4   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_graph_community" ("library_id");
+
+COMMENT ON TABLE "chat_ai_library_graph_community" IS '文档问答机器人-知识图谱社区摘要';
+
+COMMENT ON COLUMN "chat_ai_library_graph_community"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_graph_community"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_graph_community"."entity_total" IS '社区实体数量';
+COMMENT ON COLUMN "chat_ai_library_graph_community"."summary" IS '社区摘要';
+COMMENT ON COLUMN "chat_ai_library_graph_community"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_graph_community"."update_time" IS '更新时间';
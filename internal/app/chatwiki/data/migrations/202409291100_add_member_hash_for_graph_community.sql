@@ -0,0 +1,6 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library_graph_community"
+    ADD COLUMN "member_hash" varchar(32) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN "chat_ai_library_graph_community"."member_hash" IS '社区实体ID集合的md5,成员不变时沿用已有摘要';
@@ -0,0 +1,10 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_robot"
+    ADD COLUMN "library_route_type"      int2   NOT NULL DEFAULT 0,
+    ADD COLUMN "library_route_top_n"     int2   NOT NULL DEFAULT 3,
+    ADD COLUMN "library_route_threshold" float4 NOT NULL DEFAULT 0.3;
+
+COMMENT ON COLUMN "chat_ai_robot"."library_route_type" IS '知识库路由:0关闭,1按知识库简介向量相似度,2大模型分类';
+COMMENT ON COLUMN "chat_ai_robot"."library_route_top_n" IS '知识库路由最多选择的知识库数量';
+COMMENT ON COLUMN "chat_ai_robot"."library_route_threshold" IS '知识库路由:简介向量相似度阈值(0~1)';
@@ -0,0 +1,12 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_robot"
+    ADD COLUMN "query_expansion_type" int2         NOT NULL DEFAULT 0,
+    ADD COLUMN "hyde_model_config_id" int4         NOT NULL DEFAULT 0,
+    ADD COLUMN "hyde_use_model"       varchar(100) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN "chat_ai_robot"."query_expansion_type" IS '问题扩展策略:0不扩展,1多问题改写,2HyDE假设答案,3多问题改写+HyDE';
+COMMENT ON COLUMN "chat_ai_robot"."hyde_model_config_id" IS '生成HyDE假设答案的模型配置ID,0使用机器人模型';
+COMMENT ON COLUMN "chat_ai_robot"."hyde_use_model" IS '生成HyDE假设答案的模型';
+
+UPDATE "chat_ai_robot" SET "query_expansion_type" = 1 WHERE "enable_question_optimize" = true;
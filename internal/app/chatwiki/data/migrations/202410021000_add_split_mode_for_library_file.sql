@@ -0,0 +1,12 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library_file"
+    ADD COLUMN "split_mode" int2 NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "chat_ai_library_file"."split_mode" IS '分段方式:0按分隔符分段,1按标题结构分段';
+
+ALTER TABLE "chat_ai_library_file_data"
+    ALTER COLUMN "title" TYPE varchar(500);
+
+ALTER TABLE "chat_ai_answer_source"
+    ALTER COLUMN "title" TYPE varchar(500);
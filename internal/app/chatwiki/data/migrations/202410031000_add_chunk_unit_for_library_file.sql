@@ -0,0 +1,6 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library_file"
+    ADD COLUMN "chunk_unit" int2 NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "chat_ai_library_file"."chunk_unit" IS '分段长度单位:0字符,1嵌入模型token';
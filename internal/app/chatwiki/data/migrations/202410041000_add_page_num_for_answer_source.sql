@@ -0,0 +1,6 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_answer_source"
+    ADD COLUMN "page_num" int4 NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "chat_ai_answer_source"."page_num" IS '分段所在页码';
@@ -0,0 +1,6 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library_file"
+    ADD COLUMN "table_format" int2 NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "chat_ai_library_file"."table_format" IS '文档中表格的转换格式:0Markdown表格,1每行按列名:值';
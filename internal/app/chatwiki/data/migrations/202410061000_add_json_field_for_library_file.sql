@@ -0,0 +1,15 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library_file"
+    ALTER COLUMN "file_ext" TYPE varchar(10);
+
+ALTER TABLE "chat_ai_library_file"
+    ADD COLUMN "json_record_path"    varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN "json_content_field"  varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN "json_question_field" varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN "json_answer_field"   varchar(100) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN "chat_ai_library_file"."json_record_path" IS 'json文件中记录数组的字段路径,为空时取根节点';
+COMMENT ON COLUMN "chat_ai_library_file"."json_content_field" IS 'json记录中内容的字段路径,为空时取全部字段';
+COMMENT ON COLUMN "chat_ai_library_file"."json_question_field" IS 'json记录中问题的字段路径';
+COMMENT ON COLUMN "chat_ai_library_file"."json_answer_field" IS 'json记录中答案的字段路径';
@@ -0,0 +1,76 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library_file"
+    ADD COLUMN "folder_path" varchar(500) NOT NULL DEFAULT '',
+    ADD COLUMN "file_hash"   varchar(32)  NOT NULL DEFAULT '';
+
+CREATE INDEX ON "chat_ai_library_file" ("library_id", "file_hash");
+
+COMMENT ON COLUMN "chat_ai_library_file"."folder_path" IS '压缩包导入时文件所在的目录';
+COMMENT ON COLUMN "chat_ai_library_file"."file_hash" IS '文件内容的md5,用于导入时去重';
+
+CREATE TABLE "chat_ai_library_import"
+(
+    "id"                serial        NOT NULL primary key,
+    "admin_user_id"     int4          NOT NULL DEFAULT 0,
+    "library_id"        int4          NOT NULL DEFAULT 0,
+    "zip_name"          varchar(100)  NOT NULL DEFAULT '',
+    "zip_url"           varchar(500)  NOT NULL DEFAULT '',
+    "status"            int2          NOT NULL DEFAULT 1,
+    "total"             int4          NOT NULL DEFAULT 0,
+    "imported_total"    int4          NOT NULL DEFAULT 0,
+    "duplicate_total"   int4          NOT NULL DEFAULT 0,
+    "unsupported_total" int4          NOT NULL DEFAULT 0,
+    "failed_total"      int4          NOT NULL DEFAULT 0,
+    "errmsg"            varchar(1000) NOT NULL DEFAULT '',
+    "create_time"       int4          NOT NULL DEFAULT 0,
+    "update_time"       int4          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_import" ("library_id");
+
+COMMENT ON TABLE "chat_ai_library_import" IS '文档问答机器人-知识库压缩包导入任务';
+
+COMMENT ON COLUMN "chat_ai_library_import"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_import"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_import"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_import"."zip_name" IS '压缩包名称';
+COMMENT ON COLUMN "chat_ai_library_import"."zip_url" IS '压缩包链接';
+COMMENT ON COLUMN "chat_ai_library_import"."status" IS '状态:1导入中,2已完成,3失败';
+COMMENT ON COLUMN "chat_ai_library_import"."total" IS '已处理的文件数';
+COMMENT ON COLUMN "chat_ai_library_import"."imported_total" IS '导入成功的文件数';
+COMMENT ON COLUMN "chat_ai_library_import"."duplicate_total" IS '内容重复的文件数';
+COMMENT ON COLUMN "chat_ai_library_import"."unsupported_total" IS '格式不支持的文件数';
+COMMENT ON COLUMN "chat_ai_library_import"."failed_total" IS '导入失败的文件数';
+COMMENT ON COLUMN "chat_ai_library_import"."errmsg" IS '错误信息';
+COMMENT ON COLUMN "chat_ai_library_import"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_import"."update_time" IS '更新时间';
+
+CREATE TABLE "chat_ai_library_import_file"
+(
+    "id"            serial        NOT NULL primary key,
+    "admin_user_id" int4          NOT NULL DEFAULT 0,
+    "library_id"    int4          NOT NULL DEFAULT 0,
+    "import_id"     int4          NOT NULL DEFAULT 0,
+    "file_path"     varchar(500)  NOT NULL DEFAULT '',
+    "status"        int2          NOT NULL DEFAULT 0,
+    "file_id"       int4          NOT NULL DEFAULT 0,
+    "errmsg"        varchar(1000) NOT NULL DEFAULT '',
+    "create_time"   int4          NOT NULL DEFAULT 0,
+    "update_time"   int4          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_import_file" ("import_id");
+
+COMMENT ON TABLE "chat_ai_library_import_file" IS '文档问答机器人-知识库压缩包导入文件';
+
+COMMENT ON COLUMN "chat_ai_library_import_file"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_import_file"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_import_file"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_import_file"."import_id" IS '导入任务ID';
+COMMENT ON COLUMN "chat_ai_library_import_file"."file_path" IS '文件在压缩包中的路径';
+COMMENT ON COLUMN "chat_ai_library_import_file"."status" IS '状态:1导入成功,2内容重复,3格式不支持,4导入失败';
+COMMENT ON COLUMN "chat_ai_library_import_file"."file_id" IS '知识库文件ID(内容重复时为已存在的文件)';
+COMMENT ON COLUMN "chat_ai_library_import_file"."errmsg" IS '错误信息';
+COMMENT ON COLUMN "chat_ai_library_import_file"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_import_file"."update_time" IS '更新时间';
@@ -0,0 +1,30 @@
+-- +goose Up
+
+CREATE TABLE "chat_ai_library_file_change"
+(
+    "id"              serial NOT NULL primary key,
+    "admin_user_id"   int4   NOT NULL DEFAULT 0,
+    "library_id"      int4   NOT NULL DEFAULT 0,
+    "file_id"         int4   NOT NULL DEFAULT 0,
+    "unchanged_total" int4   NOT NULL DEFAULT 0,
+    "moved_total"     int4   NOT NULL DEFAULT 0,
+    "added_total"     int4   NOT NULL DEFAULT 0,
+    "deleted_total"   int4   NOT NULL DEFAULT 0,
+    "embed_total"     int4   NOT NULL DEFAULT 0,
+    "create_time"     int4   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_file_change" ("file_id");
+
+COMMENT ON TABLE "chat_ai_library_file_change" IS '文档问答机器人-知识库文件每次学习的分段变更记录';
+
+COMMENT ON COLUMN "chat_ai_library_file_change"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_file_change"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_file_change"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_file_change"."file_id" IS '知识库文件ID';
+COMMENT ON COLUMN "chat_ai_library_file_change"."unchanged_total" IS '未变化的分段数';
+COMMENT ON COLUMN "chat_ai_library_file_change"."moved_total" IS '内容未变但序号、页码、标题或图片变化的分段数';
+COMMENT ON COLUMN "chat_ai_library_file_change"."added_total" IS '新增的分段数';
+COMMENT ON COLUMN "chat_ai_library_file_change"."deleted_total" IS '删除的分段数';
+COMMENT ON COLUMN "chat_ai_library_file_change"."embed_total" IS '需要重新向量化的索引数';
+COMMENT ON COLUMN "chat_ai_library_file_change"."create_time" IS '创建时间';
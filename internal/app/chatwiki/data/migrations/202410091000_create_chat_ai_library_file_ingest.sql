@@ -0,0 +1,47 @@
+-- +goose Up
+
+CREATE TABLE "chat_ai_library_file_ingest"
+(
+    "id"              serial        NOT NULL primary key,
+    "admin_user_id"   int4          NOT NULL DEFAULT 0,
+    "library_id"      int4          NOT NULL DEFAULT 0,
+    "file_id"         int4          NOT NULL DEFAULT 0,
+    "stage"           int2          NOT NULL DEFAULT 0,
+    "status"          int2          NOT NULL DEFAULT 0,
+    "paragraph_total" int4          NOT NULL DEFAULT 0,
+    "embed_total"     int4          NOT NULL DEFAULT 0,
+    "embedded_total"  int4          NOT NULL DEFAULT 0,
+    "failed_total"    int4          NOT NULL DEFAULT 0,
+    "errmsg"          varchar(1000) NOT NULL DEFAULT '',
+    "crawl_time"      int4          NOT NULL DEFAULT 0,
+    "convert_time"    int4          NOT NULL DEFAULT 0,
+    "split_time"      int4          NOT NULL DEFAULT 0,
+    "embed_time"      int4          NOT NULL DEFAULT 0,
+    "finish_time"     int4          NOT NULL DEFAULT 0,
+    "create_time"     int4          NOT NULL DEFAULT 0,
+    "update_time"     int4          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_file_ingest" ("file_id", "status");
+CREATE INDEX ON "chat_ai_library_file_ingest" ("library_id", "update_time");
+
+COMMENT ON TABLE "chat_ai_library_file_ingest" IS '文档问答机器人-知识库文件学习任务进度';
+
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."file_id" IS '知识库文件ID';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."stage" IS '当前阶段:1抓取,2转换,3分段,4向量化';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."status" IS '状态:1进行中,2已完成,3失败,4已取消';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."paragraph_total" IS '分段数';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."embed_total" IS '需要向量化的索引数';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."embedded_total" IS '已向量化的索引数';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."failed_total" IS '向量化失败的索引数';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."errmsg" IS '错误信息';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."crawl_time" IS '抓取开始时间';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."convert_time" IS '转换开始时间';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."split_time" IS '分段开始时间';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."embed_time" IS '向量化开始时间';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."finish_time" IS '结束时间';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_file_ingest"."update_time" IS '更新时间';
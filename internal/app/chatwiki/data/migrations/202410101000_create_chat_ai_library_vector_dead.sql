@@ -0,0 +1,42 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library_file_data_index"
+    ADD COLUMN "retry_times" int2 NOT NULL DEFAULT 0,
+    ADD COLUMN "retry_time"  int4 NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "chat_ai_library_file_data_index"."retry_times" IS '向量化失败后的重试次数';
+COMMENT ON COLUMN "chat_ai_library_file_data_index"."retry_time" IS '下次重试的时间,之前不参与批量向量化';
+
+CREATE TABLE "chat_ai_library_vector_dead"
+(
+    "id"            serial        NOT NULL primary key,
+    "admin_user_id" int4          NOT NULL DEFAULT 0,
+    "library_id"    int4          NOT NULL DEFAULT 0,
+    "file_id"       int4          NOT NULL DEFAULT 0,
+    "data_id"       int4          NOT NULL DEFAULT 0,
+    "index_id"      int4          NOT NULL DEFAULT 0,
+    "type"          int2          NOT NULL DEFAULT 0,
+    "status"        int2          NOT NULL DEFAULT 0,
+    "retry_times"   int2          NOT NULL DEFAULT 0,
+    "errmsg"        varchar(1000) NOT NULL DEFAULT '',
+    "create_time"   int4          NOT NULL DEFAULT 0,
+    "update_time"   int4          NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX ON "chat_ai_library_vector_dead" ("index_id");
+CREATE INDEX ON "chat_ai_library_vector_dead" ("library_id", "file_id");
+
+COMMENT ON TABLE "chat_ai_library_vector_dead" IS '文档问答机器人-重试后仍向量化失败的索引(死信)';
+
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."file_id" IS '知识库文件ID';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."data_id" IS '分段ID';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."index_id" IS '索引ID';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."type" IS '索引类型';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."status" IS '状态:1待处理,2重试中';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."retry_times" IS '已自动重试的次数';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."errmsg" IS '最后一次的错误信息';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_vector_dead"."update_time" IS '更新时间';
@@ -0,0 +1,44 @@
+-- +goose Up
+
+CREATE TABLE "chat_ai_library_file_version"
+(
+    "id"               serial       NOT NULL primary key,
+    "admin_user_id"    int4         NOT NULL DEFAULT 0,
+    "library_id"       int4         NOT NULL DEFAULT 0,
+    "file_id"          int4         NOT NULL DEFAULT 0,
+    "version"          int4         NOT NULL DEFAULT 0,
+    "file_name"        varchar(100) NOT NULL DEFAULT '',
+    "file_url"         varchar(500) NOT NULL DEFAULT '',
+    "file_size"        int4         NOT NULL DEFAULT 0,
+    "file_hash"        varchar(32)  NOT NULL DEFAULT '',
+    "html_url"         varchar(500) NOT NULL DEFAULT '',
+    "split_params"     text         NOT NULL DEFAULT '{}',
+    "qa_index_type"    int2         NOT NULL DEFAULT 0,
+    "word_total"       int4         NOT NULL DEFAULT 0,
+    "paragraph_total"  int4         NOT NULL DEFAULT 0,
+    "paragraphs"       text         NOT NULL DEFAULT '[]',
+    "rollback_version" int4         NOT NULL DEFAULT 0,
+    "create_time"      int4         NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX ON "chat_ai_library_file_version" ("file_id", "version");
+
+COMMENT ON TABLE "chat_ai_library_file_version" IS '文档问答机器人-知识库文件每次学习后的版本快照';
+
+COMMENT ON COLUMN "chat_ai_library_file_version"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_file_version"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_file_version"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_file_version"."file_id" IS '知识库文件ID';
+COMMENT ON COLUMN "chat_ai_library_file_version"."version" IS '版本号,文件内递增';
+COMMENT ON COLUMN "chat_ai_library_file_version"."file_name" IS '源文件名称';
+COMMENT ON COLUMN "chat_ai_library_file_version"."file_url" IS '源文件链接';
+COMMENT ON COLUMN "chat_ai_library_file_version"."file_size" IS '源文件大小';
+COMMENT ON COLUMN "chat_ai_library_file_version"."file_hash" IS '源文件MD5';
+COMMENT ON COLUMN "chat_ai_library_file_version"."html_url" IS '转换后的html链接';
+COMMENT ON COLUMN "chat_ai_library_file_version"."split_params" IS '分段参数(json)';
+COMMENT ON COLUMN "chat_ai_library_file_version"."qa_index_type" IS 'QA文档的索引方式';
+COMMENT ON COLUMN "chat_ai_library_file_version"."word_total" IS '字数';
+COMMENT ON COLUMN "chat_ai_library_file_version"."paragraph_total" IS '分段数';
+COMMENT ON COLUMN "chat_ai_library_file_version"."paragraphs" IS '分段快照(json)';
+COMMENT ON COLUMN "chat_ai_library_file_version"."rollback_version" IS '由回滚产生时,回滚到的版本号';
+COMMENT ON COLUMN "chat_ai_library_file_version"."create_time" IS '创建时间';
@@ -0,0 +1,81 @@
+-- +goose Up
+
+CREATE TABLE "chat_ai_library_qa_generate"
+(
+    "id"              serial        NOT NULL primary key,
+    "admin_user_id"   int4          NOT NULL DEFAULT 0,
+    "library_id"      int4          NOT NULL DEFAULT 0,
+    "file_id"         int4          NOT NULL DEFAULT 0,
+    "model_config_id" int4          NOT NULL DEFAULT 0,
+    "use_model"       varchar(100)  NOT NULL DEFAULT '',
+    "pair_num"        int2          NOT NULL DEFAULT 0,
+    "status"          int2          NOT NULL DEFAULT 0,
+    "paragraph_total" int4          NOT NULL DEFAULT 0,
+    "processed_total" int4          NOT NULL DEFAULT 0,
+    "failed_total"    int4          NOT NULL DEFAULT 0,
+    "pair_total"      int4          NOT NULL DEFAULT 0,
+    "qa_file_id"      int4          NOT NULL DEFAULT 0,
+    "errmsg"          varchar(1000) NOT NULL DEFAULT '',
+    "create_time"     int4          NOT NULL DEFAULT 0,
+    "update_time"     int4          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_qa_generate" ("library_id", "file_id");
+
+COMMENT ON TABLE "chat_ai_library_qa_generate" IS '文档问答机器人-由普通文档生成问答对的任务';
+
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."file_id" IS '源文档ID';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."model_config_id" IS '生成使用的模型配置ID';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."use_model" IS '生成使用的模型';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."pair_num" IS '每个分段最多生成的问答对数';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."status" IS '状态:1生成中,2已完成,3失败';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."paragraph_total" IS '源文档分段数';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."processed_total" IS '已处理的分段数';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."failed_total" IS '生成失败的分段数';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."pair_total" IS '生成的问答对数';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."qa_file_id" IS '保存问答对的QA文档ID';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."errmsg" IS '错误信息';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_qa_generate"."update_time" IS '更新时间';
+
+CREATE TABLE "chat_ai_library_qa_candidate"
+(
+    "id"            serial       NOT NULL primary key,
+    "admin_user_id" int4         NOT NULL DEFAULT 0,
+    "library_id"    int4         NOT NULL DEFAULT 0,
+    "generate_id"   int4         NOT NULL DEFAULT 0,
+    "file_id"       int4         NOT NULL DEFAULT 0,
+    "data_id"       int4         NOT NULL DEFAULT 0,
+    "number"        int4         NOT NULL DEFAULT 0,
+    "page_num"      int4         NOT NULL DEFAULT 0,
+    "title"         varchar(500) NOT NULL DEFAULT '',
+    "question"      text         NOT NULL DEFAULT '',
+    "answer"        text         NOT NULL DEFAULT '',
+    "images"        json         NOT NULL DEFAULT '[]',
+    "status"        int2         NOT NULL DEFAULT 0,
+    "create_time"   int4         NOT NULL DEFAULT 0,
+    "update_time"   int4         NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_qa_candidate" ("generate_id", "status");
+
+COMMENT ON TABLE "chat_ai_library_qa_candidate" IS '文档问答机器人-生成的候选问答对';
+
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."generate_id" IS '生成任务ID';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."file_id" IS '源文档ID';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."data_id" IS '来源分段ID';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."number" IS '来源分段序号';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."page_num" IS '来源分段页码';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."title" IS '来源分段标题';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."question" IS '问题';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."answer" IS '答案';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."images" IS '来源分段的图片';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."status" IS '状态:0待审核,1已采纳,2已拒绝,3已保存';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_qa_candidate"."update_time" IS '更新时间';
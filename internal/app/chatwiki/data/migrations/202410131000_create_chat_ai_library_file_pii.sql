@@ -0,0 +1,45 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library"
+    ADD COLUMN "pii_status"    int2         NOT NULL DEFAULT 0,
+    ADD COLUMN "pii_action"    int2         NOT NULL DEFAULT 1,
+    ADD COLUMN "pii_detectors" varchar(500) NOT NULL DEFAULT '',
+    ADD COLUMN "pii_patterns"  text         NOT NULL DEFAULT '[]';
+
+COMMENT ON COLUMN "chat_ai_library"."pii_status" IS '是否开启敏感信息脱敏:0否,1是';
+COMMENT ON COLUMN "chat_ai_library"."pii_action" IS '命中后的处理:1掩码,2丢弃分段,3仅标记';
+COMMENT ON COLUMN "chat_ai_library"."pii_detectors" IS '启用的内置检测项,逗号分隔';
+COMMENT ON COLUMN "chat_ai_library"."pii_patterns" IS '自定义检测规则(json)';
+
+ALTER TABLE "chat_ai_library_file"
+    ADD COLUMN "pii_total" int4 NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "chat_ai_library_file"."pii_total" IS '最近一次学习命中敏感信息的分段检测项数';
+
+CREATE TABLE "chat_ai_library_file_pii"
+(
+    "id"            serial       NOT NULL primary key,
+    "admin_user_id" int4         NOT NULL DEFAULT 0,
+    "library_id"    int4         NOT NULL DEFAULT 0,
+    "file_id"       int4         NOT NULL DEFAULT 0,
+    "number"        int4         NOT NULL DEFAULT 0,
+    "detector"      varchar(100) NOT NULL DEFAULT '',
+    "hit_total"     int4         NOT NULL DEFAULT 0,
+    "action"        int2         NOT NULL DEFAULT 0,
+    "create_time"   int4         NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_file_pii" ("file_id");
+CREATE INDEX ON "chat_ai_library_file_pii" ("library_id");
+
+COMMENT ON TABLE "chat_ai_library_file_pii" IS '文档问答机器人-知识库文件最近一次学习的脱敏报告';
+
+COMMENT ON COLUMN "chat_ai_library_file_pii"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_file_pii"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_file_pii"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_file_pii"."file_id" IS '知识库文件ID';
+COMMENT ON COLUMN "chat_ai_library_file_pii"."number" IS '脱敏前的分段序号';
+COMMENT ON COLUMN "chat_ai_library_file_pii"."detector" IS '检测项';
+COMMENT ON COLUMN "chat_ai_library_file_pii"."hit_total" IS '命中次数';
+COMMENT ON COLUMN "chat_ai_library_file_pii"."action" IS '处理方式:1掩码,2丢弃分段,3仅标记';
+COMMENT ON COLUMN "chat_ai_library_file_pii"."create_time" IS '创建时间';
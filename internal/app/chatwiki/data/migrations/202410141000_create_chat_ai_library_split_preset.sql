@@ -0,0 +1,32 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library"
+    ADD COLUMN "separator_rules" text NOT NULL DEFAULT '[]';
+
+COMMENT ON COLUMN "chat_ai_library"."separator_rules" IS '知识库默认的自定义正则分隔符(json)';
+
+ALTER TABLE "chat_ai_library_file"
+    ADD COLUMN "separator_rules" text NOT NULL DEFAULT '[]';
+
+COMMENT ON COLUMN "chat_ai_library_file"."separator_rules" IS '自定义正则分隔符(json),为空时使用知识库的默认规则';
+
+CREATE TABLE "chat_ai_library_split_preset"
+(
+    "id"            serial       NOT NULL primary key,
+    "admin_user_id" int4         NOT NULL DEFAULT 0,
+    "name"          varchar(100) NOT NULL DEFAULT '',
+    "split_params"  text         NOT NULL DEFAULT '{}',
+    "create_time"   int4         NOT NULL DEFAULT 0,
+    "update_time"   int4         NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_split_preset" ("admin_user_id");
+
+COMMENT ON TABLE "chat_ai_library_split_preset" IS '文档问答机器人-保存的分段预设';
+
+COMMENT ON COLUMN "chat_ai_library_split_preset"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_split_preset"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_split_preset"."name" IS '预设名称';
+COMMENT ON COLUMN "chat_ai_library_split_preset"."split_params" IS '分段参数(json)';
+COMMENT ON COLUMN "chat_ai_library_split_preset"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_split_preset"."update_time" IS '更新时间';
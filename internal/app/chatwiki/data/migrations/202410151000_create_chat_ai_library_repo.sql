@@ -0,0 +1,55 @@
+-- +goose Up
+
+CREATE TABLE "chat_ai_library_repo"
+(
+    "id"             serial        NOT NULL primary key,
+    "admin_user_id"  int4          NOT NULL DEFAULT 0,
+    "library_id"     int4          NOT NULL DEFAULT 0,
+    "source_type"    int2          NOT NULL DEFAULT 1,
+    "source_url"     varchar(500)  NOT NULL DEFAULT '',
+    "branch"         varchar(100)  NOT NULL DEFAULT '',
+    "include_globs"  varchar(1000) NOT NULL DEFAULT '',
+    "exclude_globs"  varchar(1000) NOT NULL DEFAULT '',
+    "sync_interval"  int4          NOT NULL DEFAULT 0,
+    "status"         int2          NOT NULL DEFAULT 0,
+    "errmsg"         varchar(1000) NOT NULL DEFAULT '',
+    "last_commit"    varchar(64)   NOT NULL DEFAULT '',
+    "last_sync_time" int4          NOT NULL DEFAULT 0,
+    "file_total"     int4          NOT NULL DEFAULT 0,
+    "added_total"    int4          NOT NULL DEFAULT 0,
+    "updated_total"  int4          NOT NULL DEFAULT 0,
+    "deleted_total"  int4          NOT NULL DEFAULT 0,
+    "create_time"    int4          NOT NULL DEFAULT 0,
+    "update_time"    int4          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_repo" ("library_id");
+
+COMMENT ON TABLE "chat_ai_library_repo" IS '文档问答机器人-知识库同步的git仓库或本地目录';
+
+COMMENT ON COLUMN "chat_ai_library_repo"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_repo"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_repo"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_repo"."source_type" IS '来源类型:1git仓库,2本地目录';
+COMMENT ON COLUMN "chat_ai_library_repo"."source_url" IS 'git远程地址或本地目录';
+COMMENT ON COLUMN "chat_ai_library_repo"."branch" IS 'git分支,为空时使用默认分支';
+COMMENT ON COLUMN "chat_ai_library_repo"."include_globs" IS '包含的文件规则,换行分隔,为空时包含全部';
+COMMENT ON COLUMN "chat_ai_library_repo"."exclude_globs" IS '排除的文件规则,换行分隔';
+COMMENT ON COLUMN "chat_ai_library_repo"."sync_interval" IS '自动同步间隔(分钟),0仅手动同步';
+COMMENT ON COLUMN "chat_ai_library_repo"."status" IS '状态:1同步中,2已同步,3同步失败';
+COMMENT ON COLUMN "chat_ai_library_repo"."errmsg" IS '错误信息';
+COMMENT ON COLUMN "chat_ai_library_repo"."last_commit" IS '最近一次同步的提交';
+COMMENT ON COLUMN "chat_ai_library_repo"."last_sync_time" IS '最近一次同步时间';
+COMMENT ON COLUMN "chat_ai_library_repo"."file_total" IS '最近一次同步匹配的文件数';
+COMMENT ON COLUMN "chat_ai_library_repo"."added_total" IS '最近一次同步新增的文件数';
+COMMENT ON COLUMN "chat_ai_library_repo"."updated_total" IS '最近一次同步更新的文件数';
+COMMENT ON COLUMN "chat_ai_library_repo"."deleted_total" IS '最近一次同步删除的文件数';
+COMMENT ON COLUMN "chat_ai_library_repo"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_repo"."update_time" IS '更新时间';
+
+ALTER TABLE "chat_ai_library_file"
+    ADD COLUMN "repo_id" int4 NOT NULL DEFAULT 0;
+
+CREATE INDEX ON "chat_ai_library_file" ("repo_id");
+
+COMMENT ON COLUMN "chat_ai_library_file"."repo_id" IS '同步来源ID,doc_type为4时doc_url是仓库内的相对路径';
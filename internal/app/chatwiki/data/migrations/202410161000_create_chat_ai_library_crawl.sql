@@ -0,0 +1,93 @@
+-- +goose Up
+
+CREATE TABLE "chat_ai_library_crawl"
+(
+    "id"              serial        NOT NULL primary key,
+    "admin_user_id"   int4          NOT NULL DEFAULT 0,
+    "library_id"      int4          NOT NULL DEFAULT 0,
+    "seed_type"       int2          NOT NULL DEFAULT 1,
+    "seed_url"        varchar(500)  NOT NULL DEFAULT '',
+    "domains"         varchar(1000) NOT NULL DEFAULT '',
+    "path_prefixes"   varchar(1000) NOT NULL DEFAULT '',
+    "max_depth"       int4          NOT NULL DEFAULT 0,
+    "max_pages"       int4          NOT NULL DEFAULT 0,
+    "renew_frequency" int2          NOT NULL DEFAULT 1,
+    "status"          int2          NOT NULL DEFAULT 0,
+    "errmsg"          varchar(1000) NOT NULL DEFAULT '',
+    "round"           int4          NOT NULL DEFAULT 0,
+    "page_total"      int4          NOT NULL DEFAULT 0,
+    "done_total"      int4          NOT NULL DEFAULT 0,
+    "failed_total"    int4          NOT NULL DEFAULT 0,
+    "added_total"     int4          NOT NULL DEFAULT 0,
+    "updated_total"   int4          NOT NULL DEFAULT 0,
+    "deleted_total"   int4          NOT NULL DEFAULT 0,
+    "last_renew_time" int4          NOT NULL DEFAULT 0,
+    "create_time"     int4          NOT NULL DEFAULT 0,
+    "update_time"     int4          NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON "chat_ai_library_crawl" ("library_id");
+
+COMMENT ON TABLE "chat_ai_library_crawl" IS '文档问答机器人-知识库整站抓取任务';
+
+COMMENT ON COLUMN "chat_ai_library_crawl"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_crawl"."admin_user_id" IS '管理员用户ID';
+COMMENT ON COLUMN "chat_ai_library_crawl"."library_id" IS '知识库ID';
+COMMENT ON COLUMN "chat_ai_library_crawl"."seed_type" IS '种子类型:1起始网址,2sitemap.xml';
+COMMENT ON COLUMN "chat_ai_library_crawl"."seed_url" IS '起始网址或sitemap地址';
+COMMENT ON COLUMN "chat_ai_library_crawl"."domains" IS '允许抓取的域名,换行分隔,为空时仅抓取种子的域名';
+COMMENT ON COLUMN "chat_ai_library_crawl"."path_prefixes" IS '允许抓取的路径前缀,换行分隔,为空时不限制';
+COMMENT ON COLUMN "chat_ai_library_crawl"."max_depth" IS '链接跟随的最大深度';
+COMMENT ON COLUMN "chat_ai_library_crawl"."max_pages" IS '每轮抓取的最大页面数';
+COMMENT ON COLUMN "chat_ai_library_crawl"."renew_frequency" IS '自动更新频率:1不自动更新,2每天,3每3天,4每7天,5每30天';
+COMMENT ON COLUMN "chat_ai_library_crawl"."status" IS '状态:1抓取中,2已完成,3抓取失败,4已取消';
+COMMENT ON COLUMN "chat_ai_library_crawl"."errmsg" IS '错误信息';
+COMMENT ON COLUMN "chat_ai_library_crawl"."round" IS '抓取轮次,每次更新加1';
+COMMENT ON COLUMN "chat_ai_library_crawl"."page_total" IS '本轮发现的页面数';
+COMMENT ON COLUMN "chat_ai_library_crawl"."done_total" IS '本轮已抓取的页面数';
+COMMENT ON COLUMN "chat_ai_library_crawl"."failed_total" IS '本轮抓取失败的页面数';
+COMMENT ON COLUMN "chat_ai_library_crawl"."added_total" IS '本轮新增的文档数';
+COMMENT ON COLUMN "chat_ai_library_crawl"."updated_total" IS '本轮更新的文档数';
+COMMENT ON COLUMN "chat_ai_library_crawl"."deleted_total" IS '本轮删除的文档数';
+COMMENT ON COLUMN "chat_ai_library_crawl"."last_renew_time" IS '最近一轮开始的时间';
+COMMENT ON COLUMN "chat_ai_library_crawl"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_crawl"."update_time" IS '更新时间';
+
+CREATE TABLE "chat_ai_library_crawl_page"
+(
+    "id"          serial        NOT NULL primary key,
+    "crawl_id"    int4          NOT NULL DEFAULT 0,
+    "url"         varchar(1000) NOT NULL DEFAULT '',
+    "url_hash"    varchar(32)   NOT NULL DEFAULT '',
+    "depth"       int4          NOT NULL DEFAULT 0,
+    "round"       int4          NOT NULL DEFAULT 0,
+    "status"      int2          NOT NULL DEFAULT 0,
+    "file_id"     int4          NOT NULL DEFAULT 0,
+    "errmsg"      varchar(500)  NOT NULL DEFAULT '',
+    "create_time" int4          NOT NULL DEFAULT 0,
+    "update_time" int4          NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX ON "chat_ai_library_crawl_page" ("crawl_id", "url_hash");
+CREATE INDEX ON "chat_ai_library_crawl_page" ("crawl_id", "round", "status");
+
+COMMENT ON TABLE "chat_ai_library_crawl_page" IS '文档问答机器人-整站抓取发现的页面';
+
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."id" IS 'ID';
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."crawl_id" IS '抓取任务ID';
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."url" IS '规范化后的网址';
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."url_hash" IS '网址的md5,用于去重';
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."depth" IS '距离种子的链接深度';
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."round" IS '最近一次发现该页面的轮次';
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."status" IS '状态:0待抓取,1已抓取,2抓取失败,3与其他页面的canonical重复';
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."file_id" IS '页面对应的文档ID';
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."errmsg" IS '错误信息';
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."create_time" IS '创建时间';
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."update_time" IS '更新时间';
+
+ALTER TABLE "chat_ai_library_file"
+    ADD COLUMN "crawl_id" int4 NOT NULL DEFAULT 0;
+
+CREATE INDEX ON "chat_ai_library_file" ("crawl_id");
+
+COMMENT ON COLUMN "chat_ai_library_file"."crawl_id" IS '整站抓取任务ID,doc_type为2时doc_url是页面网址';
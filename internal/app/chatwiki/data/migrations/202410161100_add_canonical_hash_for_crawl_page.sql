@@ -0,0 +1,8 @@
+-- +goose Up
+
+ALTER TABLE "chat_ai_library_crawl_page"
+    ADD COLUMN "canonical_hash" varchar(32) NOT NULL DEFAULT '';
+
+CREATE INDEX ON "chat_ai_library_crawl_page" ("crawl_id", "canonical_hash");
+
+COMMENT ON COLUMN "chat_ai_library_crawl_page"."canonical_hash" IS '页面声明的canonical网址的md5,canonical页面抓取完成后该页面标记为重复';
@@ -11,4 +11,7 @@ type ConfigParam struct {
 	Postgres   map[string]string
 	NsqLookup  map[string]string
 	Nsqd       map[string]string
+	//optional sections
+	EmbeddingCache map[string]string
+	RepoSync       map[string]string
 }
@@ -7,3 +7,6 @@ var Env string
 
 const AppRoot = `internal/app/chatwiki/`
 const UploadDir = AppRoot + `upload/`
+
+// RepoDir the working copies of the synced git repositories,not served as the uploads
+const RepoDir = AppRoot + `repo/`
@@ -9,6 +9,38 @@ const ConvertHtmlChannel = `convert_html_channel`
 
 const ConvertVectorTopic = `chatwiki_convert_vector_topic`
 const ConvertVectorChannel = `convert_vector_channel`
+const ConvertVectorClaimSize = 20 //the pending rows claimed by a message,not an embedding batch:one request is still made per distinct content
+const ConvertVectorConcurrency = 5
+const ConvertVectorRetryMax = 5
+const ConvertVectorRetryDelay = 30 //seconds,doubled after each retry
+
+const LibraryReindexTopic = `chatwiki_library_reindex_topic`
+const LibraryReindexChannel = `library_reindex_channel`
+const LibraryReindexBatchSize = 50
+
+const LibraryEvalTopic = `chatwiki_library_eval_topic`
+const LibraryEvalChannel = `library_eval_channel`
+
+const SyntheticQuestionTopic = `chatwiki_synthetic_question_topic`
+const SyntheticQuestionChannel = `synthetic_question_channel`
+
+const GraphExtractTopic = `chatwiki_graph_extract_topic`
+const GraphExtractChannel = `graph_extract_channel`
+
+const GraphCommunityTopic = `chatwiki_graph_community_topic`
+const GraphCommunityChannel = `graph_community_channel`
+
+const LibraryImportTopic = `chatwiki_library_import_topic`
+const LibraryImportChannel = `library_import_channel`
+
+const QaGenerateTopic = `chatwiki_qa_generate_topic`
+const QaGenerateChannel = `qa_generate_channel`
+
+const LibraryRepoSyncTopic = `chatwiki_library_repo_sync_topic`
+const LibraryRepoSyncChannel = `library_repo_sync_channel`
+
+const LibraryCrawlTopic = `chatwiki_library_crawl_topic`
+const LibraryCrawlChannel = `library_crawl_channel`
 
 const CrawlArticleTopic = `chatwiki_crawl_article_topic`
 const CrawlArticleChannel = `chatwiki_crawl_article_channel`
@@ -58,3 +58,71 @@ your answer
 <img>
 如果system prompt没有<img>标签或者没有其他的system prompt，则不返回<img>标签。
 `
+
+const PromptDefaultSyntheticQuestion = `
+你是一个知识库助手。请仔细阅读下面的文档片段，站在用户的角度，生成 {{num}} 个用户最可能提出、且能由该片段回答的问题。
+要求:
+1. 问题要简洁、具体，使用与文档片段相同的语言。
+2. 问题之间不要重复，不要编造片段中没有的信息。
+3. 只返回JSON数组，不要返回其他内容，格式如下: ["问题1", "问题2", "问题3"]
+文档片段:
+"""
+{{content}}
+"""`
+
+const PromptDefaultQaGenerate = `
+你是一个知识库整理助手。请仔细阅读下面的文档片段，把其中的知识整理成最多 {{num}} 组问答对。
+要求:
+1. 问题要站在用户的角度，简洁、具体；答案要完整，且只能来自文档片段，不要编造。
+2. 问答对之间不要重复，片段中没有可整理的知识时返回空数组。
+3. 使用与文档片段相同的语言。
+4. 只返回JSON数组，不要返回其他内容，格式如下: [{"question":"问题1","answer":"答案1"},{"question":"问题2","answer":"答案2"}]
+文档片段:
+"""
+{{content}}
+"""`
+
+const PromptDefaultGraphExtract = `
+你是一个知识图谱构建助手。请从下面的文档片段中抽取重要的实体(如产品、组件、人员、组织、部门、地点、概念等)以及实体之间的关系。
+要求:
+1. 实体名称使用文档中的原文，同一实体的其他叫法放入aliases。
+2. 关系的source和target必须是entities中的实体名称，relation用简短的短语描述。
+3. 不要编造片段中没有的信息，没有可抽取的内容时返回空数组。
+4. 只返回JSON，不要返回其他内容，格式如下:
+{"entities":[{"name":"实体名称","type":"实体类型","description":"一句话描述","aliases":["别名"]}],"relations":[{"source":"实体名称","target":"实体名称","relation":"关系"}]}
+文档片段:
+"""
+{{content}}
+"""`
+
+const PromptDefaultGraphCommunity = `
+你是一个知识图谱分析助手。下面是知识库中一组相互关联的实体及其关系，请用一段话(不超过300字)总结这组实体的整体情况以及它们之间的关键联系，便于回答跨文档的问题。
+实体:
+"""
+{{entities}}
+"""
+关系:
+"""
+{{relations}}
+"""
+只返回总结内容。`
+
+const PromptDefaultLibraryRoute = `
+你是一个问题分类助手。下面是若干个知识库的ID、名称和简介，请判断回答用户问题需要检索哪些知识库，最多选择 {{top_n}} 个。
+知识库:
+"""
+{{libraries}}
+"""
+用户问题: {{question}}
+只返回选中知识库ID组成的JSON数组，不要返回其他内容，例如: [1, 2]。没有相关的知识库时返回 []`
+
+const PromptDefaultHyde = `
+请结合历史对话记录，针对用户的问题写一段可能出现在知识库文档中的回答内容。
+要求:
+1. 即使不确定答案，也要按文档的口吻给出一段合理、具体的回答，不需要说明不确定。
+2. 使用与问题相同的语言，不超过200字，只返回回答内容。
+历史记录:
+"""
+{{histories}}
+"""
+问题: {{query}}`
@@ -28,6 +28,7 @@ type UploadInfo struct {
 	Online bool   `json:"-"`
 	DocUrl string `json:"-"`
 	Custom bool   `json:"-"`
+	Hash   string `json:"-"`
 }
 
 func (u *UploadInfo) GetDocType() int {
@@ -61,29 +62,46 @@ type ChatRequestParam struct {
 }
 
 type DocSplitItem struct {
-	Number    int      `json:"number"`
-	PageNum   int      `json:"page_num"`
-	Title     string   `json:"title"`
-	Content   string   `json:"content"`
-	Question  string   `json:"question"`
-	Answer    string   `json:"answer"`
-	WordTotal int      `json:"word_total"`
-	Images    []string `json:"images"`
+	Number     int      `json:"number"`
+	PageNum    int      `json:"page_num"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Question   string   `json:"question"`
+	Answer     string   `json:"answer"`
+	WordTotal  int      `json:"word_total"`
+	TokenTotal int      `json:"token_total"`
+	Images     []string `json:"images"`
 }
 
 type SplitParams struct {
-	IsTableFile        int      `json:"is_table_file"`
-	IsDiySplit         int      `json:"is_diy_split"`
-	SeparatorsNo       string   `json:"separators_no"`
-	Separators         []string `json:"-"`
-	ChunkSize          int      `json:"chunk_size"`
-	ChunkOverlap       int      `json:"chunk_overlap"`
-	IsQaDoc            int      `json:"is_qa_doc"`
-	QuestionLable      string   `json:"question_lable"`
-	AnswerLable        string   `json:"answer_lable"`
-	QuestionColumn     string   `json:"question_column"`
-	AnswerColumn       string   `json:"answer_column"`
-	EnableExtractImage bool     `json:"enable_extract_image"`
+	IsTableFile        int             `json:"is_table_file"`
+	IsDiySplit         int             `json:"is_diy_split"`
+	SeparatorsNo       string          `json:"separators_no"`
+	Separators         []string        `json:"-"`
+	ChunkSize          int             `json:"chunk_size"`
+	ChunkOverlap       int             `json:"chunk_overlap"`
+	IsQaDoc            int             `json:"is_qa_doc"`
+	QuestionLable      string          `json:"question_lable"`
+	AnswerLable        string          `json:"answer_lable"`
+	QuestionColumn     string          `json:"question_column"`
+	AnswerColumn       string          `json:"answer_column"`
+	EnableExtractImage bool            `json:"enable_extract_image"`
+	SplitMode          int             `json:"split_mode"`
+	ChunkUnit          int             `json:"chunk_unit"`
+	TableFormat        int             `json:"table_format"`
+	FileExt            string          `json:"-"`
+	JsonRecordPath     string          `json:"json_record_path"`
+	JsonContentField   string          `json:"json_content_field"`
+	JsonQuestionField  string          `json:"json_question_field"`
+	JsonAnswerField    string          `json:"json_answer_field"`
+	SeparatorRules     []SeparatorRule `json:"separator_rules"`
+}
+
+// SeparatorRule a custom regex separator,the rules are applied by the priority from small to large
+type SeparatorRule struct {
+	Pattern       string `json:"pattern"`
+	KeepDelimiter bool   `json:"keep_delimiter"` //the matched text starts the next paragraph
+	Priority      int    `json:"priority"`
 }
 
 type FormFilterCondition struct {
@@ -163,3 +181,60 @@ type CommonQuestion struct {
 	Question string `json:"question"`
 	Answer   string `json:"answer"`
 }
+
+type RankParams struct {
+	VectorWeight  float64
+	VectorK       int
+	SearchWeight  float64
+	SearchK       int
+	RerankWeight  float64
+	RerankK       int
+	MmrStatus     int
+	MmrLambda     float64
+	MinFusedScore float64
+	GraphStatus   int
+	GraphWeight   float64
+	GraphK        int
+}
+
+type LibraryRouteParams struct {
+	RouteType int
+	TopN      int
+	Threshold float64
+}
+
+type GraphEntity struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Aliases     []string `json:"aliases"`
+}
+
+type GraphRelation struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Relation string `json:"relation"`
+}
+
+type GraphExtractResult struct {
+	Entities  []GraphEntity   `json:"entities"`
+	Relations []GraphRelation `json:"relations"`
+}
+
+type EvalConfig struct {
+	Name                string  `json:"name"`
+	Size                int     `json:"size"`
+	Similarity          float64 `json:"similarity"`
+	SearchType          int     `json:"search_type"`
+	RerankModelConfigId int     `json:"rerank_model_config_id"`
+	RerankUseModel      string  `json:"rerank_use_model"`
+}
+
+type EvalResult struct {
+	Config        EvalConfig `json:"config"`
+	QuestionTotal int        `json:"question_total"`
+	ErrorTotal    int        `json:"error_total"` //the questions whose retrieval failed,scored 0
+	Recall        float64    `json:"recall"`
+	MRR           float64    `json:"mrr"`
+	NDCG          float64    `json:"ndcg"`
+}
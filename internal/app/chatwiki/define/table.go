@@ -7,14 +7,15 @@ const VectorDimension = 2000
 const MaxRobotNum = 6
 
 const (
-	FileStatusWaitCrawl      = 5
-	FileStatusCrawling       = 6
-	FileStatusCrawlException = 7
-	FileStatusInitial        = 0
-	FileStatusException      = 3
-	FileStatusWaitSplit      = 4
-	FileStatusLearning       = 1
-	FileStatusLearned        = 2
+	FileStatusWaitCrawl         = 5
+	FileStatusCrawling          = 6
+	FileStatusCrawlException    = 7
+	FileStatusInitial           = 0
+	FileStatusException         = 3
+	FileStatusWaitSplit         = 4
+	FileStatusLearning          = 1
+	FileStatusLearned           = 2
+	FileStatusLearnedWithErrors = 8 //some vectors failed after the retries
 )
 
 const (
@@ -44,6 +45,33 @@ const (
 	DocTypeQa   = 1
 )
 
+const (
+	SplitModeRecursive = 0 //split the plain text by the separators
+	SplitModeStructure = 1 //split the converted html by the headings,the breadcrumb is the title
+)
+
+const ParagraphTitleMaxLen = 500
+
+const (
+	TableFormatMarkdown = 0 //markdown table,the header is repeated in each chunk
+	TableFormatRow      = 1 //a row per line as column:value
+)
+
+const (
+	ChunkUnitChar  = 0
+	ChunkUnitToken = 1
+
+	ChunkTokenSizeMin     = 50
+	DefaultVectorMaxInput = 512 //the embedding models whose max input is unknown
+	TokenEstimateMargin   = 80  //percent of the max input usable when the tokens are estimated
+)
+
+const (
+	SeparatorRuleMax      = 20
+	SeparatorRuleMaxLen   = 500
+	SplitPresetNameMaxLen = 100
+)
+
 const (
 	ParagraphTypeNormal  = 1
 	ParagraphTypeDocQA   = 2
@@ -55,6 +83,145 @@ const (
 	VectorTypeQuestion  = 2
 	VectorTypeAnswer    = 3
 	VectorTypeCustom    = 4
+	VectorTypeChild     = 5
+)
+
+const (
+	ReindexStatusRunning    = 1
+	ReindexStatusSwitched   = 2
+	ReindexStatusFinished   = 3
+	ReindexStatusCancelled  = 4
+	ReindexStatusFailed     = 5
+	ReindexStatusRolledBack = 6
+)
+
+// ReindexRollbackKeepTime the original vectors are kept for rollback after switching
+const ReindexRollbackKeepTime = 86400
+
+// ReindexStaleTime seconds,the running reindex not updated for it is continued by the crontab
+const ReindexStaleTime = 10 * 60
+
+const (
+	ImportStatusRunning  = 1
+	ImportStatusFinished = 2
+	ImportStatusFailed   = 3
+)
+
+// ImportStaleTime seconds,the running import not updated for it is continued by the crontab
+const ImportStaleTime = 10 * 60
+
+const (
+	ImportFileStatusImported    = 1
+	ImportFileStatusDuplicate   = 2
+	ImportFileStatusUnsupported = 3
+	ImportFileStatusFailed      = 4
+)
+
+const (
+	DeadVectorStatusWaiting  = 1
+	DeadVectorStatusRetrying = 2
+)
+
+const (
+	IngestStageCrawl   = 1
+	IngestStageConvert = 2
+	IngestStageSplit   = 3
+	IngestStageEmbed   = 4
+)
+
+const (
+	IngestStatusRunning   = 1
+	IngestStatusFinished  = 2
+	IngestStatusFailed    = 3
+	IngestStatusCancelled = 4 //replaced by a new ingestion of the same file
+)
+
+// LibFileVersionKeep the versions of a file that are kept for the diff and the rollback
+const LibFileVersionKeep = 20
+
+// IngestStreamInterval the interval of polling the ingestion jobs for the progress stream
+const IngestStreamInterval = 2
+
+const (
+	EvalRunStatusRunning  = 1
+	EvalRunStatusFinished = 2
+	EvalRunStatusFailed   = 3
+)
+
+const (
+	ChildChunkSizeMin = 50
+	ChildChunkSizeMax = 1000
+)
+
+const (
+	SyntheticQuestionNumMin = 1
+	SyntheticQuestionNumMax = 10
+	SyntheticQuestionMaxLen = 200
+)
+
+const (
+	QaGenerateStatusRunning  = 1
+	QaGenerateStatusFinished = 2
+	QaGenerateStatusFailed   = 3
+)
+
+const (
+	QaCandidateStatusPending  = 0
+	QaCandidateStatusAccepted = 1
+	QaCandidateStatusRejected = 2
+	QaCandidateStatusSaved    = 3 //accepted and saved to the qa file
+)
+
+const (
+	QaGeneratePairNumMin = 1
+	QaGeneratePairNumMax = 10
+)
+
+const (
+	PiiActionMask = 1 //replace the matched text with *
+	PiiActionDrop = 2 //drop the whole paragraph
+	PiiActionFlag = 3 //keep the paragraph and only report it
+)
+
+const (
+	PiiCustomPatternMax    = 20
+	PiiCustomNameMaxLen    = 50
+	PiiCustomPatternMaxLen = 500
+)
+
+// PiiDetectorList the built-in detectors,applied in this order so a longer number is matched before its parts
+var PiiDetectorList = []map[string]any{
+	{`name`: `email`, `pack`: `common`},
+	{`name`: `cn_id_card`, `pack`: `cn`},
+	{`name`: `cn_mobile`, `pack`: `cn`},
+	{`name`: `cn_bank_card`, `pack`: `cn`},
+	{`name`: `eu_iban`, `pack`: `eu`},
+	{`name`: `eu_phone`, `pack`: `eu`},
+	{`name`: `us_ssn`, `pack`: `us`},
+	{`name`: `us_phone`, `pack`: `us`},
+	{`name`: `credit_card`, `pack`: `common`},
+}
+
+const (
+	GraphEntityNameMaxLen    = 200
+	GraphSeedEntityLimit     = 20
+	GraphCommunityMinEntity  = 2
+	GraphCommunityMaxEntity  = 30
+	GraphCommunitySummaryMax = 3
+)
+
+const (
+	QueryExpansionNone  = 0
+	QueryExpansionMulti = 1
+	QueryExpansionHyde  = 2
+	QueryExpansionBoth  = 3
+)
+
+const (
+	LibraryRouteOff       = 0
+	LibraryRouteEmbedding = 1
+	LibraryRouteLlm       = 2
+	LibraryRouteTopNMax   = 20
 )
 
 const (
@@ -97,6 +264,51 @@ const (
 	DocTypeLocal  = 1
 	DocTypeOnline = 2
 	DocTypeCustom = 3
+	DocTypeRepo   = 4 //synced from a git repository or a local directory
+)
+
+const (
+	CrawlSeedUrl     = 1
+	CrawlSeedSitemap = 2
+)
+
+const (
+	CrawlStatusRunning   = 1
+	CrawlStatusFinished  = 2
+	CrawlStatusFailed    = 3
+	CrawlStatusCancelled = 4
+)
+
+const (
+	CrawlPageStatusPending   = 0
+	CrawlPageStatusDone      = 1
+	CrawlPageStatusFailed    = 2
+	CrawlPageStatusDuplicate = 3 //the canonical url is crawled as another page
+)
+
+const (
+	CrawlMaxDepth      = 10
+	CrawlMaxPages      = 2000
+	CrawlBatchPages    = 10      //the pages crawled by a job message,the rest are continued by the next message
+	CrawlStaleTime     = 10 * 60 //seconds,the running job not updated for it is continued by the crontab
+	CrawlSitemapNested = 3       //the nested sitemap index levels
+)
+
+const (
+	RepoSourceGit = 1
+	RepoSourceDir = 2
+)
+
+const (
+	RepoStatusSyncing = 1
+	RepoStatusSynced  = 2
+	RepoStatusFailed  = 3
+)
+
+const (
+	RepoSyncIntervalMin = 10      //minutes,0 is synced manually only
+	RepoSyncTimeout     = 30 * 60 //seconds,the syncing longer than it is treated as interrupted
+	RepoSyncDeleteLimit = 100     //the files deleted at most per sync,the others are deleted by the next syncs
 )
 
 const (
@@ -10,11 +10,24 @@ const ImageLimitSize = 100 * 1024          //100KB
 const ImageAvatarLimitSize = 1024 * 1024   //1m
 const LibFileLimitSize = 100 * 1024 * 1024 //100MB
 const LibImageLimitSize = 2 * 1024 * 1024  // 2M
+const LibZipLimitSize = 200 * 1024 * 1024  //200MB,the body limit of the nginx
 
 var ImageAllowExt = []string{`heic`, `gif`, `jpg`, `jpeg`, `png`, `swf`, `bmp`, `webp`}
-var LibFileAllowExt = []string{`pdf`, `docx`, `txt`, `md`, `xlsx`, `csv`, `html`}
+var LibFileAllowExt = []string{`pdf`, `docx`, `txt`, `md`, `xlsx`, `csv`, `html`, `odt`,
+	`pptx`, `xls`, `epub`, `eml`, `mbox`, `json`, `jsonl`}
 
 func IsTableFile(ext string) bool {
 	ext = strings.ToLower(ext)
-	return ext == `xlsx` || ext == `csv`
+	return ext == `xlsx` || ext == `xls` || ext == `csv`
+}
+
+// IsNativeFile the files read by the native extractors,they are not converted to html
+func IsNativeFile(ext string) bool {
+	ext = strings.ToLower(ext)
+	return ext == `pptx` || ext == `epub` || ext == `eml` || ext == `mbox` || IsJsonFile(ext)
+}
+
+func IsJsonFile(ext string) bool {
+	ext = strings.ToLower(ext)
+	return ext == `json` || ext == `jsonl`
 }
@@ -79,4 +79,14 @@ func initConfig() {
 		logs.Error(err.Error())
 		panic(`read config nsqd error`)
 	}
+
+	//optional config
+	define.Config.EmbeddingCache, err = config.GetSection(`embedding_cache`)
+	if err != nil {
+		define.Config.EmbeddingCache = map[string]string{}
+	}
+	define.Config.RepoSync, err = config.GetSection(`repo_sync`)
+	if err != nil {
+		define.Config.RepoSync = map[string]string{}
+	}
 }
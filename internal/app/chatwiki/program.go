@@ -62,13 +62,28 @@ func StartConsumer() {
 	common.RunTask(define.ConvertHtmlTopic, define.ConvertHtmlChannel, 1, business.ConvertHtml)
 	common.RunTask(define.ConvertVectorTopic, define.ConvertVectorChannel, 2, business.ConvertVector)
 	common.RunTask(define.CrawlArticleTopic, define.CrawlArticleChannel, 2, business.CrawlArticle)
+	common.RunTask(define.LibraryReindexTopic, define.LibraryReindexChannel, 1, business.LibraryReindex)
+	common.RunTask(define.LibraryEvalTopic, define.LibraryEvalChannel, 1, business.LibraryEval)
+	common.RunTask(define.LibraryImportTopic, define.LibraryImportChannel, 1, business.LibraryImport)
+	common.RunTask(define.QaGenerateTopic, define.QaGenerateChannel, 1, business.QaGenerate)
+	common.RunTask(define.LibraryRepoSyncTopic, define.LibraryRepoSyncChannel, 1, business.LibraryRepoSync)
+	common.RunTask(define.LibraryCrawlTopic, define.LibraryCrawlChannel, 1, business.LibraryCrawl)
+	common.RunTask(define.SyntheticQuestionTopic, define.SyntheticQuestionChannel, 2, business.SyntheticQuestion)
+	common.RunTask(define.GraphExtractTopic, define.GraphExtractChannel, 2, business.GraphExtract)
+	common.RunTask(define.GraphCommunityTopic, define.GraphCommunityChannel, 1, business.GraphCommunity)
 }
 
 func StartCronTasks() {
 	c := cron.New()
 	_, _ = c.AddFunc("@every 1m", func() { logs.Debug("cron test") })
 	_, _ = c.AddFunc("@every 1m", func() { business.RenewCrawl() })
+	_, _ = c.AddFunc("@every 1m", func() { business.SyncLibraryRepo() })
+	_, _ = c.AddFunc("@every 1m", func() { business.RenewLibraryCrawl() })
+	_, _ = c.AddFunc("@every 1m", func() { business.RenewLibraryReindex() })
+	_, _ = c.AddFunc("@every 1m", func() { business.RenewLibraryImport() })
 	_, _ = c.AddFunc("@every 1h", func() { business.DeleteFormEntry() })
+	_, _ = c.AddFunc("@every 1h", func() { business.CleanLibraryReindex() })
+	_, _ = c.AddFunc("@every 1h", func() { business.BuildLibraryGraphCommunity() })
 	c.Start()
 	logs.Debug("cron start")
 }
@@ -71,6 +71,13 @@ func init() {
 	Route[http.MethodPost][`/manage/createLibrary`] = manage.CreateLibrary
 	Route[http.MethodPost][`/manage/deleteLibrary`] = manage.DeleteLibrary
 	Route[http.MethodPost][`/manage/editLibrary`] = manage.EditLibrary
+	Route[http.MethodPost][`/manage/startLibraryReindex`] = manage.StartLibraryReindex
+	Route[http.MethodGet][`/manage/getLibraryReindexInfo`] = manage.GetLibraryReindexInfo
+	Route[http.MethodPost][`/manage/cancelLibraryReindex`] = manage.CancelLibraryReindex
+	Route[http.MethodPost][`/manage/rollbackLibraryReindex`] = manage.RollbackLibraryReindex
+	Route[http.MethodGet][`/manage/getLibraryGraphEntityList`] = manage.GetLibraryGraphEntityList
+	Route[http.MethodGet][`/manage/getLibraryGraphRelationList`] = manage.GetLibraryGraphRelationList
+	Route[http.MethodPost][`/manage/rebuildLibraryGraph`] = manage.RebuildLibraryGraph
 	/*libFile API*/
 	Route[http.MethodGet][`/manage/getLibFileList`] = manage.GetLibFileList
 	Route[http.MethodPost][`/manage/addLibraryFile`] = manage.AddLibraryFile
@@ -79,14 +86,52 @@ func init() {
 	Route[http.MethodGet][`/manage/getLibFileExcelTitle`] = manage.GetLibFileExcelTitle
 	Route[http.MethodPost][`/manage/renewLibraryFile`] = manage.RenewLibraryFile
 	Route[http.MethodPost][`/manage/editLibFile`] = manage.EditLibFile
+	Route[http.MethodGet][`/manage/getLibFileChangeList`] = manage.GetLibFileChangeList
+	Route[http.MethodGet][`/manage/getLibFileIngestList`] = manage.GetLibFileIngestList
+	Route[http.MethodGet][`/manage/getLibFileIngestInfo`] = manage.GetLibFileIngestInfo
+	Route[http.MethodGet][`/manage/streamLibFileIngest`] = manage.StreamLibFileIngest
+	Route[http.MethodGet][`/manage/getLibFileVersionList`] = manage.GetLibFileVersionList
+	Route[http.MethodGet][`/manage/getLibFileVersionInfo`] = manage.GetLibFileVersionInfo
+	Route[http.MethodGet][`/manage/getLibFileVersionDiff`] = manage.GetLibFileVersionDiff
+	Route[http.MethodPost][`/manage/rollbackLibFileVersion`] = manage.RollbackLibFileVersion
+	Route[http.MethodPost][`/manage/createQaGenerate`] = manage.CreateQaGenerate
+	Route[http.MethodGet][`/manage/getQaGenerateList`] = manage.GetQaGenerateList
+	Route[http.MethodGet][`/manage/getQaGenerateInfo`] = manage.GetQaGenerateInfo
+	Route[http.MethodPost][`/manage/editQaCandidate`] = manage.EditQaCandidate
+	Route[http.MethodPost][`/manage/reviewQaCandidates`] = manage.ReviewQaCandidates
+	Route[http.MethodPost][`/manage/saveQaCandidates`] = manage.SaveQaCandidates
+	Route[http.MethodGet][`/manage/getPiiDetectorList`] = manage.GetPiiDetectorList
+	Route[http.MethodGet][`/manage/getLibFilePiiReport`] = manage.GetLibFilePiiReport
+	Route[http.MethodGet][`/manage/getLibraryRepoList`] = manage.GetLibraryRepoList
+	Route[http.MethodPost][`/manage/createLibraryRepo`] = manage.CreateLibraryRepo
+	Route[http.MethodPost][`/manage/editLibraryRepo`] = manage.EditLibraryRepo
+	Route[http.MethodPost][`/manage/startLibraryRepoSync`] = manage.StartLibraryRepoSync
+	Route[http.MethodPost][`/manage/deleteLibraryRepo`] = manage.DeleteLibraryRepo
+	Route[http.MethodGet][`/manage/getLibraryCrawlList`] = manage.GetLibraryCrawlList
+	Route[http.MethodGet][`/manage/getLibraryCrawlInfo`] = manage.GetLibraryCrawlInfo
+	Route[http.MethodPost][`/manage/createLibraryCrawl`] = manage.CreateLibraryCrawl
+	Route[http.MethodPost][`/manage/cancelLibraryCrawl`] = manage.CancelLibraryCrawl
+	Route[http.MethodPost][`/manage/resumeLibraryCrawl`] = manage.ResumeLibraryCrawl
+	Route[http.MethodPost][`/manage/renewLibraryCrawl`] = manage.RenewLibraryCrawl
+	Route[http.MethodPost][`/manage/deleteLibraryCrawl`] = manage.DeleteLibraryCrawl
+	Route[http.MethodGet][`/manage/getDeadVectorList`] = manage.GetDeadVectorList
+	Route[http.MethodPost][`/manage/retryDeadVectors`] = manage.RetryDeadVectors
+	Route[http.MethodPost][`/manage/importLibraryZip`] = manage.ImportLibraryZip
+	Route[http.MethodGet][`/manage/getLibraryImportList`] = manage.GetLibraryImportList
+	Route[http.MethodGet][`/manage/getLibraryImportInfo`] = manage.GetLibraryImportInfo
 	/*paragraph API*/
 	Route[http.MethodGet][`/manage/getSeparatorsList`] = manage.GetSeparatorsList
+	Route[http.MethodGet][`/manage/getSplitPresetList`] = manage.GetSplitPresetList
+	Route[http.MethodPost][`/manage/saveSplitPreset`] = manage.SaveSplitPreset
+	Route[http.MethodPost][`/manage/deleteSplitPreset`] = manage.DeleteSplitPreset
 	Route[http.MethodGet][`/manage/getLibFileSplit`] = manage.GetLibFileSplit
 	Route[http.MethodPost][`/manage/saveLibFileSplit`] = manage.SaveLibFileSplit
 	Route[http.MethodGet][`/manage/getParagraphList`] = manage.GetParagraphList
 	Route[http.MethodPost][`/manage/addParagraph`] = manage.SaveParagraph
 	Route[http.MethodPost][`/manage/editParagraph`] = manage.SaveParagraph
 	Route[http.MethodPost][`/manage/deleteParagraph`] = manage.DeleteParagraph
+	Route[http.MethodPost][`/manage/saveSyntheticQuestions`] = manage.SaveSyntheticQuestions
+	Route[http.MethodPost][`/manage/regenerateSyntheticQuestions`] = manage.RegenerateSyntheticQuestions
 	/*form API*/
 	Route[http.MethodGet][`/manage/getFormList`] = manage.GetFormList
 	Route[http.MethodGet][`/manage/getFormInfo`] = manage.GetFormInfo
@@ -121,6 +166,16 @@ func init() {
 	/*debug API*/
 	Route[http.MethodPost][`/manage/getDialogueList`] = manage.GetDialogueList
 	Route[http.MethodPost][`/manage/libraryRecallTest`] = manage.LibraryRecallTest
+	/*library eval API*/
+	Route[http.MethodGet][`/manage/getEvalDatasetList`] = manage.GetEvalDatasetList
+	Route[http.MethodPost][`/manage/saveEvalDataset`] = manage.SaveEvalDataset
+	Route[http.MethodPost][`/manage/deleteEvalDataset`] = manage.DeleteEvalDataset
+	Route[http.MethodGet][`/manage/getEvalQuestionList`] = manage.GetEvalQuestionList
+	Route[http.MethodPost][`/manage/saveEvalQuestion`] = manage.SaveEvalQuestion
+	Route[http.MethodPost][`/manage/deleteEvalQuestion`] = manage.DeleteEvalQuestion
+	Route[http.MethodPost][`/manage/importEvalQuestion`] = manage.ImportEvalQuestion
+	Route[http.MethodPost][`/manage/createEvalRun`] = manage.CreateEvalRun
+	Route[http.MethodGet][`/manage/getEvalRunList`] = manage.GetEvalRunList
 	noAuthFuns(Route[http.MethodGet], `/manage/getAnswerSource`, manage.GetAnswerSource)
 	/*chat API*/
 	noAuthFuns(Route[http.MethodGet], `/chat/getWsUrl`, business.GetWsUrl)
@@ -0,0 +1,180 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+// Package lib_stub the in-memory database and redis used by the handler tests,
+// the statements reaching the driver are recorded with their bound arguments
+package lib_stub
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zhimaAi/go_tools/msql"
+)
+
+const driverName = `lib_stub`
+
+// Query a statement received by the driver
+type Query struct {
+	Sql  string
+	Args []any
+}
+
+// HasArg the value is bound as one of the arguments
+func (q Query) HasArg(value any) bool {
+	for _, arg := range q.Args {
+		if arg == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Responder the rows returned for a statement,nil is an empty result
+type Responder func(query string, args []any) []map[string]string
+
+type DB struct {
+	mu        sync.Mutex
+	queries   []Query
+	responder Responder
+}
+
+var (
+	registerOnce sync.Once
+	dbsMu        sync.Mutex
+	dbs          = make(map[string]*DB)
+)
+
+// RegisterDataBase register the stub as the msql database of the name,
+// a name registered before is reset and reused
+func RegisterDataBase(name string) (*DB, error) {
+	registerOnce.Do(func() { sql.Register(driverName, &stubDriver{}) })
+	dbsMu.Lock()
+	db, ok := dbs[name]
+	if !ok {
+		db = &DB{}
+		dbs[name] = db
+	}
+	dbsMu.Unlock()
+	db.Reset(nil)
+	if ok {
+		return db, nil
+	}
+	return db, msql.RegisterDataBase(name, name, driverName)
+}
+
+// Reset clear the recorded statements and replace the responder
+func (db *DB) Reset(responder Responder) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries, db.responder = nil, responder
+}
+
+// Queries the statements received since the last reset
+func (db *DB) Queries() []Query {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]Query(nil), db.queries...)
+}
+
+func (db *DB) record(query string, args []driver.NamedValue) []map[string]string {
+	values := make([]any, 0, len(args))
+	for _, arg := range args {
+		values = append(values, arg.Value)
+	}
+	db.mu.Lock()
+	db.queries = append(db.queries, Query{Sql: query, Args: values})
+	responder := db.responder
+	db.mu.Unlock()
+	if responder == nil {
+		return nil
+	}
+	return responder(query, values)
+}
+
+type stubDriver struct{}
+
+func (*stubDriver) Open(name string) (driver.Conn, error) {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	db, ok := dbs[name]
+	if !ok {
+		return nil, errors.New(`stub database not registered:` + name)
+	}
+	return &stubConn{db: db}, nil
+}
+
+type stubConn struct {
+	db *DB
+}
+
+func (*stubConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New(`prepare is not supported by the stub`)
+}
+
+func (*stubConn) Close() error { return nil }
+
+func (*stubConn) Begin() (driver.Tx, error) { return stubTx{}, nil }
+
+// CheckNamedValue the arguments are recorded as they are passed
+func (*stubConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c *stubConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return newStubRows(c.db.record(query, args)), nil
+}
+
+func (c *stubConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+type stubTx struct{}
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+type stubRows struct {
+	columns []string
+	rows    []map[string]string
+	index   int
+}
+
+func newStubRows(rows []map[string]string) *stubRows {
+	columns := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		for column := range row {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return &stubRows{columns: columns, rows: rows}
+}
+
+func (r *stubRows) Columns() []string { return r.columns }
+
+func (*stubRows) Close() error { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.index >= len(r.rows) {
+		return io.EOF
+	}
+	for i, column := range r.columns {
+		dest[i] = r.rows[r.index][column]
+	}
+	r.index++
+	return nil
+}
+
+// TableIs the statement reads or writes the table
+func TableIs(query, table string) bool {
+	return strings.Contains(query, `"`+table+`"`) || strings.Contains(query, ` `+table+` `)
+}
@@ -0,0 +1,86 @@
+// Copyright © 2016- 2024 Sesame Network Technology all right reserved
+
+package lib_stub
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/cast"
+)
+
+var errStubbed = errors.New(`handled by the stub`)
+
+// redisHook answer get,set,setnx and del from memory,the other commands succeed with empty values
+type redisHook struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// NewRedis a client never connecting to a server
+func NewRedis() *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: `127.0.0.1:0`})
+	client.AddHook(&redisHook{values: make(map[string]string)})
+	return client
+}
+
+func (h *redisHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return ctx, errStubbed
+}
+
+func (h *redisHook) AfterProcess(_ context.Context, cmd redis.Cmder) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cmd.SetErr(nil)
+	args := cmd.Args()
+	key := ``
+	if len(args) > 1 {
+		key = cast.ToString(args[1])
+	}
+	switch one := cmd.(type) {
+	case *redis.StringCmd:
+		if value, ok := h.values[key]; ok && cmd.Name() == `get` {
+			one.SetVal(value)
+		} else {
+			one.SetErr(redis.Nil)
+		}
+	case *redis.StatusCmd:
+		if cmd.Name() == `set` && len(args) > 2 {
+			h.values[key] = cast.ToString(args[2])
+		}
+		one.SetVal(`OK`)
+	case *redis.BoolCmd:
+		_, ok := h.values[key]
+		if cmd.Name() == `setnx` || cmd.Name() == `set` {
+			if !ok && len(args) > 2 {
+				h.values[key] = cast.ToString(args[2])
+			}
+			one.SetVal(!ok)
+		}
+	case *redis.IntCmd:
+		deleted := int64(0)
+		if cmd.Name() == `del` {
+			for _, arg := range args[1:] {
+				if _, ok := h.values[cast.ToString(arg)]; ok {
+					delete(h.values, cast.ToString(arg))
+					deleted++
+				}
+			}
+		}
+		one.SetVal(deleted)
+	}
+	return nil
+}
+
+func (h *redisHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return ctx, errStubbed
+}
+
+func (h *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		_ = h.AfterProcess(ctx, cmd)
+	}
+	return nil
+}